@@ -1,24 +1,32 @@
 package chess
 
 import (
-	"fmt"
-	"strings"
+	"math/bits"
 )
 
 func popCount(b uint64) int {
-	count := 0
-	for b > 0 {
-		count++
-		b = b & (b - 1)
+	return bits.OnesCount64(b)
+}
+
+// Gets the index of the least significant set bit, or -1 if no bit is set.
+//
+// Together with clearing the lowest bit this iterates over the squares of a
+// mask without allocating:
+//
+//     for squares := mask; squares != 0; squares &= squares - 1 {
+//         square := lsb(squares)
+//     }
+func lsb(b uint64) int {
+	if b == 0 {
+		return -1
 	}
-	return count
+	return bits.TrailingZeros64(b)
 }
 
-func bitScan(b uint64, n int) int {
-	str := fmt.Sprintf("%b", b)
-	r := strings.LastIndex(str[:(len(str)-n)], "1")
-	if r == -1 {
+// Gets the index of the most significant set bit, or -1 if no bit is set.
+func msb(b uint64) int {
+	if b == 0 {
 		return -1
 	}
-	return len(str) - r - 1
+	return 63 - bits.LeadingZeros64(b)
 }
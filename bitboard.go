@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // A bitboard and additional information representing a position.
@@ -22,40 +23,67 @@ type Bitboard struct {
 	queens  uint64
 	kings   uint64
 
-	occupiedCo  [2]uint64
-	occupied    uint64
-	occupiedL90 uint64
-	occupiedL45 uint64
-	occupiedR45 uint64
+	occupiedCo [2]uint64
+	occupied   uint64
 
 	kingSquares [2]int
 	pieces      [64]PieceTypes
 
-	epSquare       int
-	castlingRights int
-	turn           Colors
-	fullMoveNumber int
-	halfMoveClock  int
+	epSquare          int
+	castlingRights    int
+	castlingRookFiles [2][2]int
+	chess960          bool
+	turn              Colors
+	fullMoveNumber    int
+	halfMoveClock     int
 
-	halfMoveClockStack     *Stack
-	capturedPieceStack     *Stack
-	castlingRightStack     *Stack
-	epSquareStack          *Stack
-	moveStack              *Stack
+	stack                  []boardState
 	incrementalZobristHash uint64
-	transpositions         map[uint64]int
+
+	// Counts the Zobrist hashes of the positions before the moves on the
+	// stack. The current position is not included.
+	transpositions map[uint64]int
+
+	// The pieces giving check to the side to move. Restored by `Pop()`
+	// and unknown after any other change to the position.
+	checkers      uint64
+	checkersKnown bool
+
+	// Incrementally updated terms of `DefaultEvaluator`.
+	material     [2]TaperedScore
+	pieceSquares [2]TaperedScore
+	phase        int
+
+	// The rules of the game, pockets and promoted pieces for variants with
+	// drops and the number of checks given in Three-check.
+	variant  Variant
+	pockets  [2][7]int
+	promoted uint64
+	checks   [2]int
+}
+
+// The state before a move, recorded by `Push()` so that `Pop()` can
+// restore it.
+type boardState struct {
+	move           *Move
+	capturedPiece  PieceTypes
+	enPassant      bool
+	halfMoveClock  int
+	castlingRights int
+	epSquare       int
+
+	// The Zobrist hash and the pieces giving check before the move.
+	zobristHash uint64
+	checkers    uint64
+
+	variant variantState
 }
 
 func NewBitboard(fen string) *Bitboard {
-	result := &Bitboard{}
+	result := &Bitboard{variant: Standard}
 	if fen == "" {
 		result.Reset()
 	} else {
-		result.halfMoveClockStack = new(Stack)
-		result.capturedPieceStack = new(Stack)
-		result.castlingRightStack = new(Stack)
-		result.epSquareStack = new(Stack)
-		result.moveStack = new(Stack)
 		result.transpositions = map[uint64]int{}
 		result.SetFen(fen)
 	}
@@ -77,8 +105,13 @@ func (b *Bitboard) GetTurn() Colors {
 	return b.turn
 }
 
-// Restores the starting position.
+// Restores the starting position of the variant.
 func (b *Bitboard) Reset() {
+	if b.variant != Standard {
+		b.SetFen(b.variant.StartingFen())
+		return
+	}
+
 	b.pawns = BBRank2 | BBRank7
 	b.knights = BBB1 | BBG1 | BBB8 | BBG8
 	b.bishops = BBC1 | BBF1 | BBC8 | BBF8
@@ -89,10 +122,6 @@ func (b *Bitboard) Reset() {
 	b.occupiedCo = [2]uint64{BBRank1 | BBRank2, BBRank7 | BBRank8}
 	b.occupied = BBRank1 | BBRank2 | BBRank7 | BBRank8
 
-	b.occupiedL90 = BBVoid
-	b.occupiedL45 = BBVoid
-	b.occupiedR45 = BBVoid
-
 	b.kingSquares = [2]int{E1, E8}
 	b.pieces = [64]PieceTypes{}
 
@@ -115,25 +144,19 @@ func (b *Bitboard) Reset() {
 
 	b.epSquare = 0
 	b.castlingRights = Castling
+	b.castlingRookFiles = defaultCastlingRookFiles
 	b.turn = White
 	b.fullMoveNumber = 1
 	b.halfMoveClock = 0
 
-	for i := 0; i < 64; i++ {
-		if BBSquares[i]&b.occupied > 0 {
-			b.occupiedL90 |= BBSquaresL90[i]
-			b.occupiedR45 |= BBSquaresR45[i]
-			b.occupiedL45 |= BBSquaresL45[i]
-		}
-	}
-
-	b.halfMoveClockStack = new(Stack)
-	b.capturedPieceStack = new(Stack)
-	b.castlingRightStack = new(Stack)
-	b.epSquareStack = new(Stack)
-	b.moveStack = new(Stack)
+	b.stack = b.stack[:0]
+	b.pockets = [2][7]int{}
+	b.promoted = BBVoid
+	b.checks = [2]int{}
 	b.incrementalZobristHash = b.BoardZobristHash(PolyglotRandomArray)
-	b.transpositions = map[uint64]int{b.ZobristHash(nil): 1}
+	b.resetEval()
+	b.transpositions = map[uint64]int{}
+	b.checkersKnown = false
 }
 
 // Clears the board.
@@ -155,28 +178,49 @@ func (b *Bitboard) Clear() {
 	b.occupiedCo = [2]uint64{BBVoid, BBVoid}
 	b.occupied = BBVoid
 
-	b.occupiedL90 = BBVoid
-	b.occupiedR45 = BBVoid
-	b.occupiedL45 = BBVoid
-
 	b.kingSquares = [2]int{E1, E8}
 	for i := 0; i < 64; i++ {
 		b.pieces[i] = None
 	}
 
-	b.halfMoveClockStack = new(Stack)
-	b.capturedPieceStack = new(Stack)
-	b.castlingRightStack = new(Stack)
-	b.epSquareStack = new(Stack)
-	b.moveStack = new(Stack)
+	b.stack = b.stack[:0]
+	b.pockets = [2][7]int{}
+	b.promoted = BBVoid
+	b.checks = [2]int{}
 
 	b.epSquare = 0
 	b.castlingRights = CastlingNone
+	b.castlingRookFiles = defaultCastlingRookFiles
 	b.turn = White
 	b.fullMoveNumber = 1
 	b.halfMoveClock = 0
 	b.incrementalZobristHash = b.BoardZobristHash(PolyglotRandomArray)
-	b.transpositions = map[uint64]int{b.ZobristHash(nil): 1}
+	b.resetEval()
+	b.transpositions = map[uint64]int{}
+	b.checkersKnown = false
+}
+
+// Gets a copy of the board that can be changed independently.
+//
+// With `withStack` the move stack, the undo information and the counts
+// for repetition detection are copied as well, so that the copy can `Pop()`
+// moves and detect repetitions of earlier positions. Otherwise the copy
+// starts with an empty stack at the current position.
+func (b *Bitboard) Copy(withStack bool) *Bitboard {
+	result := *b
+
+	if withStack {
+		result.stack = append([]boardState(nil), b.stack...)
+		result.transpositions = make(map[uint64]int, len(b.transpositions))
+		for hash, count := range b.transpositions {
+			result.transpositions[hash] = count
+		}
+	} else {
+		result.stack = nil
+		result.transpositions = map[uint64]int{}
+	}
+
+	return &result
 }
 
 // Gets the piece at the given square.
@@ -203,6 +247,24 @@ func (b *Bitboard) PieceTypeAt(square int) PieceTypes {
 	return b.pieces[square]
 }
 
+// Gets the mask of all pieces of the given type, of both colors.
+func (b *Bitboard) pieceMask(pieceType PieceTypes) uint64 {
+	if pieceType == Pawn {
+		return b.pawns
+	} else if pieceType == Knight {
+		return b.knights
+	} else if pieceType == Bishop {
+		return b.bishops
+	} else if pieceType == Rook {
+		return b.rooks
+	} else if pieceType == Queen {
+		return b.queens
+	} else if pieceType == King {
+		return b.kings
+	}
+	return 0
+}
+
 // Removes a piece from the given square if present.
 func (b *Bitboard) RemovePieceAt(square int) {
 	pieceType := b.pieces[square]
@@ -237,9 +299,8 @@ func (b *Bitboard) RemovePieceAt(square int) {
 	b.pieces[square] = None
 	b.occupied ^= mask
 	b.occupiedCo[color] ^= mask
-	b.occupiedL90 ^= BBSquares[SquaresL90[square]]
-	b.occupiedR45 ^= BBSquares[SquaresR45[square]]
-	b.occupiedL45 ^= BBSquares[SquaresL45[square]]
+	b.checkersKnown = false
+	b.updateEval(pieceType, color, square, -1)
 
 	// Update incremental zobrist hash.
 	pieceIndex := (int(pieceType)-1)*2 + 1
@@ -275,9 +336,8 @@ func (b *Bitboard) SetPieceAt(square int, piece *Piece) {
 
 	b.occupied ^= mask
 	b.occupiedCo[piece.color] ^= mask
-	b.occupiedL90 ^= BBSquares[SquaresL90[square]]
-	b.occupiedR45 ^= BBSquares[SquaresR45[square]]
-	b.occupiedL45 ^= BBSquares[SquaresL45[square]]
+	b.checkersKnown = false
+	b.updateEval(piece.pieceType, piece.color, square, 1)
 
 	// Update incremental zorbist hash.
 	pieceIndex := (int(piece.pieceType)-1)*2 + 1
@@ -302,180 +362,177 @@ func debugPrintBoard(board uint64) {
 	fmt.Printf("\n")
 }
 
-func (b *Bitboard) GeneratePseudoLegalMoves(castling, pawns, knights, bishops, rooks, queens, king bool) []*Move {
-	result := []*Move{}
-	if b.turn == White {
-		if castling {
-			// Castling short.
-			if (b.castlingRights&CastlingWhiteKingSide > 0) && ((BBF1|BBG1)&b.occupied) == 0 {
-				if !b.IsAttackedBy(Black, E1) && !b.IsAttackedBy(Black, F1) && !b.IsAttackedBy(Black, G1) {
-					result = append(result, NewMove(E1, G1, None))
-				}
-			}
-
-			// Castling long.
-			if (b.castlingRights&CastlingWhiteQueenSide > 0) && ((BBB1|BBC1|BBD1)&b.occupied) == 0 {
-				if !b.IsAttackedBy(Black, C1) && !b.IsAttackedBy(Black, D1) && !b.IsAttackedBy(Black, E1) {
-					result = append(result, NewMove(E1, C1, None))
-				}
+// Generates pseudo legal moves of the given kinds and appends them to the
+// buffer. Unlike `GeneratePseudoLegalMoves()` this does not allocate, once
+// the buffer has grown large enough.
+func (b *Bitboard) GenerateMovesInto(buf *MoveList, filter MoveFilter) {
+	castling := filter&GenerateCastling != 0
+	pawns := filter&GeneratePawns != 0
+	knights := filter&GenerateKnights != 0
+	bishops := filter&GenerateBishops != 0
+	rooks := filter&GenerateRooks != 0
+	queens := filter&GenerateQueens != 0
+	king := filter&GenerateKing != 0
+	kingPromotion := b.variant.kingPromotion()
+
+	if castling {
+		// Castling short and long.
+		for side := kingSide; side <= queenSide; side++ {
+			if b.canCastle(b.turn, side) {
+				buf.add(b.kingSquares[b.turn], b.castlingTarget(b.turn, side), None)
 			}
 		}
+	}
 
+	if b.turn == White {
 		if pawns {
 			// En-passant moves.
 			movers := b.pawns & b.occupiedCo[White]
 			if b.epSquare > 0 {
 				moves := BBPawnAttacks[Black][b.epSquare] & movers
 
-				fromSquare := bitScan(moves, 0)
-				for fromSquare != -1 {
-					result = append(result, NewMove(fromSquare, b.epSquare, None))
-					fromSquare = bitScan(moves, fromSquare+1)
+				for fromSquares := moves; fromSquares != 0; fromSquares &= fromSquares - 1 {
+					fromSquare := lsb(fromSquares)
+					buf.add(fromSquare, b.epSquare, None)
 				}
 			}
 
 			// Pawn captures.
 			moves := shiftUpRight(movers) & b.occupiedCo[Black]
-			toSquare := bitScan(moves, 0)
-			for toSquare != -1 {
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare - 9
 				if rankIndex(toSquare) != 7 {
-					result = append(result, NewMove(fromSquare, toSquare, None))
+					buf.add(fromSquare, toSquare, None)
 				} else {
-					result = append(result, NewMove(fromSquare, toSquare, Queen))
-					result = append(result, NewMove(fromSquare, toSquare, Knight))
-					result = append(result, NewMove(fromSquare, toSquare, Rook))
-					result = append(result, NewMove(fromSquare, toSquare, Bishop))
+					buf.add(fromSquare, toSquare, Queen)
+					buf.add(fromSquare, toSquare, Knight)
+					buf.add(fromSquare, toSquare, Rook)
+					buf.add(fromSquare, toSquare, Bishop)
+					if kingPromotion {
+						buf.add(fromSquare, toSquare, King)
+					}
 				}
-				toSquare = bitScan(moves, toSquare+1)
 			}
 
 			moves = shiftUpLeft(movers) & b.occupiedCo[Black]
-			toSquare = bitScan(moves, 0)
-			for toSquare != -1 {
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare - 7
 				if rankIndex(toSquare) != 7 {
-					result = append(result, NewMove(fromSquare, toSquare, None))
+					buf.add(fromSquare, toSquare, None)
 				} else {
-					result = append(result, NewMove(fromSquare, toSquare, Queen))
-					result = append(result, NewMove(fromSquare, toSquare, Knight))
-					result = append(result, NewMove(fromSquare, toSquare, Rook))
-					result = append(result, NewMove(fromSquare, toSquare, Bishop))
+					buf.add(fromSquare, toSquare, Queen)
+					buf.add(fromSquare, toSquare, Knight)
+					buf.add(fromSquare, toSquare, Rook)
+					buf.add(fromSquare, toSquare, Bishop)
+					if kingPromotion {
+						buf.add(fromSquare, toSquare, King)
+					}
 				}
-				toSquare = bitScan(moves, toSquare+1)
 			}
 
 			// Pawns one forward.
 			moves = shiftUp(movers) & ^b.occupied
 			movers = moves
-			toSquare = bitScan(moves, 0)
-			for toSquare != -1 {
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare - 8
 				if rankIndex(toSquare) != 7 {
-					result = append(result, NewMove(fromSquare, toSquare, None))
+					buf.add(fromSquare, toSquare, None)
 				} else {
-					result = append(result, NewMove(fromSquare, toSquare, Queen))
-					result = append(result, NewMove(fromSquare, toSquare, Knight))
-					result = append(result, NewMove(fromSquare, toSquare, Rook))
-					result = append(result, NewMove(fromSquare, toSquare, Bishop))
+					buf.add(fromSquare, toSquare, Queen)
+					buf.add(fromSquare, toSquare, Knight)
+					buf.add(fromSquare, toSquare, Rook)
+					buf.add(fromSquare, toSquare, Bishop)
+					if kingPromotion {
+						buf.add(fromSquare, toSquare, King)
+					}
 				}
-				toSquare = bitScan(moves, toSquare+1)
 			}
 
-			// Pawns two forward.
-			moves = shiftUp(movers) & BBRank4 & ^b.occupied
-			toSquare = bitScan(moves, 0)
-			for toSquare != -1 {
+			// Pawns two forward. In Horde pawns on the first rank can
+			// move two squares as well.
+			moves = shiftUp(movers) & (BBRank3 | BBRank4) & ^b.occupied
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare - 16
-				result = append(result, NewMove(fromSquare, toSquare, None))
-				toSquare = bitScan(moves, toSquare+1)
+				buf.add(fromSquare, toSquare, None)
 			}
 		}
 	} else {
-		if castling {
-			// Castling short.
-			if (b.castlingRights&CastlingBlackKingSide > 0) && ((BBF8|BBG8)&b.occupied) == 0 {
-				if !b.IsAttackedBy(White, E8) && !b.IsAttackedBy(White, F8) && !b.IsAttackedBy(White, G8) {
-					result = append(result, NewMove(E8, G8, None))
-				}
-			}
-
-			// Castling long.
-			if (b.castlingRights&CastlingBlackQueenSide > 0) && ((BBB8|BBC8|BBD8)&b.occupied) == 0 {
-				if !b.IsAttackedBy(White, C8) && !b.IsAttackedBy(White, D8) && !b.IsAttackedBy(White, E8) {
-					result = append(result, NewMove(E8, C8, None))
-				}
-			}
-		}
-
 		if pawns {
 			// En-passant moves.
 			movers := b.pawns & b.occupiedCo[Black]
 			if b.epSquare > 0 {
 				moves := BBPawnAttacks[White][b.epSquare] & movers
 
-				fromSquare := bitScan(moves, 0)
-				for fromSquare != -1 {
-					result = append(result, NewMove(fromSquare, b.epSquare, None))
-					fromSquare = bitScan(moves, fromSquare+1)
+				for fromSquares := moves; fromSquares != 0; fromSquares &= fromSquares - 1 {
+					fromSquare := lsb(fromSquares)
+					buf.add(fromSquare, b.epSquare, None)
 				}
 			}
 
 			// Pawn captures.
 			moves := shiftDownLeft(movers) & b.occupiedCo[White]
-			toSquare := bitScan(moves, 0)
-			for toSquare != -1 {
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare + 9
 				if rankIndex(toSquare) != 0 {
-					result = append(result, NewMove(fromSquare, toSquare, None))
+					buf.add(fromSquare, toSquare, None)
 				} else {
-					result = append(result, NewMove(fromSquare, toSquare, Queen))
-					result = append(result, NewMove(fromSquare, toSquare, Knight))
-					result = append(result, NewMove(fromSquare, toSquare, Rook))
-					result = append(result, NewMove(fromSquare, toSquare, Bishop))
+					buf.add(fromSquare, toSquare, Queen)
+					buf.add(fromSquare, toSquare, Knight)
+					buf.add(fromSquare, toSquare, Rook)
+					buf.add(fromSquare, toSquare, Bishop)
+					if kingPromotion {
+						buf.add(fromSquare, toSquare, King)
+					}
 				}
-				toSquare = bitScan(moves, toSquare+1)
 			}
 
 			moves = shiftDownRight(movers) & b.occupiedCo[White]
-			toSquare = bitScan(moves, 0)
-			for toSquare != -1 {
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare + 7
 				if rankIndex(toSquare) != 0 {
-					result = append(result, NewMove(fromSquare, toSquare, None))
+					buf.add(fromSquare, toSquare, None)
 				} else {
-					result = append(result, NewMove(fromSquare, toSquare, Queen))
-					result = append(result, NewMove(fromSquare, toSquare, Knight))
-					result = append(result, NewMove(fromSquare, toSquare, Rook))
-					result = append(result, NewMove(fromSquare, toSquare, Bishop))
+					buf.add(fromSquare, toSquare, Queen)
+					buf.add(fromSquare, toSquare, Knight)
+					buf.add(fromSquare, toSquare, Rook)
+					buf.add(fromSquare, toSquare, Bishop)
+					if kingPromotion {
+						buf.add(fromSquare, toSquare, King)
+					}
 				}
-				toSquare = bitScan(moves, toSquare+1)
 			}
 
 			// Pawns one forward.
 			moves = shiftDown(movers) & ^b.occupied
 			movers = moves
-			toSquare = bitScan(moves, 0)
-			for toSquare != -1 {
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare + 8
 				if rankIndex(toSquare) != 0 {
-					result = append(result, NewMove(fromSquare, toSquare, None))
+					buf.add(fromSquare, toSquare, None)
 				} else {
-					result = append(result, NewMove(fromSquare, toSquare, Queen))
-					result = append(result, NewMove(fromSquare, toSquare, Knight))
-					result = append(result, NewMove(fromSquare, toSquare, Rook))
-					result = append(result, NewMove(fromSquare, toSquare, Bishop))
+					buf.add(fromSquare, toSquare, Queen)
+					buf.add(fromSquare, toSquare, Knight)
+					buf.add(fromSquare, toSquare, Rook)
+					buf.add(fromSquare, toSquare, Bishop)
+					if kingPromotion {
+						buf.add(fromSquare, toSquare, King)
+					}
 				}
-				toSquare = bitScan(moves, toSquare+1)
 			}
 
 			// Pawns two forward.
-			moves = shiftDown(movers) & BBRank5 & ^b.occupied
-			toSquare = bitScan(moves, 0)
-			for toSquare != -1 {
+			moves = shiftDown(movers) & (BBRank5 | BBRank6) & ^b.occupied
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
 				fromSquare := toSquare + 16
-				result = append(result, NewMove(fromSquare, toSquare, None))
-				toSquare = bitScan(moves, toSquare+1)
+				buf.add(fromSquare, toSquare, None)
 			}
 		}
 	}
@@ -483,95 +540,124 @@ func (b *Bitboard) GeneratePseudoLegalMoves(castling, pawns, knights, bishops, r
 	if knights {
 		// Knight moves.
 		movers := b.knights & b.occupiedCo[b.turn]
-		fromSquare := bitScan(movers, 0)
-		for fromSquare != -1 {
+		for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+			fromSquare := lsb(fromSquares)
 			moves := b.KnightAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
-			toSquare := bitScan(moves, 0)
-			for toSquare != -1 {
-				result = append(result, NewMove(fromSquare, toSquare, None))
-				toSquare = bitScan(moves, toSquare+1)
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
+				buf.add(fromSquare, toSquare, None)
 			}
-			fromSquare = bitScan(movers, fromSquare+1)
 		}
 	}
 
 	if bishops {
 		// Bishop moves.
 		movers := b.bishops & b.occupiedCo[b.turn]
-		fromSquare := bitScan(movers, 0)
-		for fromSquare != -1 {
+		for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+			fromSquare := lsb(fromSquares)
 			moves := b.BishopAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
-			toSquare := bitScan(moves, 0)
-			for toSquare != -1 {
-				result = append(result, NewMove(fromSquare, toSquare, None))
-				toSquare = bitScan(moves, toSquare+1)
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
+				buf.add(fromSquare, toSquare, None)
 			}
-			fromSquare = bitScan(movers, fromSquare+1)
 		}
 	}
 
 	if rooks {
 		// Rook moves.
 		movers := b.rooks & b.occupiedCo[b.turn]
-		fromSquare := bitScan(movers, 0)
-		for fromSquare != -1 {
+		for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+			fromSquare := lsb(fromSquares)
 			moves := b.RookAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
-			toSquare := bitScan(moves, 0)
-			for toSquare != -1 {
-				result = append(result, NewMove(fromSquare, toSquare, None))
-				toSquare = bitScan(moves, toSquare+1)
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
+				buf.add(fromSquare, toSquare, None)
 			}
-			fromSquare = bitScan(movers, fromSquare+1)
 		}
 	}
 
 	if queens {
 		// Queen moves.
 		movers := b.queens & b.occupiedCo[b.turn]
-		fromSquare := bitScan(movers, 0)
-		for fromSquare != -1 {
+		for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+			fromSquare := lsb(fromSquares)
 			moves := b.QueenAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
-			toSquare := bitScan(moves, 0)
-			for toSquare != -1 {
-				result = append(result, NewMove(fromSquare, toSquare, None))
-				toSquare = bitScan(moves, toSquare+1)
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
+				buf.add(fromSquare, toSquare, None)
 			}
-			fromSquare = bitScan(movers, fromSquare+1)
 		}
 	}
 
 	if king {
-		// King moves.
-		fromSquare := b.kingSquares[b.turn]
-		moves := b.KingAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
-		toSquare := bitScan(moves, 0)
-		for toSquare != -1 {
-			result = append(result, NewMove(fromSquare, toSquare, None))
-			toSquare = bitScan(moves, toSquare+1)
+		// King moves. In some variants there can be no king or more than
+		// one.
+		movers := b.kings & b.occupiedCo[b.turn]
+		for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+			fromSquare := lsb(fromSquares)
+			moves := b.KingAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
+			for toSquares := moves; toSquares != 0; toSquares &= toSquares - 1 {
+				toSquare := lsb(toSquares)
+				buf.add(fromSquare, toSquare, None)
+			}
 		}
 	}
 
-	return result
+	// Drops from the pocket.
+	if b.variant.HasDrops() {
+		b.generateDrops(buf, filter)
+	}
+
+}
+
+func (b *Bitboard) GeneratePseudoLegalMoves(castling, pawns, knights, bishops, rooks, queens, king bool) []*Move {
+	filter := MoveFilter(0)
+	if castling {
+		filter |= GenerateCastling
+	}
+	if pawns {
+		filter |= GeneratePawns
+	}
+	if knights {
+		filter |= GenerateKnights
+	}
+	if bishops {
+		filter |= GenerateBishops
+	}
+	if rooks {
+		filter |= GenerateRooks
+	}
+	if queens {
+		filter |= GenerateQueens
+	}
+	if king {
+		filter |= GenerateKing
+	}
+
+	buf := NewMoveList(64)
+	b.GenerateMovesInto(buf, filter)
+	return buf.Moves()
 }
 
 // In a way duplicates GeneratePseudoLegalMoves() in order to use
 // population counts instead of counting actually yielded moves.
 func (b *Bitboard) PseudoLegalMoveCount() int {
 	count := 0
-	if b.turn == White {
-		// Castling short.
-		if (b.castlingRights&CastlingWhiteKingSide > 0) && ((BBF1|BBG1)&b.occupied) == 0 {
-			if !b.IsAttackedBy(Black, E1) && !b.IsAttackedBy(Black, F1) && !b.IsAttackedBy(Black, G1) {
-				count++
-			}
-		}
 
-		// Castling long.
-		if (b.castlingRights&CastlingWhiteQueenSide > 0) && ((BBB1|BBC1|BBD1)&b.occupied) == 0 {
-			if !b.IsAttackedBy(Black, C1) && !b.IsAttackedBy(Black, D1) && !b.IsAttackedBy(Black, E1) {
-				count++
-			}
+	// Each promotion adds three more moves, or four with king promotions.
+	promotions := 3
+	if b.variant.kingPromotion() {
+		promotions = 4
+	}
+
+	// Castling short and long.
+	for side := kingSide; side <= queenSide; side++ {
+		if b.canCastle(b.turn, side) {
+			count++
 		}
+	}
+
+	if b.turn == White {
 		// En-passant moves.
 		movers := b.pawns & b.occupiedCo[White]
 		if b.epSquare > 0 {
@@ -581,36 +667,23 @@ func (b *Bitboard) PseudoLegalMoveCount() int {
 
 		// Pawn captures.
 		moves := shiftUpRight(movers) & b.occupiedCo[Black]
-		count += popCount(moves&BBRank8) * 3
+		count += popCount(moves&BBRank8) * promotions
 		count += popCount(moves)
 
 		moves = shiftUpLeft(movers) & b.occupiedCo[Black]
-		count += popCount(moves&BBRank8) * 3
+		count += popCount(moves&BBRank8) * promotions
 		count += popCount(moves)
 
 		// Pawns one forward.
 		moves = shiftUp(movers) & ^b.occupied
 		movers = moves
-		count += popCount(moves&BBRank8) * 3
+		count += popCount(moves&BBRank8) * promotions
 		count += popCount(moves)
 
 		// Pawns two forward.
-		moves = shiftUp(movers) & BBRank4 & ^b.occupied
+		moves = shiftUp(movers) & (BBRank3 | BBRank4) & ^b.occupied
 		count += popCount(moves)
 	} else {
-		// Castling short.
-		if (b.castlingRights&CastlingBlackKingSide > 0) && ((BBF8|BBG8)&b.occupied) == 0 {
-			if !b.IsAttackedBy(White, E8) && !b.IsAttackedBy(White, F8) && !b.IsAttackedBy(White, G8) {
-				count++
-			}
-		}
-
-		// Castling long.
-		if (b.castlingRights&CastlingBlackQueenSide > 0) && ((BBB8|BBC8|BBD8)&b.occupied) == 0 {
-			if !b.IsAttackedBy(White, C8) && !b.IsAttackedBy(White, D8) && !b.IsAttackedBy(White, E8) {
-				count++
-			}
-		}
 		// En-passant moves.
 		movers := b.pawns & b.occupiedCo[Black]
 		if b.epSquare > 0 {
@@ -620,63 +693,68 @@ func (b *Bitboard) PseudoLegalMoveCount() int {
 
 		// Pawn captures.
 		moves := shiftDownLeft(movers) & b.occupiedCo[White]
-		count += popCount(moves&BBRank1) * 3
+		count += popCount(moves&BBRank1) * promotions
 		count += popCount(moves)
 
 		moves = shiftDownRight(movers) & b.occupiedCo[White]
-		count += popCount(moves&BBRank1) * 3
+		count += popCount(moves&BBRank1) * promotions
 		count += popCount(moves)
 
 		// Pawns one forward.
 		moves = shiftDown(movers) & ^b.occupied
 		movers = moves
-		count += popCount(moves&BBRank1) * 3
+		count += popCount(moves&BBRank1) * promotions
+		count += popCount(moves)
 
 		// Pawns two forward.
-		moves = shiftDown(movers) & BBRank5 & ^b.occupied
+		moves = shiftDown(movers) & (BBRank5 | BBRank6) & ^b.occupied
 		count += popCount(moves)
 	}
 
 	// Knight moves.
 	movers := b.knights & b.occupiedCo[b.turn]
-	fromSquare := bitScan(movers, 0)
-	for fromSquare != -1 {
+	for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+		fromSquare := lsb(fromSquares)
 		moves := b.KnightAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
 		count += popCount(moves)
-		fromSquare = bitScan(movers, fromSquare+1)
 	}
 
 	// Bishop moves.
 	movers = b.bishops & b.occupiedCo[b.turn]
-	fromSquare = bitScan(movers, 0)
-	for fromSquare != -1 {
+	for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+		fromSquare := lsb(fromSquares)
 		moves := b.BishopAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
 		count += popCount(moves)
-		fromSquare = bitScan(movers, fromSquare+1)
 	}
 
 	// Rook moves.
 	movers = b.rooks & b.occupiedCo[b.turn]
-	fromSquare = bitScan(movers, 0)
-	for fromSquare != -1 {
+	for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+		fromSquare := lsb(fromSquares)
 		moves := b.RookAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
 		count += popCount(moves)
-		fromSquare = bitScan(movers, fromSquare+1)
 	}
 
 	// Queen moves.
 	movers = b.queens & b.occupiedCo[b.turn]
-	fromSquare = bitScan(movers, 0)
-	for fromSquare != -1 {
+	for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+		fromSquare := lsb(fromSquares)
 		moves := b.QueenAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
 		count += popCount(moves)
-		fromSquare = bitScan(movers, fromSquare+1)
 	}
 
 	// King moves.
-	fromSquare = b.kingSquares[b.turn]
-	moves := b.KingAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
-	count += popCount(moves)
+	movers = b.kings & b.occupiedCo[b.turn]
+	for fromSquares := movers; fromSquares != 0; fromSquares &= fromSquares - 1 {
+		fromSquare := lsb(fromSquares)
+		moves := b.KingAttacksFrom(fromSquare) & ^b.occupiedCo[b.turn]
+		count += popCount(moves)
+	}
+
+	// Drops from the pocket.
+	if b.variant.HasDrops() {
+		count += b.dropCount()
+	}
 
 	return count
 }
@@ -684,6 +762,12 @@ func (b *Bitboard) PseudoLegalMoveCount() int {
 // Checks if the given side attacks the given square. Pinned pieces still
 // count as attackers.
 func (b *Bitboard) IsAttackedBy(color Colors, square int) bool {
+	return b.isAttackedThrough(color, square, b.occupied)
+}
+
+// Like `IsAttackedBy()`, but sliding pieces are blocked by the given
+// occupied squares instead of the pieces on the board.
+func (b *Bitboard) isAttackedThrough(color Colors, square int, occupied uint64) bool {
 	if (BBPawnAttacks[color^1][square] & (b.pawns | b.bishops) & b.occupiedCo[color]) > 0 {
 		return true
 	}
@@ -692,11 +776,11 @@ func (b *Bitboard) IsAttackedBy(color Colors, square int) bool {
 		return true
 	}
 
-	if b.BishopAttacksFrom(square)&(b.bishops|b.queens)&b.occupiedCo[color] > 0 {
+	if bishopAttacks(square, occupied)&(b.bishops|b.queens)&b.occupiedCo[color] > 0 {
 		return true
 	}
 
-	if b.RookAttacksFrom(square)&(b.rooks|b.queens)&b.occupiedCo[color] > 0 {
+	if rookAttacks(square, occupied)&(b.rooks|b.queens)&b.occupiedCo[color] > 0 {
 		return true
 	}
 
@@ -723,9 +807,73 @@ func (b *Bitboard) Attackers(color Colors, square int) *SquareSet {
 	return NewSquareSet(b.AttackerMask(color, square))
 }
 
+// Gets the sliding pieces of the given color that attack the given square
+// through exactly one other piece of either color. They would attack the
+// square if that piece moved away.
+//
+// Returns a set of squares.
+func (b *Bitboard) XRayAttackers(color Colors, square int) *SquareSet {
+	diagonal := b.BishopAttacksFrom(square)
+	straight := b.RookAttacksFrom(square)
+
+	// Look through the first piece in each direction.
+	occupied := b.occupied &^ (diagonal | straight)
+	xrays := bishopAttacks(square, occupied) &^ diagonal & (b.bishops | b.queens)
+	xrays |= rookAttacks(square, occupied) &^ straight & (b.rooks | b.queens)
+
+	return NewSquareSet(xrays & b.occupiedCo[color])
+}
+
+// Gets the pieces giving check to the side to move.
+//
+// Returns a set of squares.
+func (b *Bitboard) Checkers() *SquareSet {
+	return NewSquareSet(b.checkersMask())
+}
+
+// Gets the pieces of the given color that are pinned to their king. They
+// may only move along the line between the king and the pinning piece.
+//
+// Returns a set of squares.
+func (b *Bitboard) Pinned(color Colors) *SquareSet {
+	pinned := BBVoid
+	for squares := b.occupiedCo[color] &^ b.kings; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		if b.PinMask(color, square) != BBAll {
+			pinned |= BBSquares[square]
+		}
+	}
+	return NewSquareSet(pinned)
+}
+
+// Gets the squares a piece of the given color on the given square can move
+// to without exposing its king: the squares between the king and the
+// pinning piece, and the pinning piece itself.
+//
+// Returns `BBAll` if the piece is not pinned.
+func (b *Bitboard) PinMask(color Colors, square int) uint64 {
+	kings := b.kings & b.occupiedCo[color]
+	if kings == 0 || b.occupiedCo[color]&BBSquares[square] == 0 {
+		return BBAll
+	}
+	king := lsb(kings)
+
+	snipers := bishopAttacks(king, BBVoid) & (b.bishops | b.queens)
+	snipers |= rookAttacks(king, BBVoid) & (b.rooks | b.queens)
+	for snipers &= b.occupiedCo[color^1]; snipers != 0; snipers &= snipers - 1 {
+		sniper := lsb(snipers)
+		ray := BBBetween[king][sniper]
+		if ray&b.occupied == BBSquares[square] {
+			return ray | BBSquares[sniper]
+		}
+	}
+
+	return BBAll
+}
+
 // Checks if the current side to move is in check.
 func (b *Bitboard) IsCheck() bool {
-	return b.IsAttackedBy(b.turn^1, b.kingSquares[b.turn])
+	return b.variant.isCheck(b)
 }
 
 func (b *Bitboard) PawnMovesFrom(square int) uint64 {
@@ -753,13 +901,11 @@ func (b *Bitboard) KingAttacksFrom(square int) uint64 {
 }
 
 func (b *Bitboard) RookAttacksFrom(square int) uint64 {
-	return (BBRankAttacks[square][(b.occupied>>((uint(square) & ^uint(7))+1))&63] |
-		BBFileAttacks[square][(b.occupiedL90>>(((uint(square)&7)<<3)+1))&63])
+	return rookAttacks(square, b.occupied)
 }
 
 func (b *Bitboard) BishopAttacksFrom(square int) uint64 {
-	return (BBR45Attacks[square][(b.occupiedR45>>BBShiftR45[square])&63] |
-		BBL45Attacks[square][(b.occupiedL45>>BBShiftL45[square])&63])
+	return bishopAttacks(square, b.occupied)
 }
 
 func (b *Bitboard) QueenAttacksFrom(square int) uint64 {
@@ -776,15 +922,26 @@ func (b *Bitboard) IsIntoCheck(move *Move) bool {
 }
 
 // Checks if the king of the other side is attacked. Such a position is not
-// valid and could only be reached by an illegal move.
+// valid and could only be reached by an illegal move. Some variants forbid
+// other positions as well, for example giving check in Racing Kings.
 func (b *Bitboard) WasIntoCheck() bool {
-	return b.IsAttackedBy(b.turn, b.kingSquares[b.turn^1])
+	return b.variant.wasIntoCheck(b)
 }
 
+// Generates the legal moves. There are none once the game has ended by the
+// special rules of a variant.
 func (b *Bitboard) GenerateLegalMoves(castling, pawns, knights, bishops, rooks, queens, kings bool) []*Move {
 	result := []*Move{}
+	if b.IsVariantEnd() {
+		return result
+	}
+
 	pseudo := b.GeneratePseudoLegalMoves(castling, pawns, knights, bishops, rooks, queens, kings)
+	forcedCapture := b.variant.capturesCompulsory() && b.canCapture()
 	for _, move := range pseudo {
+		if forcedCapture && !b.IsCapture(move) {
+			continue
+		}
 		if !b.IsIntoCheck(move) {
 			result = append(result, move)
 		}
@@ -793,12 +950,171 @@ func (b *Bitboard) GenerateLegalMoves(castling, pawns, knights, bishops, rooks,
 	return result
 }
 
+// Gets the index of the backrank of the given color.
+func backrank(color Colors) int {
+	if color == White {
+		return 0
+	}
+	return 7
+}
+
+// Gets the target squares of king and rook when castling to the given
+// side. These are the same in standard chess and in Chess960.
+func castlingTargets(color Colors, side int) (kingTo, rookTo int) {
+	rank := backrank(color) * 8
+	if side == kingSide {
+		return rank + 6, rank + 5
+	}
+	return rank + 2, rank + 3
+}
+
+// Gets the square of the rook used for castling to the given side.
+func (b *Bitboard) castlingRookSquare(color Colors, side int) int {
+	return backrank(color)*8 + b.castlingRookFiles[color][side]
+}
+
+// Gets the target square of a castling move: the rook square in Chess960
+// mode, where the king takes its own rook, otherwise the square the king
+// lands on.
+func (b *Bitboard) castlingTarget(color Colors, side int) int {
+	if b.chess960 {
+		return b.castlingRookSquare(color, side)
+	}
+	kingTo, _ := castlingTargets(color, side)
+	return kingTo
+}
+
+// Gets the castling move to the given side in the encoding of the board.
+func (b *Bitboard) castlingMove(color Colors, side int) *Move {
+	return NewMove(b.kingSquares[color], b.castlingTarget(color, side), None)
+}
+
+// Checks if the given color has the right to castle to the given side and
+// the castling is pseudo legal: all squares king and rook pass or land on
+// are empty and the king does not castle out of or through check.
+//
+// Castling into check is left to the legality check, because in Chess960
+// the castling rook can be the piece that shields the king's target square.
+func (b *Bitboard) canCastle(color Colors, side int) bool {
+	if b.castlingRights&castlingFlags[color][side] == 0 {
+		return false
+	}
+
+	kingSquare := b.kingSquares[color]
+	rookSquare := b.castlingRookSquare(color, side)
+	if BBSquares[kingSquare]&b.kings&b.occupiedCo[color] == 0 || rankIndex(kingSquare) != backrank(color) {
+		return false
+	}
+	if BBSquares[rookSquare]&b.rooks&b.occupiedCo[color] == 0 {
+		return false
+	}
+	if (side == kingSide) != (rookSquare > kingSquare) {
+		return false
+	}
+
+	kingTo, rookTo := castlingTargets(color, side)
+	kingPath := BBBetween[kingSquare][kingTo] | BBSquares[kingTo]
+	rookPath := BBBetween[rookSquare][rookTo] | BBSquares[rookTo]
+	if (kingPath|rookPath) & ^BBSquares[kingSquare] & ^BBSquares[rookSquare] & b.occupied > 0 {
+		return false
+	}
+
+	// In Atomic the kings can stand next to each other, so squares next to
+	// the opposing king are safe.
+	kingPath |= BBSquares[kingSquare]
+	if b.variant == Atomic && b.kings&b.occupiedCo[color^1] > 0 {
+		kingPath &= ^BBKingAttacks[b.kingSquares[color^1]]
+	}
+
+	// The king and the rook leave their squares, so they do not block
+	// sliders. Otherwise a slider behind the rook could attack the
+	// destination of the king through it.
+	occupied := b.occupied &^ BBSquares[kingSquare] &^ BBSquares[rookSquare]
+	for squares := kingPath; squares != 0; squares &= squares - 1 {
+		if b.isAttackedThrough(color^1, lsb(squares), occupied) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Gets the castling side of a king move in the current position, or -1 if
+// the move is not castling. Both the king takes rook encoding and the two
+// square king move of standard chess are understood.
+func (b *Bitboard) castlingSide(move *Move) int {
+	if move == nil || b.pieces[move.fromSquare] != King {
+		return -1
+	}
+
+	color := b.CheckSquareColor(move.fromSquare)
+	if side := b.kingTakesRookSide(move, color); side != -1 {
+		return side
+	}
+	return twoSquareCastlingSide(move, color)
+}
+
+// Like `castlingSide()`, but for the last move after it has been made.
+// Expects the castling rights to be restored already.
+func (b *Bitboard) poppedCastlingSide(move *Move) int {
+	color := b.turn ^ 1
+	if side := b.kingTakesRookSide(move, color); side != -1 {
+		return side
+	}
+	if b.pieces[move.toSquare] == King && b.kingSquares[color] == move.toSquare {
+		return twoSquareCastlingSide(move, color)
+	}
+	return -1
+}
+
+// Gets the castling side if the move goes to the square of a castling rook
+// of the same color. Only the king can do that.
+func (b *Bitboard) kingTakesRookSide(move *Move, color Colors) int {
+	if rankIndex(move.fromSquare) != backrank(color) {
+		return -1
+	}
+	for side := kingSide; side <= queenSide; side++ {
+		if b.castlingRights&castlingFlags[color][side] > 0 && move.toSquare == b.castlingRookSquare(color, side) {
+			return side
+		}
+	}
+	return -1
+}
+
+// Gets the castling side of a king move to the g-file or the c-file. Kings
+// move two or more squares only when castling.
+func twoSquareCastlingSide(move *Move, color Colors) int {
+	if rankIndex(move.fromSquare) != backrank(color) {
+		return -1
+	}
+	diff := fileIndex(move.toSquare) - fileIndex(move.fromSquare)
+	if kingTo, _ := castlingTargets(color, kingSide); move.toSquare == kingTo && diff >= 2 {
+		return kingSide
+	}
+	if kingTo, _ := castlingTargets(color, queenSide); move.toSquare == kingTo && diff <= -2 {
+		return queenSide
+	}
+	return -1
+}
+
 func (b *Bitboard) IsPseudoLegal(move *Move) bool {
 	// Null moves are not pseudo legal.
 	if move == nil {
 		return false
 	}
 
+	// Drops need a piece in the pocket and an empty target square. Pawns
+	// can not be dropped on the backranks.
+	if move.drop != None {
+		if b.pockets[b.turn][move.drop] == 0 || move.drop == King || move.promotion != None {
+			return false
+		}
+		if move.fromSquare != move.toSquare || b.occupied&BBSquares[move.toSquare] > 0 {
+			return false
+		}
+		return move.drop != Pawn || BBSquares[move.toSquare]&(BBRank1|BBRank8) == 0
+	}
+
 	// Source square must not be vacant.
 	piece := b.PieceTypeAt(move.fromSquare)
 	if piece == None {
@@ -814,14 +1130,26 @@ func (b *Bitboard) IsPseudoLegal(move *Move) bool {
 		return false
 	}
 
+	// Castling. Just like in move generation the king may not castle
+	// out of or through check. In Chess960 the king captures its own rook.
+	if piece == King && move.promotion == None {
+		if side := b.castlingSide(move); side != -1 {
+			return move.toSquare == b.castlingTarget(b.turn, side) && b.canCastle(b.turn, side)
+		}
+	}
+
 	// Destination square can not be occupied.
 	if (b.occupiedCo[b.turn] & toMask) > 0 {
 		return false
 	}
 
-	// Only pawns can promote and only on the backrank.
+	// Only pawns can promote and only on the backrank. Promoting to a king
+	// depends on the variant.
 	if move.promotion > None {
-		if piece != Pawn {
+		if piece != Pawn || move.promotion == Pawn {
+			return false
+		}
+		if move.promotion == King && !b.variant.kingPromotion() {
 			return false
 		}
 
@@ -834,21 +1162,6 @@ func (b *Bitboard) IsPseudoLegal(move *Move) bool {
 
 	// Handle moves by piece type.
 	if piece == King {
-		// Castling.
-		if b.turn == White && move.fromSquare == E1 {
-			if move.toSquare == G1 && b.castlingRights&CastlingWhiteKingSide > 0 && (BBF1|BBG1)&b.occupied == 0 {
-				return true
-			} else if move.toSquare == C1 && b.castlingRights&CastlingWhiteQueenSide > 0 && (BBB1|BBC1|BBD1)&b.occupied == 0 {
-				return true
-			}
-		} else if b.turn == Black && move.fromSquare == E8 {
-			if move.toSquare == G8 && b.castlingRights&CastlingBlackKingSide > 0 && (BBF8|BBG8)&b.occupied == 0 {
-				return true
-			} else if move.toSquare == C8 && b.castlingRights&CastlingBlackQueenSide > 0 && (BBB8|BBC8|BBD8)&b.occupied == 0 {
-				return true
-			}
-		}
-
 		return b.KingAttacksFrom(move.fromSquare)&toMask > 0
 	} else if piece == Pawn {
 		// Require promotion type if on promotion rank.
@@ -876,38 +1189,62 @@ func (b *Bitboard) IsPseudoLegal(move *Move) bool {
 }
 
 func (b *Bitboard) IsLegal(move *Move) bool {
-	return b.IsPseudoLegal(move) && !b.IsIntoCheck(move)
+	return !b.IsVariantEnd() && b.IsPseudoLegal(move) && !b.IsIntoCheck(move) && !b.missesForcedCapture(move)
 }
 
-// Checks if the game is over due to checkmate, stalemate, insufficient
-// mating material, the seventyfive-move rule or fivefold repitition.
-func (b *Bitboard) IsGameOver() bool {
-	// Seventyfive-move rule.
-	if b.halfMoveClock >= 150 {
-		return true
+// Checks if the given move captures a piece, including en-passant
+// captures. Castling and drops are never captures.
+func (b *Bitboard) IsCapture(move *Move) bool {
+	if move == nil || move.drop != None {
+		return false
 	}
 
-	// Insufficient material.
-	if b.IsInsufficientMaterial() {
+	if b.occupiedCo[b.turn^1]&BBSquares[move.toSquare] > 0 {
 		return true
 	}
 
-	// Stalemate or checkmate.
-	if len(b.GenerateLegalMoves(true, true, true, true, true, true, true)) == 0 {
-		return true
+	return b.IsEnPassant(move)
+}
+
+// Checks if the given move is an en-passant capture.
+func (b *Bitboard) IsEnPassant(move *Move) bool {
+	if move == nil || move.drop != None {
+		return false
 	}
 
-	// Fivefold repitition.
-	if b.IsFivefoldRepitition() {
-		return true
+	return b.epSquare != 0 && move.toSquare == b.epSquare && b.pieces[move.fromSquare] == Pawn && b.occupied&BBSquares[move.toSquare] == 0
+}
+
+// Checks if the side to move has a pseudo legal capture.
+func (b *Bitboard) canCapture() bool {
+	for squares := b.occupiedCo[b.turn^1]; squares != 0; squares &= squares - 1 {
+		if b.AttackerMask(b.turn, lsb(squares)) > 0 {
+			return true
+		}
 	}
 
-	return false
+	return b.epSquare != 0 && BBPawnAttacks[b.turn^1][b.epSquare]&b.pawns&b.occupiedCo[b.turn] > 0
+}
+
+// Checks if the move is illegal, because the variant forces captures and
+// there is one.
+func (b *Bitboard) missesForcedCapture(move *Move) bool {
+	return b.variant.capturesCompulsory() && !b.IsCapture(move) && b.canCapture()
+}
+
+// Checks if the game is over due to checkmate, stalemate, insufficient
+// mating material, the seventyfive-move rule, fivefold repitition or the
+// special rules of the variant.
+//
+// Use `Outcome()` to find out how the game ended.
+func (b *Bitboard) IsGameOver() bool {
+	return b.Outcome(false) != nil
 }
 
-// Checks if the current position is a checkmate.
+// Checks if the current position is a checkmate. A game that already
+// ended by the special rules of a variant is not a checkmate.
 func (b *Bitboard) IsCheckmate() bool {
-	if !b.IsCheck() {
+	if !b.IsCheck() || b.IsVariantEnd() {
 		return false
 	}
 
@@ -918,9 +1255,10 @@ func (b *Bitboard) IsCheckmate() bool {
 	return true
 }
 
-// Checks if the current position is a stalemate.
+// Checks if the current position is a stalemate. A game that already
+// ended by the special rules of a variant is not a stalemate.
 func (b *Bitboard) IsStalemate() bool {
-	if b.IsCheck() {
+	if b.IsCheck() || b.IsVariantEnd() {
 		return false
 	}
 
@@ -933,29 +1271,35 @@ func (b *Bitboard) IsStalemate() bool {
 
 // Checks for a draw due to insufficient mating material.
 func (b *Bitboard) IsInsufficientMaterial() bool {
-	// Enough material to mate.
-	if b.pawns > 0 || b.rooks > 0 || b.queens > 0 {
-		return false
-	}
+	return b.variant.isInsufficientMaterial(b)
+}
 
-	// A single knight or a single bishop.
-	if popCount(b.occupied) <= 3 {
-		return true
-	}
+// Checks if the given side lacks the material to win, no matter how the
+// opponent plays. Under FIDE rules a player whose flag falls still draws
+// if the opponent has insufficient material.
+func (b *Bitboard) HasInsufficientMaterial(color Colors) bool {
+	return b.variant.hasInsufficientMaterial(b, color)
+}
 
-	// More than a single knight.
-	if b.knights > 0 {
-		return false
-	}
+// Checks if the game ended by the special rules of the variant, like a
+// king reaching the center in King of the Hill.
+func (b *Bitboard) IsVariantEnd() bool {
+	return b.variant.isVariantEnd(b)
+}
 
-	// All bishops on the same color.
-	if b.bishops&BBDarkSquares == 0 {
-		return true
-	} else if b.bishops&BBLightSquares == 0 {
-		return true
-	}
+// Checks if the side to move won by the special rules of the variant.
+func (b *Bitboard) IsVariantWin() bool {
+	return b.variant.isVariantEnd(b) && b.variant.isVariantWin(b)
+}
 
-	return false
+// Checks if the side to move lost by the special rules of the variant.
+func (b *Bitboard) IsVariantLoss() bool {
+	return b.variant.isVariantEnd(b) && b.variant.isVariantLoss(b)
+}
+
+// Checks if the game is drawn by the special rules of the variant.
+func (b *Bitboard) IsVariantDraw() bool {
+	return b.variant.isVariantEnd(b) && !b.variant.isVariantWin(b) && !b.variant.isVariantLoss(b)
 }
 
 // Since the first of July 2014 a game is automatically drawn (without
@@ -979,33 +1323,19 @@ func (b *Bitboard) IsFivefoldRepitition() bool {
 	zobristHash := b.ZobristHash(nil)
 
 	// A minimum amount of moves must have been played and the position
-	// in question must have appeared at least five times.
-	if b.moveStack.Len() < 16 || b.transpositions[zobristHash] < 5 {
+	// in question must have appeared at least four times before.
+	if len(b.stack) < 16 || b.transpositions[zobristHash] < 4 {
 		return false
 	}
 
-	switchyard := new(Stack)
-
-	for i := 0; i < 4; i++ {
-		// Go back two full moves, each.
-		for j := 0; j < 4; j++ {
-			switchyard.Push(b.Pop())
-		}
-
-		// Check the position was the same before.
-		if b.ZobristHash(nil) != zobristHash {
-			for switchyard.Len() > 0 {
-				b.Push(switchyard.Pop().(*Move))
-			}
-
+	// Check the position was the same two, four, six and eight full moves
+	// before.
+	for i := 1; i <= 4; i++ {
+		if b.stack[len(b.stack)-4*i].zobristHash != zobristHash {
 			return false
 		}
 	}
 
-	for switchyard.Len() > 0 {
-		b.Push(switchyard.Pop().(*Move))
-	}
-
 	return true
 }
 
@@ -1033,16 +1363,24 @@ func (b *Bitboard) CanClaimFiftyMoves() bool {
 // board occured for the third time or if such a repitition is reached
 // with one of the possible legal moves.
 func (b *Bitboard) CanClaimThreefoldRepitition() bool {
+	var moves MoveList
+	b.GenerateMovesInto(&moves, GenerateAll)
+	return b.canClaimThreefoldRepitition(&moves)
+}
+
+// Like `CanClaimThreefoldRepitition()`, with the pseudo legal moves
+// already generated.
+func (b *Bitboard) canClaimThreefoldRepitition(moves *MoveList) bool {
 	// Threefold repition occured.
-	if b.transpositions[b.ZobristHash(nil)] >= 3 {
+	if b.transpositions[b.ZobristHash(nil)] >= 2 {
 		return true
 	}
 
 	// The next legal move is a threefold repitition.
-	for _, move := range b.GeneratePseudoLegalMoves(true, true, true, true, true, true, true) {
-		b.Push(move)
+	for i := 0; i < moves.Len(); i++ {
+		b.Push(moves.At(i).Move())
 
-		if !b.WasIntoCheck() && b.transpositions[b.ZobristHash(nil)] >= 3 {
+		if !b.WasIntoCheck() && b.transpositions[b.ZobristHash(nil)] >= 2 {
 			b.Pop()
 			return true
 		}
@@ -1067,16 +1405,30 @@ func (b *Bitboard) Push(move *Move) {
 		b.fullMoveNumber++
 	}
 
-	// Remember game state.
+	// Remember game state. A king taking its own rook is castling, not a
+	// capture.
+	castlingSide := b.castlingSide(move)
 	capturedPiece := None
-	if move != nil {
+	if move != nil && castlingSide == -1 {
 		capturedPiece = b.PieceTypeAt(move.toSquare)
 	}
-	b.halfMoveClockStack.Push(b.halfMoveClock)
-	b.castlingRightStack.Push(b.castlingRights)
-	b.capturedPieceStack.Push(capturedPiece)
-	b.epSquareStack.Push(b.epSquare)
-	b.moveStack.Push(move)
+	enPassant := b.IsEnPassant(move)
+	zobristHash := b.ZobristHash(nil)
+	b.stack = append(b.stack, boardState{
+		move:           move,
+		capturedPiece:  capturedPiece,
+		enPassant:      enPassant,
+		halfMoveClock:  b.halfMoveClock,
+		castlingRights: b.castlingRights,
+		epSquare:       b.epSquare,
+		zobristHash:    zobristHash,
+		checkers:       b.checkersMask(),
+		variant:        variantState{pockets: b.pockets, promoted: b.promoted, checks: b.checks},
+	})
+
+	// Update transposition table.
+	b.transpositions[zobristHash]++
+	b.checkersKnown = false
 
 	// On a null move simply swap turns.
 	if move == nil {
@@ -1086,6 +1438,18 @@ func (b *Bitboard) Push(move *Move) {
 		return
 	}
 
+	// Drop a piece from the pocket.
+	if move.drop != None {
+		b.pockets[b.turn][move.drop]--
+		b.SetPieceAt(move.toSquare, NewPiece(move.drop, b.turn))
+
+		b.halfMoveClock++
+		b.epSquare = 0
+		b.turn ^= 1
+		b.variant.afterMove(b, move, false)
+		return
+	}
+
 	// Update half move counter.
 	pieceType := b.PieceTypeAt(move.fromSquare)
 	if pieceType == Pawn || capturedPiece != None {
@@ -1094,12 +1458,38 @@ func (b *Bitboard) Push(move *Move) {
 		b.halfMoveClock++
 	}
 
+	// Castling. King and rook may land on each others source squares, so
+	// both are lifted before they are put down again.
+	if castlingSide != -1 {
+		kingTo, rookTo := castlingTargets(b.turn, castlingSide)
+		b.RemovePieceAt(move.fromSquare)
+		b.RemovePieceAt(b.castlingRookSquare(b.turn, castlingSide))
+		b.SetPieceAt(kingTo, NewPiece(King, b.turn))
+		b.SetPieceAt(rookTo, NewPiece(Rook, b.turn))
+
+		b.castlingRights &= ^(castlingFlags[b.turn][kingSide] | castlingFlags[b.turn][queenSide])
+		b.epSquare = 0
+		b.turn ^= 1
+		b.variant.afterMove(b, move, false)
+		return
+	}
+
+	// Captured pieces go into the pocket, including pawns captured
+	// en-passant.
+	if b.variant.HasDrops() {
+		if enPassant {
+			b.updatePockets(move, Pawn)
+		} else {
+			b.updatePockets(move, capturedPiece)
+		}
+	}
+
 	// Promotion.
 	if move.promotion != None {
 		pieceType = move.promotion
 	}
 
-	// Remove piece from target square.
+	// Remove piece from source square.
 	b.RemovePieceAt(move.fromSquare)
 
 	// Handle special pawn moves.
@@ -1111,7 +1501,7 @@ func (b *Bitboard) Push(move *Move) {
 		}
 
 		// Remove pawns captured en-passant.
-		if (diff == 7 || diff == 9) && b.occupied&BBSquares[move.toSquare] == 0 {
+		if enPassant {
 			if b.turn == White {
 				b.RemovePieceAt(move.toSquare - 8)
 			} else {
@@ -1119,8 +1509,9 @@ func (b *Bitboard) Push(move *Move) {
 			}
 		}
 
-		// Set en-passant square.
-		if diff == 16 {
+		// Set en-passant square. Not after a double move from the first
+		// rank in Horde.
+		if diff == 16 && (rankIndex(move.fromSquare) == 1 || rankIndex(move.fromSquare) == 6) {
 			if b.turn == White {
 				b.epSquare = move.toSquare - 8
 			} else {
@@ -1129,35 +1520,17 @@ func (b *Bitboard) Push(move *Move) {
 		}
 	}
 
-	// Castling rights.
-	if move.fromSquare == E1 {
-		b.castlingRights &= ^CastlingWhite
-	} else if move.fromSquare == E8 {
-		b.castlingRights &= ^CastlingBlack
-	} else if move.fromSquare == A1 || move.toSquare == A1 {
-		b.castlingRights &= ^CastlingWhiteQueenSide
-	} else if move.fromSquare == A8 || move.toSquare == A8 {
-		b.castlingRights &= ^CastlingBlackQueenSide
-	} else if move.fromSquare == H1 || move.toSquare == H1 {
-		b.castlingRights &= ^CastlingWhiteKingSide
-	} else if move.fromSquare == H8 || move.toSquare == H8 {
-		b.castlingRights &= ^CastlingBlackKingSide
-	}
-
-	// Castling.
+	// Castling rights. A move can affect both sides, for example a rook
+	// capturing the opposing rook in its corner.
 	if pieceType == King {
-		if move.fromSquare == E1 && move.toSquare == G1 {
-			b.SetPieceAt(F1, NewPiece(Rook, White))
-			b.RemovePieceAt(H1)
-		} else if move.fromSquare == E1 && move.toSquare == C1 {
-			b.SetPieceAt(D1, NewPiece(Rook, White))
-			b.RemovePieceAt(A1)
-		} else if move.fromSquare == E8 && move.toSquare == G8 {
-			b.SetPieceAt(F8, NewPiece(Rook, Black))
-			b.RemovePieceAt(H8)
-		} else if move.fromSquare == E8 && move.toSquare == C8 {
-			b.SetPieceAt(D8, NewPiece(Rook, Black))
-			b.RemovePieceAt(A8)
+		b.castlingRights &= ^(castlingFlags[b.turn][kingSide] | castlingFlags[b.turn][queenSide])
+	}
+	for color := White; color <= Black; color++ {
+		for side := kingSide; side <= queenSide; side++ {
+			rookSquare := b.castlingRookSquare(color, side)
+			if move.fromSquare == rookSquare || move.toSquare == rookSquare {
+				b.castlingRights &= ^castlingFlags[color][side]
+			}
 		}
 	}
 
@@ -1167,16 +1540,18 @@ func (b *Bitboard) Push(move *Move) {
 	// Swap turn.
 	b.turn ^= 1
 
-	// Update transposition table
-	b.transpositions[b.ZobristHash(nil)]++
+	// Apply the special rules of the variant.
+	b.variant.afterMove(b, move, capturedPiece != None || enPassant)
 }
 
 // Restores the previous position and returns the last move from the stack.
 func (b *Bitboard) Pop() *Move {
-	move := b.moveStack.Pop().(*Move)
+	state := &b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	move := state.move
 
 	// Update transposition table.
-	b.transpositions[b.ZobristHash(nil)]--
+	b.transpositions[state.zobristHash]--
 
 	// Decrement fullmove number.
 	if b.turn == White {
@@ -1184,15 +1559,44 @@ func (b *Bitboard) Pop() *Move {
 	}
 
 	// Restore state.
-	b.halfMoveClock = b.halfMoveClockStack.Pop().(int)
-	b.castlingRights = b.castlingRightStack.Pop().(int)
-	b.epSquare = b.epSquareStack.Pop().(int)
-	capturedPiece := b.capturedPieceStack.Pop().(PieceTypes)
+	b.halfMoveClock = state.halfMoveClock
+	b.castlingRights = state.castlingRights
+	b.epSquare = state.epSquare
+	capturedPiece := state.capturedPiece
 	capturedPieceColor := b.turn
+	b.pockets = state.variant.pockets
+	b.promoted = state.variant.promoted
+	b.checks = state.variant.checks
+
+	// Put back pieces that exploded.
+	for _, exploded := range state.variant.exploded {
+		b.SetPieceAt(exploded.square, exploded.piece)
+	}
 
 	// On a null move simply swap the turn.
 	if move == nil {
 		b.turn ^= 1
+		b.checkers, b.checkersKnown = state.checkers, true
+		return move
+	}
+
+	// Take back a dropped piece. The pocket is already restored.
+	if move.drop != None {
+		b.RemovePieceAt(move.toSquare)
+		b.turn ^= 1
+		b.checkers, b.checkersKnown = state.checkers, true
+		return move
+	}
+
+	// Put king and rook back after castling.
+	if side := b.poppedCastlingSide(move); side != -1 {
+		kingTo, rookTo := castlingTargets(b.turn^1, side)
+		b.RemovePieceAt(kingTo)
+		b.RemovePieceAt(rookTo)
+		b.SetPieceAt(move.fromSquare, NewPiece(King, b.turn^1))
+		b.SetPieceAt(b.castlingRookSquare(b.turn^1, side), NewPiece(Rook, b.turn^1))
+		b.turn ^= 1
+		b.checkers, b.checkersKnown = state.checkers, true
 		return move
 	}
 
@@ -1210,11 +1614,7 @@ func (b *Bitboard) Pop() *Move {
 		b.RemovePieceAt(move.toSquare)
 
 		// Restore captured pawn after en-passant.
-		diff := move.fromSquare - move.toSquare
-		if diff < 0 {
-			diff = -diff
-		}
-		if piece == Pawn && (diff == 7 || diff == 9) {
+		if state.enPassant {
 			if b.turn == White {
 				b.SetPieceAt(move.toSquare+8, NewPiece(Pawn, White))
 			} else {
@@ -1223,34 +1623,59 @@ func (b *Bitboard) Pop() *Move {
 		}
 	}
 
-	// Restore rook position after castling.
-	if piece == King {
-		if move.fromSquare == E1 && move.toSquare == G1 {
-			b.RemovePieceAt(F1)
-			b.SetPieceAt(H1, NewPiece(Rook, White))
-		} else if move.fromSquare == E1 && move.toSquare == C1 {
-			b.RemovePieceAt(D1)
-			b.SetPieceAt(A1, NewPiece(Rook, White))
-		} else if move.fromSquare == E8 && move.toSquare == G8 {
-			b.RemovePieceAt(F8)
-			b.SetPieceAt(H8, NewPiece(Rook, Black))
-		} else if move.fromSquare == E8 && move.toSquare == C8 {
-			b.RemovePieceAt(D8)
-			b.SetPieceAt(A8, NewPiece(Rook, Black))
-		}
-	}
-
 	// Swap turn.
 	b.turn ^= 1
+	b.checkers, b.checkersKnown = state.checkers, true
 
 	return move
 }
 
 // Gets the last move from the move stack.
 func (b *Bitboard) Peek() *Move {
-	move := b.moveStack.Pop().(*Move)
-	b.moveStack.Push(move)
-	return move
+	return b.stack[len(b.stack)-1].move
+}
+
+// Gets the moves that have been pushed onto the move stack, starting with
+// the first move. The slice is a copy.
+func (b *Bitboard) MoveStack() []*Move {
+	moves := make([]*Move, len(b.stack))
+	for i := range b.stack {
+		moves[i] = b.stack[i].move
+	}
+	return moves
+}
+
+// Gets the number of moves on the move stack, including null moves.
+func (b *Bitboard) Ply() int {
+	return len(b.stack)
+}
+
+// Gets the type of the piece captured by the move at the given index of
+// the move stack, counting from `0` for the first move. Pawns captured
+// en-passant are included.
+//
+// Returns `None` if the move captured nothing or there is no such move.
+func (b *Bitboard) CapturedPieceAt(ply int) PieceTypes {
+	if ply < 0 || ply >= len(b.stack) {
+		return None
+	}
+	if b.stack[ply].enPassant {
+		return Pawn
+	}
+	return b.stack[ply].capturedPiece
+}
+
+// Gets the pieces giving check to the side to move.
+func (b *Bitboard) checkersMask() uint64 {
+	if b.checkersKnown {
+		return b.checkers
+	}
+
+	kings := b.kings & b.occupiedCo[b.turn]
+	if kings == 0 {
+		return BBVoid
+	}
+	return b.AttackerMask(b.turn^1, lsb(kings))
 }
 
 // Parses the given EPD string and uses it to set the position.
@@ -1395,6 +1820,11 @@ func (b *Bitboard) Epd(operations map[string]interface{}) string {
 				empty = 0
 			}
 			epd = append(epd, piece.String())
+
+			// Promoted pieces are marked in variants with drops.
+			if b.promoted&BBSquares[square] > 0 {
+				epd = append(epd, "~")
+			}
 		}
 
 		if BBSquares[square]&BBFileH > 0 {
@@ -1409,6 +1839,11 @@ func (b *Bitboard) Epd(operations map[string]interface{}) string {
 		}
 	}
 
+	// Pockets.
+	if b.variant.HasDrops() {
+		epd = append(epd, b.pocketFen())
+	}
+
 	epd = append(epd, " ")
 
 	// Side to move.
@@ -1421,22 +1856,7 @@ func (b *Bitboard) Epd(operations map[string]interface{}) string {
 	epd = append(epd, " ")
 
 	// Castling rights.
-	if b.castlingRights == 0 {
-		epd = append(epd, "-")
-	} else {
-		if b.castlingRights&CastlingWhiteKingSide > 0 {
-			epd = append(epd, "K")
-		}
-		if b.castlingRights&CastlingWhiteQueenSide > 0 {
-			epd = append(epd, "Q")
-		}
-		if b.castlingRights&CastlingBlackKingSide > 0 {
-			epd = append(epd, "k")
-		}
-		if b.castlingRights&CastlingBlackQueenSide > 0 {
-			epd = append(epd, "q")
-		}
-	}
+	epd = append(epd, b.castlingFen(false))
 
 	epd = append(epd, " ")
 
@@ -1481,14 +1901,29 @@ func (b *Bitboard) Epd(operations map[string]interface{}) string {
 //
 // Returns an error if the FEN string is invalid.
 func (b *Bitboard) SetFen(fen string) error {
-	// Ensure there are six parts.
+	// Ensure there are six parts. In Three-check the checks can be given as
+	// an additional part.
 	parts := strings.Fields(fen)
+	var checks [2]int
+	if b.variant == ThreeCheck {
+		parts, checks = splitChecksFen(parts)
+	}
 	if len(parts) != 6 {
 		return fmt.Errorf("fen string should consist of 6 parts: '%s'.", fen)
 	}
 
+	// Split off the pockets.
+	boardPart, pocketPart, hasPockets := splitPocketFen(parts[0])
+	if hasPockets && !b.variant.HasDrops() {
+		return fmt.Errorf("pockets are not allowed in %s: '%s'.", b.variant.Name(), fen)
+	}
+	pockets, err := parsePocketFen(pocketPart)
+	if err != nil {
+		return err
+	}
+
 	// Ensure the board part is valid.
-	rows := strings.Split(parts[0], "/")
+	rows := strings.Split(boardPart, "/")
 	if len(rows) != 8 {
 		return fmt.Errorf("expected 8 rows in position part of fen: '%s'.", fen)
 	}
@@ -1508,6 +1943,8 @@ func (b *Bitboard) SetFen(fen string) error {
 			} else if c == 'p' || c == 'n' || c == 'b' || c == 'r' || c == 'q' || c == 'k' || c == 'P' || c == 'N' || c == 'B' || c == 'R' || c == 'Q' || c == 'K' {
 				fieldSum++
 				previousWasDigit = false
+			} else if c == '~' && b.variant.HasDrops() && fieldSum > 0 && !previousWasDigit {
+				// Marks the previous piece as promoted.
 			} else {
 				return fmt.Errorf("invalid character in position part of fen: '%s'.", fen)
 			}
@@ -1566,16 +2003,22 @@ func (b *Bitboard) SetFen(fen string) error {
 
 	// Put pieces on the board.
 	squareIndex := 0
-	for _, c := range parts[0] {
+	for _, c := range boardPart {
 		if c >= '1' && c <= '8' {
 			cint, _ := strconv.Atoi(string(c))
 			squareIndex += cint
 		} else if c == 'p' || c == 'b' || c == 'n' || c == 'r' || c == 'q' || c == 'k' || c == 'P' || c == 'B' || c == 'N' || c == 'R' || c == 'Q' || c == 'K' {
 			b.SetPieceAt(Squares180[squareIndex], PieceFromSymbol(string(c)))
 			squareIndex++
+		} else if c == '~' {
+			b.promoted |= BBSquares[Squares180[squareIndex-1]]
 		}
 	}
 
+	// Fill the pockets and set the checks given.
+	b.pockets = pockets
+	b.checks = checks
+
 	// Set the turn.
 	if parts[1] == "w" {
 		b.turn = White
@@ -1583,20 +2026,8 @@ func (b *Bitboard) SetFen(fen string) error {
 		b.turn = Black
 	}
 
-	// Set castling flags.
-	b.castlingRights = CastlingNone
-	if strings.Contains(parts[2], "K") {
-		b.castlingRights |= CastlingWhiteKingSide
-	}
-	if strings.Contains(parts[2], "Q") {
-		b.castlingRights |= CastlingWhiteQueenSide
-	}
-	if strings.Contains(parts[2], "k") {
-		b.castlingRights |= CastlingBlackKingSide
-	}
-	if strings.Contains(parts[2], "q") {
-		b.castlingRights |= CastlingBlackQueenSide
-	}
+	// Set castling flags and the files of the castling rooks.
+	b.setCastlingFen(parts[2])
 
 	// Set the en-passant square.
 	if parts[3] == "-" {
@@ -1619,7 +2050,8 @@ func (b *Bitboard) SetFen(fen string) error {
 	}
 
 	// Reset the transposition table.
-	b.transpositions = map[uint64]int{b.ZobristHash(nil): 1}
+	b.transpositions = map[uint64]int{}
+	b.checkersKnown = false
 
 	return nil
 }
@@ -1639,9 +2071,115 @@ func (b *Bitboard) Fen() string {
 	fen = append(fen, " ")
 	fen = append(fen, strconv.Itoa(b.fullMoveNumber))
 
+	// Checks given in Three-check.
+	if b.variant == ThreeCheck {
+		fen = append(fen, fmt.Sprintf(" +%d+%d", b.checks[White], b.checks[Black]))
+	}
+
 	return strings.Join(fen, "")
 }
 
+// Gets the Shredder-FEN of the current position. Unlike `Fen()` the
+// castling part always names the files of the castling rooks, for example
+// `HAha` instead of `KQkq`.
+func (b *Bitboard) ShredderFen() string {
+	parts := strings.Fields(b.Fen())
+	parts[2] = b.castlingFen(true)
+	return strings.Join(parts, " ")
+}
+
+// Gets the castling part of a FEN. In Chess960 mode X-FEN is used: `K` and
+// `Q` refer to the outermost rook on that side and a file letter is only
+// used if there is another rook further out. Shredder-FEN always uses file
+// letters.
+func (b *Bitboard) castlingFen(shredder bool) string {
+	result := ""
+	for color := White; color <= Black; color++ {
+		for side := kingSide; side <= queenSide; side++ {
+			if b.castlingRights&castlingFlags[color][side] == 0 {
+				continue
+			}
+
+			symbol := "k"
+			if side == queenSide {
+				symbol = "q"
+			}
+			file := b.castlingRookFiles[color][side]
+			if shredder || (b.chess960 && b.outermostRookFile(color, side) != file) {
+				symbol = FileNames[file]
+			}
+
+			if color == White {
+				symbol = strings.ToUpper(symbol)
+			}
+			result += symbol
+		}
+	}
+
+	if result == "" {
+		return "-"
+	}
+	return result
+}
+
+// Parses the castling part of a FEN. Understands the classical `KQkq`,
+// X-FEN and Shredder-FEN. Pieces must already be on the board.
+func (b *Bitboard) setCastlingFen(part string) {
+	b.castlingRights = CastlingNone
+	b.castlingRookFiles = defaultCastlingRookFiles
+	if part == "-" {
+		return
+	}
+
+	for _, c := range part {
+		color := White
+		if unicode.IsLower(c) {
+			color = Black
+		}
+
+		var side, file int
+		switch unicode.ToUpper(c) {
+		case 'K':
+			side = kingSide
+			file = b.outermostRookFile(color, side)
+		case 'Q':
+			side = queenSide
+			file = b.outermostRookFile(color, side)
+		default:
+			file = int(unicode.ToUpper(c) - 'A')
+			side = queenSide
+			if file > fileIndex(b.kingSquares[color]) {
+				side = kingSide
+			}
+		}
+
+		b.castlingRights |= castlingFlags[color][side]
+		b.castlingRookFiles[color][side] = file
+	}
+}
+
+// Gets the file of the outermost rook on the backrank on the given side of
+// the king. Falls back to the h-file and the a-file if there is no such
+// rook.
+func (b *Bitboard) outermostRookFile(color Colors, side int) int {
+	kingFile := fileIndex(b.kingSquares[color])
+	rooks := b.rooks & b.occupiedCo[color] & BBRanks[backrank(color)]
+	if side == kingSide {
+		for file := 7; file > kingFile; file-- {
+			if rooks&BBFiles[file] > 0 {
+				return file
+			}
+		}
+	} else {
+		for file := 0; file < kingFile; file++ {
+			if rooks&BBFiles[file] > 0 {
+				return file
+			}
+		}
+	}
+	return defaultCastlingRookFiles[color][side]
+}
+
 // Uses the current position as the context to parse a move in standard
 // algebraic notation and return the corresponding move object.
 //
@@ -1657,28 +2195,36 @@ func (b *Bitboard) ParseSan(san string) (*Move, error) {
 	}
 
 	// Castling.
+	side := -1
 	if san == "O-O" || san == "O-O+" || san == "O-O#" {
-		if b.turn == White {
-			move = NewMove(E1, G1, None)
-		} else {
-			move = NewMove(E8, G8, None)
-		}
+		side = kingSide
+	} else if san == "O-O-O" || san == "O-O-O+" || san == "O-O-O#" {
+		side = queenSide
+	}
+	if side != -1 {
+		move = b.castlingMove(b.turn, side)
 		if b.kings&b.occupiedCo[b.turn]&BBSquares[move.fromSquare] > 0 && b.IsLegal(move) {
 			return move, nil
 		} else {
 			return nil, fmt.Errorf("illegal san: '%s'.", san)
 		}
-	} else if san == "O-O-O" || san == "O-O-O+" || san == "O-O-O#" {
-		if b.turn == White {
-			move = NewMove(E1, C1, None)
-		} else {
-			move = NewMove(E8, C8, None)
+	}
+
+	// Drops.
+	if match := DropSanRegex.FindStringSubmatch(san); len(match) > 0 {
+		drop := Pawn
+		if match[1] != "" {
+			drop = PieceFromSymbol(match[1]).pieceType
 		}
-		if b.kings&b.occupiedCo[b.turn]&BBSquares[move.fromSquare] > 0 && b.IsLegal(move) {
+		for square, name := range SquareNames {
+			if name == match[2] {
+				move = NewDrop(square, drop)
+			}
+		}
+		if b.IsLegal(move) {
 			return move, nil
-		} else {
-			return nil, fmt.Errorf("illegal san: '%s'.", san)
 		}
+		return nil, fmt.Errorf("illegal san: '%s'.", san)
 	}
 
 	// Match normal moves.
@@ -1739,10 +2285,11 @@ func (b *Bitboard) ParseSan(san string) (*Move, error) {
 		fromMask &= BBRanks[match[3][0]-'1']
 	}
 
-	// Match legal moves.
+	// Match legal moves. Drops are only written with `@`, so they are
+	// handled above.
 	var matchedMove *Move
 	for _, move := range moves {
-		if move.toSquare != toSquare {
+		if move.toSquare != toSquare || move.drop != None {
 			continue
 		}
 
@@ -1754,7 +2301,7 @@ func (b *Bitboard) ParseSan(san string) (*Move, error) {
 			continue
 		}
 
-		if b.IsIntoCheck(move) {
+		if b.IsIntoCheck(move) || b.missesForcedCapture(move) {
 			continue
 		}
 
@@ -1798,24 +2345,23 @@ func (b *Bitboard) San(move *Move) string {
 		return "--"
 	}
 
+	// Drops. Pawn drops have no piece letter.
+	if move.drop != None {
+		san := "@" + SquareNames[move.toSquare]
+		if move.drop != Pawn {
+			san = strings.ToUpper(PieceSymbols[move.drop]) + san
+		}
+		return san + b.sanSuffix(move)
+	}
+
 	piece := b.PieceTypeAt(move.fromSquare)
 	enPassant := false
 
 	// Castling.
-	if piece == King {
-		if move.fromSquare == E1 {
-			if move.toSquare == G1 {
-				return "O-O"
-			} else if move.toSquare == C1 {
-				return "O-O-O"
-			}
-		} else if move.fromSquare == E8 {
-			if move.toSquare == G8 {
-				return "O-O"
-			} else if move.toSquare == C8 {
-				return "O-O-O"
-			}
-		}
+	if side := b.castlingSide(move); side == kingSide {
+		return "O-O" + b.sanSuffix(move)
+	} else if side == queenSide {
+		return "O-O-O" + b.sanSuffix(move)
 	}
 
 	san := ""
@@ -1856,14 +2402,11 @@ func (b *Bitboard) San(move *Move) string {
 		others &= b.occupiedCo[b.turn]
 
 		// Remove illegal candidates.
-		squares := others
-		square := bitScan(squares, 0)
-		for square != -1 {
+		for squares := others; squares != 0; squares &= squares - 1 {
+			square := lsb(squares)
 			if b.IsIntoCheck(NewMove(square, move.toSquare, None)) {
 				others &= ^BBSquares[square]
 			}
-
-			square = bitScan(squares, square+1)
 		}
 
 		// Disambiguate.
@@ -1905,18 +2448,26 @@ func (b *Bitboard) San(move *Move) string {
 		san += "=" + strings.ToUpper(PieceSymbols[move.promotion])
 	}
 
-	// Look ahead for check or checkmate.
+	return san + b.sanSuffix(move)
+}
+
+// Looks ahead for check or checkmate after the move and gets the matching
+// SAN suffix. Winning by the rules of a variant counts as checkmate.
+func (b *Bitboard) sanSuffix(move *Move) string {
+	suffix := ""
 	b.Push(move)
-	if b.IsCheck() {
+	if b.IsVariantLoss() {
+		suffix = "#"
+	} else if b.IsCheck() {
 		if b.IsCheckmate() {
-			san += "#"
+			suffix = "#"
 		} else {
-			san += "+"
+			suffix = "+"
 		}
 	}
 	b.Pop()
 
-	return san
+	return suffix
 }
 
 // Gets a bitmask of possible problems with the position.
@@ -1953,35 +2504,32 @@ func (b *Bitboard) Status() Status {
 		errors |= StatusTooManyBlackPieces
 	}
 
-	if b.castlingRights&CastlingWhite > 0 {
-		if b.kingSquares[White] != E1 {
+	// Castling rights need the king on its backrank and the castling rooks
+	// on the right side of it. Outside of Chess960 the king must be on the
+	// e-file and the rooks in the corners.
+	for color := White; color <= Black; color++ {
+		if b.castlingRights&(castlingFlags[color][kingSide]|castlingFlags[color][queenSide]) == 0 {
+			continue
+		}
+
+		kingSquare := b.kingSquares[color]
+		if rankIndex(kingSquare) != backrank(color) || (!b.chess960 && fileIndex(kingSquare) != 4) {
 			errors |= StatusBadCastlingRights
 		}
 
-		if b.castlingRights&CastlingWhiteQueenSide > 0 {
-			if BBA1&b.occupiedCo[White]&b.rooks == 0 {
-				errors |= StatusBadCastlingRights
+		for side := kingSide; side <= queenSide; side++ {
+			if b.castlingRights&castlingFlags[color][side] == 0 {
+				continue
 			}
-		}
-		if b.castlingRights&CastlingWhiteKingSide > 0 {
-			if BBH1&b.occupiedCo[White]&b.rooks == 0 {
+
+			rookSquare := b.castlingRookSquare(color, side)
+			if BBSquares[rookSquare]&b.occupiedCo[color]&b.rooks == 0 {
 				errors |= StatusBadCastlingRights
 			}
-		}
-	}
-
-	if b.castlingRights&CastlingBlack > 0 {
-		if b.kingSquares[Black] != E8 {
-			errors |= StatusBadCastlingRights
-		}
-
-		if b.castlingRights&CastlingBlackQueenSide > 0 {
-			if BBA8&b.occupiedCo[Black]&b.rooks == 0 {
+			if (side == kingSide) != (rookSquare > kingSquare) {
 				errors |= StatusBadCastlingRights
 			}
-		}
-		if b.castlingRights&CastlingBlackKingSide > 0 {
-			if BBH8&b.occupiedCo[Black]&b.rooks == 0 {
+			if !b.chess960 && b.castlingRookFiles[color][side] != defaultCastlingRookFiles[color][side] {
 				errors |= StatusBadCastlingRights
 			}
 		}
@@ -2013,7 +2561,7 @@ func (b *Bitboard) Status() Status {
 		}
 	}
 
-	return errors
+	return b.variant.status(b, errors)
 }
 
 func (b *Bitboard) String() string {
@@ -2092,6 +2640,22 @@ func (b *Bitboard) ZobristHash(array []uint64) uint64 {
 		zobristHash ^= array[780]
 	}
 
+	// Hash in the pockets. They are not part of the polyglot format, so
+	// additional values are used.
+	if b.variant.HasDrops() {
+		for color := White; color <= Black; color++ {
+			for pieceType := Pawn; pieceType < King; pieceType++ {
+				zobristHash ^= pocketZobrist(color, pieceType, b.pockets[color][pieceType])
+			}
+		}
+	}
+
+	// Hash in the checks given in Three-check.
+	if b.variant == ThreeCheck {
+		zobristHash ^= checksZobristArray[White][b.checks[White]]
+		zobristHash ^= checksZobristArray[Black][b.checks[Black]]
+	}
+
 	return zobristHash
 }
 
@@ -2102,20 +2666,16 @@ func (b *Bitboard) BoardZobristHash(array []uint64) uint64 {
 
 	zobristHash := uint64(0)
 
-	squares := b.occupiedCo[Black]
-	square := bitScan(squares, 0)
-	for square != -1 {
+	for squares := b.occupiedCo[Black]; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
 		pieceIndex := (b.PieceTypeAt(square) - 1) * 2
 		zobristHash ^= array[64*int(pieceIndex)+8*rankIndex(square)+fileIndex(square)]
-		square = bitScan(squares, square+1)
 	}
 
-	squares = b.occupiedCo[White]
-	square = bitScan(squares, 0)
-	for square != -1 {
+	for squares := b.occupiedCo[White]; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
 		pieceIndex := (b.PieceTypeAt(square)-1)*2 + 1
 		zobristHash ^= array[64*int(pieceIndex)+8*rankIndex(square)+fileIndex(square)]
-		square = bitScan(squares, square+1)
 	}
 
 	return zobristHash
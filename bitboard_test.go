@@ -0,0 +1,245 @@
+package chess
+
+import "testing"
+
+func TestRepetition(t *testing.T) {
+	board := NewBitboard(StartingFen)
+	shuffle := []string{"Nf3", "Nf6", "Ng1", "Ng8"}
+
+	for i := 0; i < 4; i++ {
+		if board.IsFivefoldRepitition() {
+			t.Errorf("unexpected fivefold repetition after %d plies", len(board.MoveStack()))
+		}
+		for _, san := range shuffle {
+			if _, err := board.PushSan(san); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i == 1 && !board.CanClaimThreefoldRepitition() {
+			t.Error("expected a threefold repetition after 8 plies")
+		}
+	}
+
+	// The fifth occurrence includes the starting position.
+	if !board.IsFivefoldRepitition() {
+		t.Error("expected a fivefold repetition after 16 plies")
+	}
+
+	board.Pop()
+	if board.IsFivefoldRepitition() {
+		t.Error("unexpected fivefold repetition after taking back a move")
+	}
+
+	// Null moves are counted and uncounted like other moves.
+	board.Push(nil)
+	board.Pop()
+	board.PushSan("Ng8")
+	if !board.IsFivefoldRepitition() {
+		t.Error("expected a fivefold repetition after a null move was taken back")
+	}
+}
+
+func TestPushPopState(t *testing.T) {
+	board := NewBitboard("rnbqkbnr/ppp2ppp/8/1B1pp3/4P3/8/PPPP1PPP/RNBQK1NR b KQkq - 1 3")
+	fen := board.Fen()
+	hash := board.ZobristHash(nil)
+
+	moves := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+	if len(moves) != 6 {
+		t.Errorf("expected 6 evasions, got %d", len(moves))
+	}
+
+	for _, move := range moves {
+		board.Push(move)
+		fresh := NewBitboard(board.Fen())
+		if board.Checkers().mask != fresh.Checkers().mask {
+			t.Errorf("%s: wrong checkers after the move", move.Uci())
+		}
+		board.Pop()
+
+		if board.Fen() != fen || board.ZobristHash(nil) != hash {
+			t.Errorf("%s: position not restored", move.Uci())
+		}
+		if board.Checkers().mask != BBB5 {
+			t.Errorf("%s: wrong checkers restored", move.Uci())
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	board := NewBitboard(StartingFen)
+	for _, san := range []string{"e4", "e5", "Nf3", "Nc6"} {
+		if _, err := board.PushSan(san); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fen := board.Fen()
+
+	copied := board.Copy(true)
+	if copied.Fen() != fen || copied.Ply() != 4 {
+		t.Fatalf("expected a copy with 4 moves, got '%s' with %d", copied.Fen(), copied.Ply())
+	}
+
+	// The copy can take back moves without changing the original.
+	for copied.Ply() > 0 {
+		copied.Pop()
+	}
+	if copied.Fen() != StartingFen {
+		t.Errorf("expected the starting position after taking back all moves, got '%s'", copied.Fen())
+	}
+	if board.Fen() != fen || board.Ply() != 4 {
+		t.Errorf("original changed to '%s' with %d moves", board.Fen(), board.Ply())
+	}
+
+	// Repetitions of positions before the copy are counted: the position
+	// after 1. e4 e5 occurs for the third time.
+	shuffle := []string{"Ng1", "Nb8", "Nf3", "Nc6", "Ng1", "Nb8"}
+	copied = board.Copy(true)
+	withoutStack := board.Copy(false)
+	for _, san := range shuffle {
+		if _, err := copied.PushSan(san); err != nil {
+			t.Fatal(err)
+		}
+		withoutStack.PushSan(san)
+	}
+	if !copied.CanClaimThreefoldRepitition() {
+		t.Error("expected a threefold repetition in the copy")
+	}
+	if withoutStack.CanClaimThreefoldRepitition() {
+		t.Error("unexpected threefold repetition in the copy without the stack")
+	}
+	if board.Ply() != 4 {
+		t.Errorf("original has %d moves after changing the copy", board.Ply())
+	}
+
+	// Without the stack the copy starts at the current position.
+	copied = board.Copy(false)
+	if copied.Fen() != fen || copied.Ply() != 0 {
+		t.Errorf("expected a copy without moves, got '%s' with %d", copied.Fen(), copied.Ply())
+	}
+	copied.PushSan("Bb5")
+	if board.PieceTypeAt(F1) != Bishop {
+		t.Error("original changed after a move on the copy")
+	}
+}
+
+func TestCheckers(t *testing.T) {
+	tests := []struct {
+		fen      string
+		checkers uint64
+	}{
+		{StartingFen, BBVoid},
+		{"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", BBH4},
+		// Double check by a bishop and a rook.
+		{"4k3/8/8/8/1b6/8/8/4K2r w - - 0 1", BBB4 | BBH1},
+		// Knight and pawn.
+		{"4k3/8/8/8/8/5n2/3p4/4K3 w - - 0 1", BBF3 | BBD2},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if checkers := board.Checkers(); checkers.mask != test.checkers {
+			t.Errorf("%s: unexpected checkers %v", test.fen, checkers.Squares())
+		}
+		if board.IsCheck() != (test.checkers != BBVoid) {
+			t.Errorf("%s: IsCheck does not agree with the checkers", test.fen)
+		}
+
+		// Only the king can move out of a double check.
+		if popCount(test.checkers) == 2 {
+			for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+				if move.fromSquare != E1 {
+					t.Errorf("%s: unexpected move %s in double check", test.fen, move.Uci())
+				}
+			}
+		}
+	}
+}
+
+func TestPins(t *testing.T) {
+	tests := []struct {
+		fen     string
+		square  int
+		pinMask uint64
+		moves   int
+	}{
+		// Pinned along a diagonal, a knight can not move at all.
+		{"4k3/8/8/8/1b6/8/3N4/4K3 w - - 0 1", D2, BBD2 | BBC3 | BBB4, 0},
+		// A bishop pinned along the diagonal can move along it.
+		{"4k3/8/8/8/1b6/8/3B4/4K3 w - - 0 1", D2, BBD2 | BBC3 | BBB4, 2},
+		// Pinned along a file.
+		{"4r2k/8/8/8/8/8/4B3/4K3 w - - 0 1", E2, BBFiles[4] &^ BBE1, 0},
+		{"4r2k/8/8/8/8/8/4R3/4K3 w - - 0 1", E2, BBFiles[4] &^ BBE1, 6},
+		// A second piece in between breaks the pin.
+		{"4r2k/8/8/8/4P3/8/4R3/4K3 w - - 0 1", E2, BBAll, 8},
+		// Black pieces are pinned as well.
+		{"4k3/8/2n5/8/Q7/8/8/4K3 b - - 0 1", C6, BBB5 | BBC6 | BBD7 | BBA4, 0},
+		// Not pinned by a piece of the own color.
+		{"4k3/8/8/8/1B6/8/3N4/4K3 w - - 0 1", D2, BBAll, 6},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		color := board.turn
+		if mask := board.PinMask(color, test.square); mask != test.pinMask {
+			t.Errorf("%s: unexpected pin mask %v", test.fen, NewSquareSet(mask).Squares())
+		}
+
+		pinned := board.Pinned(color)
+		if isPinned := pinned.mask&BBSquares[test.square] != 0; isPinned != (test.pinMask != BBAll) {
+			t.Errorf("%s: unexpected pinned pieces %v", test.fen, pinned.Squares())
+		}
+
+		moves := 0
+		for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			if move.fromSquare == test.square {
+				moves++
+				if BBSquares[move.toSquare]&test.pinMask == 0 {
+					t.Errorf("%s: legal move %s leaves the pin", test.fen, move.Uci())
+				}
+			}
+		}
+		if moves != test.moves {
+			t.Errorf("%s: expected %d moves of the piece, got %d", test.fen, test.moves, moves)
+		}
+	}
+
+	board := NewBitboard(StartingFen)
+	if pinned := board.Pinned(White); pinned.mask != BBVoid {
+		t.Errorf("unexpected pinned pieces %v", pinned.Squares())
+	}
+	if mask := board.PinMask(White, E4); mask != BBAll {
+		t.Error("expected no pin for an empty square")
+	}
+}
+
+func TestXRayAttackers(t *testing.T) {
+	tests := []struct {
+		fen    string
+		color  Colors
+		square int
+		xrays  uint64
+	}{
+		// Doubled rooks.
+		{"4k3/8/8/8/4p3/8/4R3/4R1K1 w - - 0 1", White, E4, BBE1},
+		// A bishop behind a queen.
+		{"4k3/8/8/8/8/2Q5/1B6/4K3 w - - 0 1", White, E5, BBB2},
+		// Through a piece of the other color.
+		{"4k3/8/8/8/3p4/8/8/B3K3 w - - 0 1", White, G7, BBA1},
+		// Not through two pieces, and knights do not x-ray.
+		{"4k3/8/8/8/3p4/2P5/8/B3K3 w - - 0 1", White, G7, BBVoid},
+		{"4k3/8/8/8/8/3N4/8/4K3 w - - 0 1", White, E5, BBVoid},
+		// Black queen behind a black rook, white rook in front.
+		{"3qk3/3r4/8/8/8/8/3R4/4K3 w - - 0 1", Black, D2, BBD8},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if xrays := board.XRayAttackers(test.color, test.square); xrays.mask != test.xrays {
+			t.Errorf("%s: unexpected x-ray attackers of %s: %v", test.fen, SquareNames[test.square], xrays.Squares())
+		}
+		if board.Attackers(test.color, test.square).mask&test.xrays != 0 {
+			t.Errorf("%s: x-ray attackers also attack directly", test.fen)
+		}
+	}
+}
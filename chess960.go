@@ -0,0 +1,101 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Creates a new bitboard in Chess960 mode. Castling moves are encoded as
+// the king taking its own rook, like with `UCI_Chess960`, and FENs are
+// written in X-FEN.
+//
+// An empty FEN gives the standard starting position, which is Chess960
+// position 518.
+func NewChess960Bitboard(fen string) *Bitboard {
+	result := NewBitboard(fen)
+	result.chess960 = true
+	return result
+}
+
+// Checks if the board is in Chess960 mode.
+func (b *Bitboard) IsChess960() bool {
+	return b.chess960
+}
+
+// Switches Chess960 mode on or off. This changes the encoding of castling
+// moves, so it should not be called while there are moves on the stack.
+func (b *Bitboard) SetChess960(chess960 bool) {
+	b.chess960 = chess960
+}
+
+// Gets the FEN of a Chess960 starting position by its Scharnagl number
+// from 0 to 959.
+func Chess960Fen(scharnagl int) (string, error) {
+	if scharnagl < 0 || scharnagl > 959 {
+		return "", fmt.Errorf("chess960 position out of range: %d.", scharnagl)
+	}
+
+	var backrank [8]string
+	free := func(n int) int {
+		for file := 0; file < 8; file++ {
+			if backrank[file] == "" {
+				if n == 0 {
+					return file
+				}
+				n--
+			}
+		}
+		return -1
+	}
+
+	n := scharnagl
+	backrank[n%4*2+1] = "b"
+	n /= 4
+	backrank[n%4*2] = "b"
+	n /= 4
+	backrank[free(n%6)] = "q"
+	n /= 6
+
+	// The knights take two of the five remaining squares.
+	knights := [10][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}
+	first, second := free(knights[n][0]), free(knights[n][1])
+	backrank[first] = "n"
+	backrank[second] = "n"
+
+	// Rook, king and rook on the last three squares.
+	backrank[free(0)] = "r"
+	backrank[free(0)] = "k"
+	backrank[free(0)] = "r"
+
+	black := strings.Join(backrank[:], "")
+	return black + "/pppppppp/8/8/8/8/PPPPPPPP/" + strings.ToUpper(black) + " w KQkq - 0 1", nil
+}
+
+// Sets up the Chess960 starting position with the given Scharnagl number
+// and switches to Chess960 mode.
+func (b *Bitboard) SetChess960Pos(scharnagl int) error {
+	fen, err := Chess960Fen(scharnagl)
+	if err != nil {
+		return err
+	}
+
+	b.chess960 = true
+	return b.SetFen(fen)
+}
+
+// Gets the Scharnagl number of the current position, if it is a Chess960
+// starting position. Otherwise -1.
+func (b *Bitboard) Chess960Pos() int {
+	epd := b.Epd(nil)
+	if b.fullMoveNumber != 1 || b.halfMoveClock != 0 {
+		return -1
+	}
+
+	for scharnagl := 0; scharnagl < 960; scharnagl++ {
+		fen, _ := Chess960Fen(scharnagl)
+		if strings.HasPrefix(fen, epd+" ") {
+			return scharnagl
+		}
+	}
+	return -1
+}
@@ -0,0 +1,176 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChess960Fen(t *testing.T) {
+	if fen, err := Chess960Fen(518); err != nil || fen != StartingFen {
+		t.Errorf("expected the standard starting position for 518, got '%s' (%v)", fen, err)
+	}
+	if fen, _ := Chess960Fen(0); fen != "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1" {
+		t.Errorf("unexpected position 0: '%s'", fen)
+	}
+	for _, scharnagl := range []int{-1, 960} {
+		if _, err := Chess960Fen(scharnagl); err == nil {
+			t.Errorf("expected an error for %d", scharnagl)
+		}
+	}
+
+	seen := map[string]bool{}
+	board := NewChess960Bitboard("")
+	for scharnagl := 0; scharnagl < 960; scharnagl++ {
+		if err := board.SetChess960Pos(scharnagl); err != nil {
+			t.Fatal(err)
+		}
+		backrank := strings.Split(board.Fen(), "/")[7][:8]
+		if seen[backrank] {
+			t.Errorf("%d: duplicate position %s", scharnagl, backrank)
+		}
+		seen[backrank] = true
+
+		// Bishops on opposite colors and the king between the rooks.
+		bishops := board.bishops & BBRank1
+		if bishops&BBLightSquares == 0 || bishops&BBDarkSquares == 0 {
+			t.Errorf("%d: bishops on the same color in %s", scharnagl, backrank)
+		}
+		king := strings.Index(backrank, "K")
+		if strings.Index(backrank, "R") > king || strings.LastIndex(backrank, "R") < king {
+			t.Errorf("%d: king not between the rooks in %s", scharnagl, backrank)
+		}
+
+		if pos := board.Chess960Pos(); pos != scharnagl {
+			t.Errorf("%d: got back %d", scharnagl, pos)
+		}
+		if board.castlingFen(false) != "KQkq" {
+			t.Errorf("%d: unexpected castling rights %s", scharnagl, board.castlingFen(false))
+		}
+	}
+
+	board.PushSan("e4")
+	if pos := board.Chess960Pos(); pos != -1 {
+		t.Errorf("expected no starting position after a move, got %d", pos)
+	}
+}
+
+func TestChess960CastlingFen(t *testing.T) {
+	tests := []struct {
+		fen      string
+		xfen     string
+		shredder string
+	}{
+		// The outermost rooks are written as `KQkq`.
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1", "KQkq", "HFhf"},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1", "KQkq", "HFhf"},
+		{StartingFen, "KQkq", "HAha"},
+		// An inner rook needs its file.
+		{"1r2k1rr/8/8/8/8/8/8/1R2K1RR w Gg - 0 1", "Gg", "Gg"},
+		{"1r2k1rr/8/8/8/8/8/8/1R2K1RR w Kk - 0 1", "Kk", "Hh"},
+		{"1r2k1rr/8/8/8/8/8/8/1R2K1RR w HBhb - 0 1", "KQkq", "HBhb"},
+		// Only some of the rights.
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Kq - 0 1", "Kq", "Ha"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", "-", "-"},
+	}
+
+	for _, test := range tests {
+		board := NewChess960Bitboard(test.fen)
+		if castling := strings.Fields(board.Fen())[2]; castling != test.xfen {
+			t.Errorf("%s: expected X-FEN castling %s, got %s", test.fen, test.xfen, castling)
+		}
+		if castling := strings.Fields(board.ShredderFen())[2]; castling != test.shredder {
+			t.Errorf("%s: expected Shredder-FEN castling %s, got %s", test.fen, test.shredder, castling)
+		}
+
+		// Both forms read back the same rights.
+		for _, fen := range []string{board.Fen(), board.ShredderFen()} {
+			other := NewChess960Bitboard(fen)
+			if other.castlingRights != board.castlingRights || other.castlingRookFiles != board.castlingRookFiles {
+				t.Errorf("%s: castling rights changed after reading back '%s'", test.fen, fen)
+			}
+		}
+	}
+}
+
+func TestChess960Castling(t *testing.T) {
+	tests := []struct {
+		fen   string
+		san   string
+		uci   string
+		after string
+	}{
+		// The king starts on its destination.
+		{"4k3/8/8/8/8/8/8/6KR w K - 0 1", "O-O", "g1h1", "4k3/8/8/8/8/8/8/5RK1 b - - 1 1"},
+		// The rook starts on its destination.
+		{"4k3/8/8/8/8/8/8/3RK3 w Q - 0 1", "O-O-O", "e1d1", "4k3/8/8/8/8/8/8/2KR4 b - - 1 1"},
+		// King and rook swap their squares.
+		{"4k3/8/8/8/8/8/8/5KR1 w K - 0 1", "O-O", "f1g1", "4k3/8/8/8/8/8/8/5RK1 b - - 1 1"},
+		// The king moves through the rook.
+		{"4k3/8/8/8/8/8/8/1KR5 w K - 0 1", "O-O", "b1c1", "4k3/8/8/8/8/8/8/5RK1 b - - 1 1"},
+		{"1rk5/8/8/8/8/8/8/4K3 b q - 0 1", "O-O-O", "c8b8", "2kr4/8/8/8/8/8/8/4K3 w - - 1 2"},
+	}
+
+	for _, test := range tests {
+		board := NewChess960Bitboard(test.fen)
+		move, err := board.ParseSan(test.san)
+		if err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+			continue
+		}
+		if move.Uci() != test.uci {
+			t.Errorf("%s: expected %s, got %s", test.fen, test.uci, move.Uci())
+		}
+
+		found := false
+		for _, legal := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			found = found || legal.Equals(move)
+		}
+		if !found {
+			t.Errorf("%s: %s not generated", test.fen, test.uci)
+		}
+
+		board.Push(move)
+		if board.Fen() != test.after {
+			t.Errorf("%s: expected '%s' after %s, got '%s'", test.fen, test.after, test.san, board.Fen())
+		}
+		board.Pop()
+		if board.Fen() != test.fen {
+			t.Errorf("%s: expected the position back, got '%s'", test.fen, board.Fen())
+		}
+	}
+}
+
+func TestChess960CastlingAttacked(t *testing.T) {
+	tests := []struct {
+		fen   string
+		legal bool
+	}{
+		// The rook on a1 attacks c1 once the castling rook leaves b1.
+		{"4k3/8/8/8/8/8/8/rR2K3 w Q - 0 1", false},
+		{"4k3/8/8/8/8/8/8/1R2K3 w Q - 0 1", true},
+		// The destination of the king is attacked directly.
+		{"2r1k3/8/8/8/8/8/8/1R2K3 w Q - 0 1", false},
+		// Another piece still blocks.
+		{"4k3/8/8/8/8/8/8/rNR1K3 w Q - 0 1", true},
+	}
+
+	for _, test := range tests {
+		board := NewChess960Bitboard(test.fen)
+		if board.canCastle(White, queenSide) != test.legal {
+			t.Errorf("%s: expected castling rights to be usable: %v", test.fen, test.legal)
+		}
+
+		castling := false
+		for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			if san := board.San(move); strings.HasPrefix(san, "O-O") {
+				castling = true
+			}
+		}
+		if castling != test.legal {
+			t.Errorf("%s: expected castling to be legal: %v", test.fen, test.legal)
+		}
+		if _, err := board.ParseSan("O-O-O"); (err == nil) != test.legal {
+			t.Errorf("%s: unexpected result parsing O-O-O: %v", test.fen, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package chess
+
+// Checks if neither side can checkmate by any sequence of legal moves, so
+// that the game is drawn under FIDE rules. This is the case with
+// insufficient material or a blocked position.
+func (b *Bitboard) IsDeadPosition() bool {
+	return b.IsInsufficientMaterial() || b.IsBlockedPosition()
+}
+
+// Checks if the pawns are locked against each other, so that no capture
+// and no promotion is ever possible.
+//
+// Besides kings and pawns only bishops may be on the board. Every pawn
+// must be blocked by a pawn in front of it. The kings must not be able to
+// walk to any opposing pawn or bishop, and the bishops must be shut
+// off from the opposing pawns, bishops and king. Bishops locked behind a
+// pawn chain, on the other side from the opposing pieces, can never get
+// to them.
+//
+// The check is conservative: some dead positions are not recognized, but
+// a position that is recognized is dead. It is only done by the standard
+// rules.
+//
+//     board := chess.NewBitboard("8/8/1k6/p1p1p1p1/P1P1P1P1/8/4K3/8 w - - 0 1")
+//     board.IsBlockedPosition()  // true
+func (b *Bitboard) IsBlockedPosition() bool {
+	if b.variant != Standard || b.knights|b.rooks|b.queens > 0 {
+		return false
+	}
+
+	// Every pawn is blocked by another pawn.
+	whitePawns := b.pawns & b.occupiedCo[White]
+	blackPawns := b.pawns & b.occupiedCo[Black]
+	if shiftUp(whitePawns) & ^b.pawns > 0 || shiftDown(blackPawns) & ^b.pawns > 0 {
+		return false
+	}
+
+	// No pawn can capture, also not en-passant.
+	pawnAttacks := [2]uint64{
+		shiftUpLeft(whitePawns) | shiftUpRight(whitePawns),
+		shiftDownLeft(blackPawns) | shiftDownRight(blackPawns),
+	}
+	if pawnAttacks[White]&blackPawns > 0 || pawnAttacks[Black]&whitePawns > 0 {
+		return false
+	}
+	if b.epSquare != 0 && BBSquares[b.epSquare]&pawnAttacks[b.turn] > 0 {
+		return false
+	}
+
+	// Find the squares the kings and the bishops of each side can ever
+	// reach, passing other kings and bishops that could make way.
+	var kingRegions, bishopRegions [2]uint64
+	for color := White; color <= Black; color++ {
+		kings := b.kings & b.occupiedCo[color]
+		kingRegions[color] = fill(kings, kingSpread, ^b.pawns & ^pawnAttacks[color^1])
+
+		bishops := b.bishops & b.occupiedCo[color]
+		bishopRegions[color] = fill(bishops, bishopSpread, ^b.pawns)
+	}
+
+	for color := White; color <= Black; color++ {
+		opposingPawns := b.pawns & b.occupiedCo[color^1]
+
+		// Kings could capture opposing pawns and bishops.
+		if kingSpread(kingRegions[color])&(opposingPawns|bishopRegions[color^1]) > 0 {
+			return false
+		}
+
+		// Bishops could capture pawns, be captured by them or capture and
+		// check opposing pieces.
+		if bishopSpread(bishopRegions[color])&(opposingPawns|bishopRegions[color^1]|kingRegions[color^1]) > 0 {
+			return false
+		}
+		if bishopRegions[color]&pawnAttacks[color^1] > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Gets all squares the pieces can reach by repeated steps, moving only
+// through the given squares.
+func fill(pieces uint64, spread func(uint64) uint64, through uint64) uint64 {
+	region := pieces
+	for {
+		next := region | spread(region)&through
+		if next == region {
+			return region
+		}
+		region = next
+	}
+}
+
+// Adds the squares a king step away.
+func kingSpread(squares uint64) uint64 {
+	squares |= shiftLeft(squares) | shiftRight(squares)
+	return squares | shiftUp(squares) | shiftDown(squares)
+}
+
+// Adds the squares a diagonal step away.
+func bishopSpread(squares uint64) uint64 {
+	return squares | shiftUpLeft(squares) | shiftUpRight(squares) | shiftDownLeft(squares) | shiftDownRight(squares)
+}
@@ -0,0 +1,84 @@
+package chess
+
+import "testing"
+
+func TestDeadPosition(t *testing.T) {
+	tests := []struct {
+		fen     string
+		blocked bool
+		dead    bool
+	}{
+		// Pawn chains locked across the board.
+		{"8/8/1k6/p1p1p1p1/P1P1P1P1/8/4K3/8 w - - 0 1", true, true},
+		{"8/4k3/8/1p1p1p1p/pPpPpPpP/P1P1P1P1/3K4/8 b - - 0 1", true, true},
+		// With a bishop on the color of its own pawns, which can never
+		// attack the opposing pawns.
+		{"8/8/1k6/p1p1p1p1/P1P1P1P1/8/4K3/5B2 w - - 0 1", true, true},
+		// Bare kings and bishops on squares of the same color.
+		{"8/8/8/4k3/8/8/8/4K3 w - - 0 1", true, true},
+		{"4k3/8/8/8/8/8/8/1B1bK3 w - - 0 1", false, true},
+		{"4k3/8/8/8/8/8/8/1B1bK1B1 w - - 0 1", false, false},
+
+		{StartingFen, false, false},
+		// Bishops on squares of a different color.
+		{"4k3/8/8/8/8/8/2B5/4K1b1 w - - 0 1", false, false},
+		// The a-file is open.
+		{"8/8/1k6/2p1p1p1/P1P1P1P1/8/4K3/8 w - - 0 1", false, false},
+		// A pawn can capture.
+		{"8/8/1k6/p1p1p1p1/PP2P1P1/8/4K3/8 w - - 0 1", false, false},
+		// Capturing en passant opens the position.
+		{"8/8/1k6/2p1p1p1/pPP1P1P1/P7/4K3/8 b - b3 0 1", false, false},
+		// The bishop can attack the pawns.
+		{"8/8/1k6/p1p1p1p1/P1P1P1P1/8/4K3/2B5 w - - 0 1", false, false},
+		// A knight is never blocked.
+		{"8/8/1k6/p1p1p1p1/P1P1P1P1/8/4K3/6N1 w - - 0 1", false, false},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if blocked := board.IsBlockedPosition(); blocked != test.blocked {
+			t.Errorf("%s: expected blocked %v, got %v", test.fen, test.blocked, blocked)
+		}
+		if dead := board.IsDeadPosition(); dead != test.dead {
+			t.Errorf("%s: expected dead %v, got %v", test.fen, test.dead, dead)
+		}
+	}
+
+	// Only checked by the standard rules.
+	board := NewVariantBitboard(KingOfTheHill, "8/8/1k6/p1p1p1p1/P1P1P1P1/8/4K3/8 w - - 0 1")
+	if board.IsDeadPosition() {
+		t.Error("expected no dead position in King of the Hill")
+	}
+}
+
+func TestHasInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		fen   string
+		white bool
+		black bool
+	}{
+		{"8/8/8/4k3/8/8/8/4K3 w - - 0 1", true, true},
+		{"8/8/8/4k3/8/8/8/4KN2 w - - 0 1", true, true},
+		{"8/8/8/4k3/8/8/8/4KR2 w - - 0 1", false, true},
+		{"8/8/8/4k3/8/8/8/4K1NN w - - 0 1", false, true},
+		// The bishop can mate with the help of an opposing pawn, knight or
+		// bishop of the other color.
+		{"8/8/8/4k3/8/8/8/3BK3 w - - 0 1", true, true},
+		{"8/8/8/4k3/8/8/p7/3BK3 w - - 0 1", false, false},
+		{"8/8/8/4k3/8/8/8/2bBK3 w - - 0 1", false, false},
+		{"8/8/8/4k3/8/8/8/1b1BK3 w - - 0 1", true, true},
+		// A knight needs opposing pieces other than queens.
+		{"8/8/8/4k3/8/8/8/q3KN2 w - - 0 1", true, false},
+		{"8/8/8/4k3/8/8/8/r3KN2 w - - 0 1", false, false},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if insufficient := board.HasInsufficientMaterial(White); insufficient != test.white {
+			t.Errorf("%s: expected %v for white, got %v", test.fen, test.white, insufficient)
+		}
+		if insufficient := board.HasInsufficientMaterial(Black); insufficient != test.black {
+			t.Errorf("%s: expected %v for black, got %v", test.fen, test.black, insufficient)
+		}
+	}
+}
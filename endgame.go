@@ -0,0 +1,1165 @@
+package chess
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The maximum number of pieces of generated endgame tables.
+const EndgameMaxPieces = 4
+
+const endgameExtension = ".etb"
+
+var endgameMagic = [4]byte{'E', 'T', 'B', '1'}
+
+var endgameMaterialRegex = regexp.MustCompile("^K[QRBNP]*vK[QRBNP]*$")
+
+// Values of positions. A win in n plies is stored as n, which is odd. A
+// loss in n plies is stored as n + 2, which is even.
+const (
+	endgameDraw    uint16 = 0
+	endgameIllegal uint16 = 0xffff
+)
+
+// State of positions during generation.
+const (
+	endgameFinal uint8 = 1 << iota
+	endgameInvalid
+	endgameWinPending
+	endgameDrawChild
+)
+
+// Transformations of squares. Bit 1 mirrors the files, bit 2 mirrors the
+// ranks and bit 4 flips at the a1-h8 diagonal.
+var endgameTransforms [8][64]int
+
+// Indexes of the white king in the a1-d1-d4 triangle for pawnless tables
+// and on the queen side for tables with pawns, or -1.
+var endgameTriangleIndex, endgameQueenSideIndex [64]int
+var endgameTriangle, endgameQueenSide []int
+
+func init() {
+	for t := range endgameTransforms {
+		for square := 0; square < 64; square++ {
+			x := square
+			if t&1 != 0 {
+				x ^= 07
+			}
+			if t&2 != 0 {
+				x ^= 070
+			}
+			if t&4 != 0 {
+				x = (x&07)<<3 | x>>3
+			}
+			endgameTransforms[t][square] = x
+		}
+	}
+
+	for square := 0; square < 64; square++ {
+		endgameTriangleIndex[square] = -1
+		endgameQueenSideIndex[square] = -1
+
+		if fileIndex(square) <= 3 && rankIndex(square) <= fileIndex(square) {
+			endgameTriangleIndex[square] = len(endgameTriangle)
+			endgameTriangle = append(endgameTriangle, square)
+		}
+		if fileIndex(square) <= 3 {
+			endgameQueenSideIndex[square] = len(endgameQueenSide)
+			endgameQueenSide = append(endgameQueenSide, square)
+		}
+	}
+}
+
+// Converts the value of a position to the value of its parent.
+func endgameParent(value uint16) uint16 {
+	if value == endgameDraw {
+		return endgameDraw
+	} else if value%2 == 1 {
+		return value + 3
+	}
+	return value - 1
+}
+
+// Checks if a value is preferable to another one for the side to move:
+// faster wins first, then draws, then slower losses.
+func endgameBetter(a, b uint16) bool {
+	aWin, bWin := a%2 == 1, b%2 == 1
+	if aWin != bWin {
+		return aWin
+	}
+	if aWin {
+		return a < b
+	}
+	if a == endgameDraw || b == endgameDraw {
+		return a == endgameDraw && b != endgameDraw
+	}
+	return a > b
+}
+
+// Gets the normalized name of the material, with the stronger side first,
+// and if the colors had to be swapped for that. Piece types must be in
+// descending order and not include the kings.
+func endgameMaterial(white, black []PieceTypes) (string, bool) {
+	swapped := len(black) > len(white)
+	if len(black) == len(white) {
+		for i := range white {
+			if white[i] != black[i] {
+				swapped = black[i] > white[i]
+				break
+			}
+		}
+	}
+	if swapped {
+		white, black = black, white
+	}
+
+	name := "K"
+	for _, pieceType := range white {
+		name += strings.ToUpper(PieceSymbols[pieceType])
+	}
+	name += "vK"
+	for _, pieceType := range black {
+		name += strings.ToUpper(PieceSymbols[pieceType])
+	}
+	return name, swapped
+}
+
+type endgamePiece struct {
+	color     Colors
+	pieceType PieceTypes
+	square    int
+}
+
+// Pieces of a table. White comes first and each side starts with the king,
+// followed by the other pieces in descending order.
+type endgameSlot struct {
+	color     Colors
+	pieceType PieceTypes
+}
+
+type endgameTable struct {
+	material string
+	slots    []endgameSlot
+	pawns    bool
+
+	// Ranges of slots with identical pieces.
+	groups [][2]int
+
+	anchors     []int
+	anchorIndex *[64]int
+	transforms  []int
+	perSide     int
+
+	values []uint16
+}
+
+func newEndgameTable(material string) (*endgameTable, error) {
+	if !endgameMaterialRegex.MatchString(material) {
+		return nil, fmt.Errorf("invalid endgame material: '%s'.", material)
+	}
+	if len(material)-1 > EndgameMaxPieces {
+		return nil, fmt.Errorf("endgame tables support up to %d pieces: '%s'.", EndgameMaxPieces, material)
+	}
+
+	sides := strings.Split(material, "v")
+	types := [2][]PieceTypes{}
+	for color, side := range sides {
+		for _, symbol := range side[1:] {
+			types[color] = append(types[color], PieceFromSymbol(string(symbol)).pieceType)
+		}
+		sort.Slice(types[color], func(i, j int) bool {
+			return types[color][i] > types[color][j]
+		})
+	}
+	if normalized, _ := endgameMaterial(types[White], types[Black]); normalized != material {
+		return nil, fmt.Errorf("endgame material is not normalized, expected '%s': '%s'.", normalized, material)
+	}
+
+	t := &endgameTable{material: material}
+	for color := White; color <= Black; color++ {
+		t.slots = append(t.slots, endgameSlot{color, King})
+		for _, pieceType := range types[color] {
+			t.slots = append(t.slots, endgameSlot{color, pieceType})
+			if pieceType == Pawn {
+				t.pawns = true
+			}
+		}
+	}
+
+	for i := 1; i < len(t.slots); {
+		j := i + 1
+		for j < len(t.slots) && t.slots[j] == t.slots[i] {
+			j++
+		}
+		if j-i > 1 {
+			t.groups = append(t.groups, [2]int{i, j})
+		}
+		i = j
+	}
+
+	if t.pawns {
+		t.anchors = endgameQueenSide
+		t.anchorIndex = &endgameQueenSideIndex
+		t.transforms = []int{0, 1}
+	} else {
+		t.anchors = endgameTriangle
+		t.anchorIndex = &endgameTriangleIndex
+		t.transforms = []int{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+
+	t.perSide = len(t.anchors)
+	for i := 1; i < len(t.slots); i++ {
+		t.perSide *= 64
+	}
+
+	return t, nil
+}
+
+// Gets the materials that can be reached by a capture or a promotion.
+func (t *endgameTable) submaterials() []string {
+	types := [2][]PieceTypes{}
+	for _, slot := range t.slots {
+		if slot.pieceType != King {
+			types[slot.color] = append(types[slot.color], slot.pieceType)
+		}
+	}
+
+	without := func(pieces []PieceTypes, i int) []PieceTypes {
+		result := append([]PieceTypes{}, pieces[:i]...)
+		return append(result, pieces[i+1:]...)
+	}
+	with := func(pieces []PieceTypes, pieceType PieceTypes) []PieceTypes {
+		result := append([]PieceTypes{pieceType}, pieces...)
+		sort.Slice(result, func(i, j int) bool {
+			return result[i] > result[j]
+		})
+		return result
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	add := func(us, them []PieceTypes) {
+		name, _ := endgameMaterial(us, them)
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+
+	for color := White; color <= Black; color++ {
+		us, them := types[color], types[color^1]
+		for i := range them {
+			add(us, without(them, i))
+		}
+		for i, pieceType := range us {
+			if pieceType != Pawn {
+				continue
+			}
+			for _, promotion := range []PieceTypes{Queen, Rook, Bishop, Knight} {
+				promoted := with(without(us, i), promotion)
+				add(promoted, them)
+				for j := range them {
+					add(promoted, without(them, j))
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// Gets the turn and the squares of the pieces by slot.
+func (t *endgameTable) decode(idx int) (Colors, [EndgameMaxPieces]int) {
+	var squares [EndgameMaxPieces]int
+	turn := Colors(idx / t.perSide)
+	rest := idx % t.perSide
+	for i := len(t.slots) - 1; i >= 1; i-- {
+		squares[i] = rest & 63
+		rest >>= 6
+	}
+	squares[0] = t.anchors[rest]
+	return turn, squares
+}
+
+// Gets the index of the position. Symmetric positions and permutations of
+// identical pieces share the smallest of their indexes.
+func (t *endgameTable) index(turn Colors, squares [EndgameMaxPieces]int) int {
+	best := -1
+	for _, transform := range t.transforms {
+		squareMap := &endgameTransforms[transform]
+		anchor := t.anchorIndex[squareMap[squares[0]]]
+		if anchor < 0 {
+			continue
+		}
+
+		var s [EndgameMaxPieces]int
+		for i := 1; i < len(t.slots); i++ {
+			s[i] = squareMap[squares[i]]
+		}
+		for _, group := range t.groups {
+			for i := group[0] + 1; i < group[1]; i++ {
+				for j := i; j > group[0] && s[j-1] > s[j]; j-- {
+					s[j-1], s[j] = s[j], s[j-1]
+				}
+			}
+		}
+
+		idx := anchor
+		for i := 1; i < len(t.slots); i++ {
+			idx = idx<<6 | s[i]
+		}
+		if best < 0 || idx < best {
+			best = idx
+		}
+	}
+	return int(turn)*t.perSide + best
+}
+
+// Gets the index of a position given by a list of pieces in any order.
+// With `swapped` the colors and ranks are mirrored first.
+func (t *endgameTable) indexPieces(turn Colors, pieces []endgamePiece, swapped bool) (int, error) {
+	var squares [EndgameMaxPieces]int
+	used := 0
+	for i, slot := range t.slots {
+		found := false
+		for j, piece := range pieces {
+			color, square := piece.color, piece.square
+			if swapped {
+				color, square = color^1, square^070
+			}
+			if used&(1<<uint(j)) == 0 && color == slot.color && piece.pieceType == slot.pieceType {
+				squares[i] = square
+				used |= 1 << uint(j)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("pieces do not match endgame table %s.", t.material)
+		}
+	}
+
+	if swapped {
+		turn ^= 1
+	}
+	return t.index(turn, squares), nil
+}
+
+// Checks that no squares are shared and that no pawns are on the
+// backranks.
+func (t *endgameTable) isValid(squares [EndgameMaxPieces]int) bool {
+	occupied := uint64(0)
+	for i, slot := range t.slots {
+		mask := BBSquares[squares[i]]
+		if occupied&mask != 0 {
+			return false
+		}
+		if slot.pieceType == Pawn && mask&(BBRank1|BBRank8) != 0 {
+			return false
+		}
+		occupied |= mask
+	}
+	return true
+}
+
+// Sets up positions of a table on a reusable board.
+type endgameWorker struct {
+	table  *endgameTable
+	board  *Bitboard
+	pieces [2][7]*Piece
+	moves  MoveList
+}
+
+func newEndgameWorker(t *endgameTable) *endgameWorker {
+	w := &endgameWorker{table: t, board: NewBitboard("")}
+	w.board.Clear()
+	for color := White; color <= Black; color++ {
+		for pieceType := Pawn; pieceType <= King; pieceType++ {
+			w.pieces[color][pieceType] = NewPiece(pieceType, color)
+		}
+	}
+	return w
+}
+
+func (w *endgameWorker) place(turn Colors, squares [EndgameMaxPieces]int) {
+	for i, slot := range w.table.slots {
+		w.board.SetPieceAt(squares[i], w.pieces[slot.color][slot.pieceType])
+	}
+	w.board.turn = turn
+}
+
+func (w *endgameWorker) remove(squares [EndgameMaxPieces]int) {
+	for i := range w.table.slots {
+		w.board.RemovePieceAt(squares[i])
+	}
+}
+
+// Checks if the pseudo legal move does not leave the king in check.
+func (w *endgameWorker) isLegal(fromSquare, toSquare int, promotion PieceTypes) bool {
+	b := w.board
+	turn := b.turn
+	moved := b.pieces[fromSquare]
+	captured := b.pieces[toSquare]
+
+	placed := moved
+	if promotion != None {
+		placed = promotion
+	}
+	if captured != None {
+		b.RemovePieceAt(toSquare)
+	}
+	b.RemovePieceAt(fromSquare)
+	b.SetPieceAt(toSquare, w.pieces[turn][placed])
+
+	legal := !b.IsAttackedBy(turn^1, b.kingSquares[turn])
+
+	b.RemovePieceAt(toSquare)
+	b.SetPieceAt(fromSquare, w.pieces[turn][moved])
+	if captured != None {
+		b.SetPieceAt(toSquare, w.pieces[turn^1][captured])
+	}
+	return legal
+}
+
+// Finds the value of a legal position, as far as it is known without the
+// values of other positions of the same table. Quiet moves lead to
+// positions of the same table. Their distinct indexes are returned.
+func (w *endgameWorker) initialize(tb *EndgameTablebase, turn Colors, squares [EndgameMaxPieces]int, children []int) (legal int, win, loss uint16, draw bool, result []int, err error) {
+	t := w.table
+	b := w.board
+
+	w.moves.Clear()
+	b.GenerateMovesInto(&w.moves, GenerateAll)
+
+	var pieces [EndgameMaxPieces]endgamePiece
+	for _, move := range w.moves.Slice() {
+		fromSquare, toSquare, promotion := move.FromSquare(), move.ToSquare(), move.Promotion()
+		if !w.isLegal(fromSquare, toSquare, promotion) {
+			continue
+		}
+		legal++
+
+		mover, captured := -1, -1
+		for i := range t.slots {
+			if squares[i] == fromSquare {
+				mover = i
+			} else if squares[i] == toSquare {
+				captured = i
+			}
+		}
+
+		if captured < 0 && promotion == None {
+			child := squares
+			child[mover] = toSquare
+			idx := t.index(turn^1, child)
+			found := false
+			for _, c := range children {
+				if c == idx {
+					found = true
+					break
+				}
+			}
+			if !found {
+				children = append(children, idx)
+			}
+			continue
+		}
+
+		// Captures and promotions lead to other tables.
+		n := 0
+		for i, slot := range t.slots {
+			if i == captured {
+				continue
+			}
+			pieces[n] = endgamePiece{slot.color, slot.pieceType, squares[i]}
+			if i == mover {
+				pieces[n].square = toSquare
+				if promotion != None {
+					pieces[n].pieceType = promotion
+				}
+			}
+			n++
+		}
+
+		value, err := tb.lookup(turn^1, pieces[:n])
+		if err != nil {
+			return 0, 0, 0, false, children, err
+		}
+
+		value = endgameParent(value)
+		if value == endgameDraw {
+			draw = true
+		} else if value%2 == 1 {
+			if win == 0 || value < win {
+				win = value
+			}
+		} else if value-2 > loss {
+			loss = value - 2
+		}
+	}
+
+	return legal, win, loss, draw, children, nil
+}
+
+// Finds the distinct indexes of positions from which a quiet move leads to
+// the position.
+func (w *endgameWorker) predecessors(turn Colors, squares [EndgameMaxPieces]int, result []int) []int {
+	t := w.table
+	b := w.board
+	mover := turn ^ 1
+
+	for i, slot := range t.slots {
+		if slot.color != mover {
+			continue
+		}
+
+		square := squares[i]
+		targets := BBVoid
+		switch slot.pieceType {
+		case Pawn:
+			if mover == White && rankIndex(square) >= 2 && b.occupied&BBSquares[square-8] == 0 {
+				targets |= BBSquares[square-8]
+				if rankIndex(square) == 3 {
+					targets |= BBSquares[square-16]
+				}
+			} else if mover == Black && rankIndex(square) <= 5 && b.occupied&BBSquares[square+8] == 0 {
+				targets |= BBSquares[square+8]
+				if rankIndex(square) == 4 {
+					targets |= BBSquares[square+16]
+				}
+			}
+		case Knight:
+			targets = b.KnightAttacksFrom(square)
+		case Bishop:
+			targets = b.BishopAttacksFrom(square)
+		case Rook:
+			targets = b.RookAttacksFrom(square)
+		case Queen:
+			targets = b.QueenAttacksFrom(square)
+		case King:
+			targets = b.KingAttacksFrom(square)
+		}
+		targets &^= b.occupied
+
+		for ; targets != 0; targets &= targets - 1 {
+			parent := squares
+			parent[i] = lsb(targets)
+			idx := t.index(mover, parent)
+			found := false
+			for _, p := range result {
+				if p == idx {
+					found = true
+					break
+				}
+			}
+			if !found {
+				result = append(result, idx)
+			}
+		}
+	}
+
+	return result
+}
+
+type endgameBuckets [][]int32
+
+func (buckets *endgameBuckets) push(depth uint16, idx int) {
+	for int(depth) >= len(*buckets) {
+		*buckets = append(*buckets, nil)
+	}
+	(*buckets)[depth] = append((*buckets)[depth], int32(idx))
+}
+
+// Computes the values of all positions by retrograde analysis. The tables
+// of all submaterials must be available.
+func (t *endgameTable) generate(tb *EndgameTablebase) error {
+	size := 2 * t.perSide
+	t.values = make([]uint16, size)
+	flags := make([]uint8, size)
+	counts := make([]uint8, size)
+
+	// Look at the moves of each position once. Positions are finished if
+	// their value does not depend on other positions of the table, or
+	// queued by the depth they will have once they are. Pending losses
+	// are kept in the values.
+	workers := runtime.NumCPU()
+	chunk := (size + workers - 1) / workers
+	queues := make([]endgameBuckets, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			w := newEndgameWorker(t)
+			children := []int{}
+
+			end := (n + 1) * chunk
+			if end > size {
+				end = size
+			}
+			for idx := n * chunk; idx < end; idx++ {
+				turn, squares := t.decode(idx)
+				if !t.isValid(squares) || t.index(turn, squares) != idx {
+					flags[idx] = endgameInvalid
+					t.values[idx] = endgameIllegal
+					continue
+				}
+
+				w.place(turn, squares)
+				if w.board.IsAttackedBy(turn, w.board.kingSquares[turn^1]) {
+					w.remove(squares)
+					flags[idx] = endgameInvalid
+					t.values[idx] = endgameIllegal
+					continue
+				}
+
+				legal, win, loss, draw, result, err := w.initialize(tb, turn, squares, children[:0])
+				check := w.board.IsAttackedBy(turn^1, w.board.kingSquares[turn])
+				w.remove(squares)
+				children = result
+				if err != nil {
+					errs[n] = err
+					return
+				}
+
+				counts[idx] = uint8(len(children))
+				t.values[idx] = loss
+				if draw {
+					flags[idx] |= endgameDrawChild
+				}
+
+				if legal == 0 && check {
+					queues[n].push(0, idx)
+				} else if legal == 0 {
+					flags[idx] |= endgameFinal
+				} else if win != 0 {
+					flags[idx] |= endgameWinPending
+					queues[n].push(win, idx)
+				} else if len(children) == 0 && draw {
+					flags[idx] |= endgameFinal
+					t.values[idx] = endgameDraw
+				} else if len(children) == 0 {
+					queues[n].push(loss, idx)
+				}
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	var buckets endgameBuckets
+	for _, queue := range queues {
+		for depth, indexes := range queue {
+			for _, idx := range indexes {
+				buckets.push(uint16(depth), int(idx))
+			}
+		}
+	}
+
+	// Finish positions by increasing depth. Each one decides the values
+	// of the positions leading to it.
+	w := newEndgameWorker(t)
+	parents := []int{}
+	for depth := 0; depth < len(buckets); depth++ {
+		for i := 0; i < len(buckets[depth]); i++ {
+			idx := int(buckets[depth][i])
+			if flags[idx]&endgameFinal != 0 {
+				continue
+			}
+
+			flags[idx] |= endgameFinal
+			win := depth%2 == 1
+			if win {
+				t.values[idx] = uint16(depth)
+			} else {
+				t.values[idx] = uint16(depth + 2)
+			}
+
+			turn, squares := t.decode(idx)
+			w.place(turn, squares)
+			parents = w.predecessors(turn, squares, parents[:0])
+			w.remove(squares)
+
+			for _, parent := range parents {
+				if flags[parent]&(endgameFinal|endgameInvalid) != 0 {
+					continue
+				}
+
+				if !win {
+					flags[parent] |= endgameWinPending
+					buckets.push(uint16(depth+1), parent)
+					continue
+				}
+
+				counts[parent]--
+				if uint16(depth+1) > t.values[parent] {
+					t.values[parent] = uint16(depth + 1)
+				}
+				if counts[parent] > 0 || flags[parent]&endgameWinPending != 0 {
+					continue
+				}
+				if flags[parent]&endgameDrawChild != 0 {
+					flags[parent] |= endgameFinal
+					t.values[parent] = endgameDraw
+				} else {
+					buckets.push(t.values[parent], parent)
+				}
+			}
+		}
+		buckets[depth] = nil
+	}
+
+	// Everything else is a draw.
+	for idx := range t.values {
+		if flags[idx]&(endgameFinal|endgameInvalid) == 0 {
+			t.values[idx] = endgameDraw
+		}
+	}
+
+	return nil
+}
+
+// Generates and probes endgame tables for small material by retrograde
+// analysis. The tables give the exact depth to mate with perfect play.
+//
+//     tablebase := chess.NewEndgameTablebase()
+//     err := tablebase.Generate("KRvK")
+//
+//     board := chess.NewBitboard("8/8/8/4k3/8/8/8/KR6 w - - 0 1")
+//     dtm, err := tablebase.Probe(board)
+//     line, err := tablebase.PerfectLine(board)
+//
+// Tables with up to four pieces can be generated. Generating a table also
+// generates the tables reachable by captures and promotions. Tables with
+// pawns and their subtables can take minutes and need a few hundred
+// megabytes of memory.
+// Generated tables can be saved with `SaveDirectory()` and loaded again
+// with `AddDirectory()`.
+//
+// En-passant is not part of the tables. It is handled when probing by
+// pushing and popping moves on the given board.
+type EndgameTablebase struct {
+	mutex  sync.RWMutex
+	tables map[string]*endgameTable
+}
+
+func NewEndgameTablebase() *EndgameTablebase {
+	return &EndgameTablebase{tables: map[string]*endgameTable{}}
+}
+
+// Generates the table for the given material, like `KQvK` or `KBNvK`,
+// unless it is already available.
+func (tb *EndgameTablebase) Generate(material string) error {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	t, err := newEndgameTable(material)
+	if err != nil {
+		return err
+	}
+	return tb.generate(t)
+}
+
+func (tb *EndgameTablebase) generate(t *endgameTable) error {
+	if _, ok := tb.tables[t.material]; ok {
+		return nil
+	}
+
+	for _, material := range t.submaterials() {
+		sub, err := newEndgameTable(material)
+		if err != nil {
+			return err
+		}
+		if err := tb.generate(sub); err != nil {
+			return err
+		}
+	}
+
+	if err := t.generate(tb); err != nil {
+		return err
+	}
+	tb.tables[t.material] = t
+	return nil
+}
+
+// Gets the names of the available tables.
+func (tb *EndgameTablebase) Materials() []string {
+	tb.mutex.RLock()
+	defer tb.mutex.RUnlock()
+
+	result := []string{}
+	for material := range tb.tables {
+		result = append(result, material)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Gets the value of a position given by a list of pieces, from the point
+// of view of the side to move.
+func (tb *EndgameTablebase) lookup(turn Colors, pieces []endgamePiece) (uint16, error) {
+	types := [2][]PieceTypes{}
+	for _, piece := range pieces {
+		if piece.pieceType != King {
+			types[piece.color] = append(types[piece.color], piece.pieceType)
+		}
+	}
+	for color := range types {
+		sort.Slice(types[color], func(i, j int) bool {
+			return types[color][i] > types[color][j]
+		})
+	}
+
+	material, swapped := endgameMaterial(types[White], types[Black])
+	t, ok := tb.tables[material]
+	if !ok {
+		return 0, fmt.Errorf("did not find endgame table for %s.", material)
+	}
+
+	idx, err := t.indexPieces(turn, pieces, swapped)
+	if err != nil {
+		return 0, err
+	}
+	return t.values[idx], nil
+}
+
+func (tb *EndgameTablebase) checkPosition(b *Bitboard) error {
+	if b.variant != Standard {
+		return fmt.Errorf("endgame tables do not support %s: '%s'.", b.variant.Name(), b.Fen())
+	}
+	if b.castlingRights != CastlingNone {
+		return fmt.Errorf("endgame tables do not contain positions with castling rights: '%s'.", b.Fen())
+	}
+	if popCount(b.occupied) > EndgameMaxPieces {
+		return fmt.Errorf("endgame tables support up to %d pieces, not %d: '%s'.", EndgameMaxPieces, popCount(b.occupied), b.Fen())
+	}
+	if popCount(b.kings&b.occupiedCo[White]) != 1 || popCount(b.kings&b.occupiedCo[Black]) != 1 {
+		return fmt.Errorf("endgame tables need exactly one king of each color: '%s'.", b.Fen())
+	}
+	return nil
+}
+
+// Gets the value of the position, including en-passant.
+func (tb *EndgameTablebase) probe(b *Bitboard) (uint16, error) {
+	pieces := []endgamePiece{}
+	for squares := b.occupied; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		piece := endgamePiece{White, b.pieces[square], square}
+		if b.occupiedCo[Black]&BBSquares[square] != 0 {
+			piece.color = Black
+		}
+		pieces = append(pieces, piece)
+	}
+
+	value, err := tb.lookup(b.turn, pieces)
+	if err != nil {
+		return 0, err
+	}
+	if value == endgameIllegal {
+		return 0, fmt.Errorf("illegal position for endgame table: '%s'.", b.Fen())
+	}
+	if b.epSquare == 0 {
+		return value, nil
+	}
+
+	// Now handle en-passant, which the tables do not know about.
+	moves := b.GenerateLegalMoves(true, true, true, true, true, true, true)
+	best, found, onlyEnPassant := endgameDraw, false, true
+	for _, move := range moves {
+		if !b.IsEnPassant(move) {
+			onlyEnPassant = false
+			continue
+		}
+
+		b.Push(move)
+		v, err := tb.probe(b)
+		b.Pop()
+		if err != nil {
+			return 0, err
+		}
+
+		v = endgameParent(v)
+		if !found || endgameBetter(v, best) {
+			best, found = v, true
+		}
+	}
+
+	if found && (onlyEnPassant || endgameBetter(best, value)) {
+		return best, nil
+	}
+	return value, nil
+}
+
+// Probes the depth to mate in plies, from the point of view of the side to
+// move. The value is positive if the side to move mates, negative if it
+// gets mated and `0` for draws. A checkmated side also gets `0`.
+//
+// The 50-move rule is not taken into account.
+func (tb *EndgameTablebase) Probe(board *Bitboard) (int, error) {
+	if err := tb.checkPosition(board); err != nil {
+		return 0, err
+	}
+
+	tb.mutex.RLock()
+	defer tb.mutex.RUnlock()
+
+	value, err := tb.probe(board)
+	if err != nil {
+		return 0, err
+	}
+	if value == endgameDraw {
+		return 0, nil
+	} else if value%2 == 1 {
+		return int(value), nil
+	}
+	return -int(value - 2), nil
+}
+
+// Probes if the side to move wins (`1`), draws (`0`) or loses (`-1`),
+// with perfect play. A checkmated side loses.
+func (tb *EndgameTablebase) ProbeWDL(board *Bitboard) (int, error) {
+	if err := tb.checkPosition(board); err != nil {
+		return 0, err
+	}
+
+	tb.mutex.RLock()
+	defer tb.mutex.RUnlock()
+
+	value, err := tb.probe(board)
+	if err != nil {
+		return 0, err
+	}
+	if value == endgameDraw {
+		return 0, nil
+	} else if value%2 == 1 {
+		return 1, nil
+	}
+	return -1, nil
+}
+
+// Gets a line of perfect play until checkmate. The winning side mates as
+// fast as possible and the losing side delays it as long as possible.
+// Drawn positions have an empty line.
+//
+// Tables for all materials reached by captures and promotions along the
+// way must be available.
+func (tb *EndgameTablebase) PerfectLine(board *Bitboard) ([]*Move, error) {
+	if err := tb.checkPosition(board); err != nil {
+		return nil, err
+	}
+
+	tb.mutex.RLock()
+	defer tb.mutex.RUnlock()
+
+	line := []*Move{}
+	defer func() {
+		for range line {
+			board.Pop()
+		}
+	}()
+
+	for {
+		value, err := tb.probe(board)
+		if err != nil {
+			return nil, err
+		}
+		if value == endgameDraw || value == 2 {
+			break
+		}
+
+		var best *Move
+		for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			board.Push(move)
+			v, err := tb.probe(board)
+			board.Pop()
+			if err != nil {
+				return nil, err
+			}
+			if endgameParent(v) == value {
+				best = move
+				break
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("inconsistent endgame table at '%s'.", board.Fen())
+		}
+
+		board.Push(best)
+		line = append(line, best)
+	}
+
+	return append([]*Move{}, line...), nil
+}
+
+// Writes the table of the given material.
+//
+// A table file starts with the magic bytes `ETB1`, the length and the name
+// of the material, the number of bytes per value and the number of values
+// as a little endian 32 bit integer. The values follow, compressed with
+// DEFLATE.
+func (tb *EndgameTablebase) WriteTable(material string, w io.Writer) error {
+	tb.mutex.RLock()
+	defer tb.mutex.RUnlock()
+
+	t, ok := tb.tables[material]
+	if !ok {
+		return fmt.Errorf("did not find endgame table for %s.", material)
+	}
+
+	width := 1
+	for _, value := range t.values {
+		if value != endgameIllegal && value >= 0xff {
+			width = 2
+			break
+		}
+	}
+
+	header := append([]byte{}, endgameMagic[:]...)
+	header = append(header, byte(len(t.material)))
+	header = append(header, t.material...)
+	header = append(header, byte(width))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(t.values)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	compressor, err := flate.NewWriter(w, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, 4096)
+	for _, value := range t.values {
+		if width == 1 {
+			buf = append(buf, byte(value))
+		} else {
+			buf = binary.LittleEndian.AppendUint16(buf, value)
+		}
+		if len(buf) >= 4094 {
+			if _, err := compressor.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	if _, err := compressor.Write(buf); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// Reads a table written by `WriteTable()`. Returns the material of the
+// table.
+func (tb *EndgameTablebase) ReadTable(r io.Reader) (string, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", err
+	}
+	if [4]byte{header[0], header[1], header[2], header[3]} != endgameMagic {
+		return "", fmt.Errorf("invalid magic bytes for endgame table.")
+	}
+
+	name := make([]byte, int(header[4])+5)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", err
+	}
+	material := string(name[:header[4]])
+	width := int(name[header[4]])
+	count := int(binary.LittleEndian.Uint32(name[header[4]+1:]))
+
+	t, err := newEndgameTable(material)
+	if err != nil {
+		return "", err
+	}
+	if count != 2*t.perSide || (width != 1 && width != 2) {
+		return "", fmt.Errorf("invalid header for endgame table %s.", material)
+	}
+
+	data := make([]byte, count*width)
+	if _, err := io.ReadFull(flate.NewReader(r), data); err != nil {
+		return "", err
+	}
+
+	t.values = make([]uint16, count)
+	for i := range t.values {
+		if width == 1 {
+			t.values[i] = uint16(data[i])
+			if data[i] == 0xff {
+				t.values[i] = endgameIllegal
+			}
+		} else {
+			t.values[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+	}
+
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	tb.tables[material] = t
+	return material, nil
+}
+
+// Writes all available tables to the given directory, like
+// `KQvK.etb`. Returns the number of tables written.
+func (tb *EndgameTablebase) SaveDirectory(directory string) (int, error) {
+	count := 0
+	for _, material := range tb.Materials() {
+		file, err := os.Create(filepath.Join(directory, material+endgameExtension))
+		if err != nil {
+			return count, err
+		}
+
+		err = tb.WriteTable(material, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Loads the tables in the given directory. Other files are ignored.
+// Returns the number of tables found.
+func (tb *EndgameTablebase) AddDirectory(directory string) (int, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), endgameExtension)
+		if entry.IsDir() || name == entry.Name() || !endgameMaterialRegex.MatchString(name) {
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return count, err
+		}
+		_, err = tb.ReadTable(file)
+		file.Close()
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
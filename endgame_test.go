@@ -0,0 +1,197 @@
+package chess
+
+import (
+	"bytes"
+	"testing"
+)
+
+func generateTestEndgame(t *testing.T, materials ...string) *EndgameTablebase {
+	tablebase := NewEndgameTablebase()
+	for _, material := range materials {
+		if err := tablebase.Generate(material); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tablebase
+}
+
+func TestEndgameProbe(t *testing.T) {
+	tablebase := generateTestEndgame(t, "KQvK", "KRvK")
+
+	tests := []struct {
+		fen string
+		dtm int
+		wdl int
+	}{
+		// Mate in one, also mirrored and with colors swapped.
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", 1, 1},
+		{"7k/8/6K1/8/8/8/8/R7 w - - 0 1", 1, 1},
+		{"K7/8/1k6/8/8/8/8/6q1 b - - 0 1", 1, 1},
+		// Checkmated and stalemated.
+		{"k6R/8/1K6/8/8/8/8/8 b - - 0 1", 0, -1},
+		{"k7/8/1Q6/8/8/8/8/7K b - - 0 1", 0, 0},
+		// The only move runs into mate.
+		{"k7/7R/1K6/8/8/8/8/8 b - - 0 1", -2, -1},
+		// The queen is lost.
+		{"8/8/8/8/8/2k5/8/Kq6 w - - 0 1", 0, 0},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if dtm, err := tablebase.Probe(board); err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+		} else if dtm != test.dtm {
+			t.Errorf("%s: expected dtm %d, got %d", test.fen, test.dtm, dtm)
+		}
+		if wdl, err := tablebase.ProbeWDL(board); err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+		} else if wdl != test.wdl {
+			t.Errorf("%s: expected wdl %d, got %d", test.fen, test.wdl, wdl)
+		}
+	}
+
+	// Known longest mates: 10 moves for KQvK and 16 for KRvK.
+	longest := map[string]uint16{"KQvK": 19, "KRvK": 31}
+	for material, expected := range longest {
+		max := uint16(0)
+		for _, value := range tablebase.tables[material].values {
+			if value != endgameIllegal && value%2 == 1 && value > max {
+				max = value
+			}
+		}
+		if max != expected {
+			t.Errorf("%s: expected the longest win in %d plies, got %d", material, expected, max)
+		}
+	}
+}
+
+func TestEndgameProbeErrors(t *testing.T) {
+	tablebase := generateTestEndgame(t, "KQvK")
+
+	fens := []string{
+		// Missing table.
+		"8/8/8/3k4/8/8/8/KR6 w - - 0 1",
+		// Castling rights.
+		"4k3/8/8/8/8/8/8/R3K3 w Q - 0 1",
+		// Too many pieces.
+		"4k3/8/8/8/8/8/8/RQBNK3 w - - 0 1",
+	}
+	for _, fen := range fens {
+		if _, err := tablebase.Probe(NewBitboard(fen)); err == nil {
+			t.Errorf("%s: expected an error", fen)
+		}
+	}
+
+	if _, err := tablebase.Probe(NewVariantBitboard(Atomic, "8/8/8/3k4/8/8/8/KQ6 w - - 0 1")); err == nil {
+		t.Error("expected an error for a variant")
+	}
+	if err := tablebase.Generate("KQQQvK"); err == nil {
+		t.Error("expected an error for too many pieces")
+	}
+}
+
+func TestEndgamePerfectLine(t *testing.T) {
+	tablebase := generateTestEndgame(t, "KQvK", "KRvK")
+
+	fens := []string{
+		"8/8/8/3k4/8/8/8/KQ6 w - - 0 1",
+		"8/8/8/3k4/8/8/8/KR6 w - - 0 1",
+		"8/8/8/3k4/8/8/8/KR6 b - - 0 1",
+	}
+	for _, fen := range fens {
+		board := NewBitboard(fen)
+		dtm, err := tablebase.Probe(board)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := tablebase.PerfectLine(board)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board.Fen() != fen {
+			t.Errorf("%s: board changed to '%s'", fen, board.Fen())
+		}
+
+		// The line is as long as the distance to mate.
+		if len(line) != dtm && len(line) != -dtm {
+			t.Errorf("%s: expected a line of %d plies, got %d", fen, dtm, len(line))
+		}
+		for _, move := range line {
+			if !board.IsLegal(move) {
+				t.Fatalf("%s: illegal move %s in the line", fen, move.Uci())
+			}
+			board.Push(move)
+		}
+		if !board.IsCheckmate() {
+			t.Errorf("%s: line ends in '%s' without mate", fen, board.Fen())
+		}
+	}
+
+	// No line for a draw.
+	line, err := tablebase.PerfectLine(NewBitboard("8/8/8/8/8/2k5/8/Kq6 w - - 0 1"))
+	if err != nil || len(line) != 0 {
+		t.Errorf("expected an empty line for a draw, got %v, %v", line, err)
+	}
+}
+
+func TestEndgameReadWriteTable(t *testing.T) {
+	tablebase := generateTestEndgame(t, "KRvK")
+
+	var buf bytes.Buffer
+	if err := tablebase.WriteTable("KRvK", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := tablebase.WriteTable("KQvK", &buf); err == nil {
+		t.Error("expected an error for a missing table")
+	}
+
+	loaded := NewEndgameTablebase()
+	material, err := loaded.ReadTable(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if material != "KRvK" {
+		t.Errorf("expected KRvK, got %s", material)
+	}
+
+	expected, actual := tablebase.tables["KRvK"].values, loaded.tables["KRvK"].values
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d values, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("value %d: expected %d, got %d", i, expected[i], actual[i])
+		}
+	}
+
+	// Corrupted headers.
+	data := buf.Bytes()
+	for _, corrupt := range [][]byte{
+		append([]byte("ETB0"), data[4:]...),
+		data[:6],
+		append(append([]byte{}, data[:4]...), append([]byte{4, 'K', 'v', 'K', 'Q'}, data[9:]...)...),
+	} {
+		if _, err := NewEndgameTablebase().ReadTable(bytes.NewReader(corrupt)); err == nil {
+			t.Errorf("expected an error for %q", corrupt[:10])
+		}
+	}
+
+	// Through a directory.
+	directory := t.TempDir()
+	if n, err := tablebase.SaveDirectory(directory); err != nil || n != 2 {
+		t.Fatalf("expected to save 2 tables, got %d, %v", n, err)
+	}
+	loaded = NewEndgameTablebase()
+	if n, err := loaded.AddDirectory(directory); err != nil || n != 2 {
+		t.Fatalf("expected to load 2 tables, got %d, %v", n, err)
+	}
+	if materials := loaded.Materials(); len(materials) != 2 || materials[0] != "KRvK" || materials[1] != "KvK" {
+		t.Errorf("unexpected materials %v", materials)
+	}
+	board := NewBitboard("8/8/8/3k4/8/8/8/KR6 w - - 0 1")
+	expectedDtm, _ := tablebase.Probe(board)
+	if dtm, err := loaded.Probe(board); err != nil || dtm != expectedDtm {
+		t.Errorf("expected dtm %d after loading, got %d, %v", expectedDtm, dtm, err)
+	}
+}
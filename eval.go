@@ -0,0 +1,448 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Evaluates positions statically, without searching.
+type Evaluator interface {
+	// Gets the score of the position in centipawns, from the point of view
+	// of the side to move.
+	Evaluate(board *Bitboard) int
+}
+
+// Adapts a function to the `Evaluator` interface.
+type EvaluatorFunc func(board *Bitboard) int
+
+func (f EvaluatorFunc) Evaluate(board *Bitboard) int {
+	return f(board)
+}
+
+// A score for the midgame and for the endgame. The score of a position is
+// interpolated between both by the game phase.
+type TaperedScore struct {
+	Midgame int
+	Endgame int
+}
+
+func (s TaperedScore) add(other TaperedScore) TaperedScore {
+	return TaperedScore{s.Midgame + other.Midgame, s.Endgame + other.Endgame}
+}
+
+func (s TaperedScore) sub(other TaperedScore) TaperedScore {
+	return TaperedScore{s.Midgame - other.Midgame, s.Endgame - other.Endgame}
+}
+
+// Interpolates the score for the given phase.
+func (s TaperedScore) Taper(phase int) int {
+	if phase > MaxPhase {
+		phase = MaxPhase
+	}
+	return (s.Midgame*phase + s.Endgame*(MaxPhase-phase)) / MaxPhase
+}
+
+// The phase with all pieces on the board. Each knight and bishop counts
+// `1`, each rook `2` and each queen `4`. The phase is `0` once only kings
+// and pawns are left.
+const MaxPhase = 24
+
+var phaseWeights = [...]int{None: 0, Pawn: 0, Knight: 1, Bishop: 1, Rook: 2, Queen: 4, King: 0}
+
+// Terms of `DefaultEvaluator`.
+type EvalTerm int
+
+const (
+	EvalMaterial EvalTerm = iota
+	EvalPieceSquares
+	EvalMobility
+	EvalPawnStructure
+	EvalKingSafety
+	evalTerms
+)
+
+var EvalTermNames = [...]string{
+	EvalMaterial:      "Material",
+	EvalPieceSquares:  "Piece squares",
+	EvalMobility:      "Mobility",
+	EvalPawnStructure: "Pawn structure",
+	EvalKingSafety:    "King safety",
+}
+
+var pieceValues = [...]TaperedScore{
+	None:   {0, 0},
+	Pawn:   {100, 120},
+	Knight: {320, 300},
+	Bishop: {330, 320},
+	Rook:   {500, 530},
+	Queen:  {900, 950},
+	King:   {0, 0},
+}
+
+// Piece-square tables for the midgame and the endgame, from the point of
+// view of white, starting with a8.
+var pieceSquareTables = [7][2][64]int{
+	Pawn: {{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}, {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		60, 60, 60, 60, 60, 60, 60, 60,
+		40, 40, 40, 40, 40, 40, 40, 40,
+		25, 25, 25, 25, 25, 25, 25, 25,
+		15, 15, 15, 15, 15, 15, 15, 15,
+		5, 5, 5, 5, 5, 5, 5, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}},
+	Knight: {{
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	}, {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	}},
+	Bishop: {{
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	}, {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	}},
+	Rook: {{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	}, {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}},
+	Queen: {{
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	}, {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	}},
+	King: {{
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	}, {
+		-50, -40, -30, -20, -20, -30, -40, -50,
+		-30, -20, -10, 0, 0, -10, -20, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -30, 0, 0, 0, 0, -30, -30,
+		-50, -30, -30, -30, -30, -30, -30, -50,
+	}},
+}
+
+// Bonus per attacked square not occupied by own pieces, and the number of
+// squares an average piece attacks.
+var mobilityWeights = [...]TaperedScore{Knight: {4, 4}, Bishop: {5, 5}, Rook: {2, 4}, Queen: {1, 2}}
+var mobilityBase = [...]int{Knight: 4, Bishop: 6, Rook: 7, Queen: 13}
+
+var (
+	doubledPawnPenalty  = TaperedScore{-10, -20}
+	isolatedPawnPenalty = TaperedScore{-10, -15}
+
+	// Bonus for passed pawns by the rank, from the point of view of the
+	// pawn.
+	passedPawnBonus = [8]TaperedScore{{0, 0}, {5, 10}, {10, 20}, {15, 35}, {25, 60}, {40, 100}, {60, 150}, {0, 0}}
+
+	// Bonus for each pawn shielding the king, only in the midgame.
+	pawnShieldBonus = 10
+
+	// Penalty for each attack on a square next to the king, by the type
+	// of the attacker. Only in the midgame.
+	kingAttackWeights = [...]int{None: 0, Pawn: 1, Knight: 4, Bishop: 4, Rook: 6, Queen: 10, King: 0}
+)
+
+// Squares in front of a pawn on its file and the adjacent files, which
+// must be free of opposing pawns for it to be passed.
+var passedPawnMasks [2][64]uint64
+
+func init() {
+	for square := 0; square < 64; square++ {
+		file, rank := square&7, square>>3
+		for r := 0; r < 8; r++ {
+			for f := file - 1; f <= file+1; f++ {
+				if f < 0 || f > 7 {
+					continue
+				}
+				if r > rank {
+					passedPawnMasks[White][square] |= 1 << uint(r*8+f)
+				} else if r < rank {
+					passedPawnMasks[Black][square] |= 1 << uint(r*8+f)
+				}
+			}
+		}
+	}
+}
+
+// Updates the incremental terms when a piece is put onto (`sign` is `1`)
+// or removed from (`sign` is `-1`) the given square.
+func (b *Bitboard) updateEval(pieceType PieceTypes, color Colors, square int, sign int) {
+	index := square
+	if color == White {
+		index ^= 070
+	}
+
+	value := pieceValues[pieceType]
+	b.material[color].Midgame += sign * value.Midgame
+	b.material[color].Endgame += sign * value.Endgame
+	b.pieceSquares[color].Midgame += sign * pieceSquareTables[pieceType][0][index]
+	b.pieceSquares[color].Endgame += sign * pieceSquareTables[pieceType][1][index]
+	b.phase += sign * phaseWeights[pieceType]
+}
+
+// Recomputes the incremental terms from scratch.
+func (b *Bitboard) resetEval() {
+	b.material = [2]TaperedScore{}
+	b.pieceSquares = [2]TaperedScore{}
+	b.phase = 0
+	for squares := b.occupied; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		b.updateEval(b.pieces[square], b.CheckSquareColor(square), square, 1)
+	}
+}
+
+// Gets the game phase, from `MaxPhase` in the opening to `0` in pawn
+// endgames. Promotions can push it above `MaxPhase`.
+func (b *Bitboard) Phase() int {
+	return b.phase
+}
+
+// The evaluation of a position broken down into terms.
+type Evaluation struct {
+	// The game phase the scores were tapered with.
+	Phase int
+
+	// The scores of each term for white and black.
+	Terms [evalTerms][2]TaperedScore
+
+	// The total in centipawns, from the point of view of the side to move.
+	Score int
+}
+
+// Gets the tapered score of the term, from the point of view of white.
+func (e *Evaluation) Term(term EvalTerm) int {
+	return e.Terms[term][White].sub(e.Terms[term][Black]).Taper(e.Phase)
+}
+
+// Formats the breakdown as a table.
+func (e *Evaluation) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%-16s|  White MG   EG |  Black MG   EG |  Total\n", "Term")
+	for term := EvalMaterial; term < evalTerms; term++ {
+		white, black := e.Terms[term][White], e.Terms[term][Black]
+		fmt.Fprintf(&s, "%-16s| %8d %4d | %8d %4d | %6d\n", EvalTermNames[term], white.Midgame, white.Endgame, black.Midgame, black.Endgame, e.Term(term))
+	}
+	fmt.Fprintf(&s, "Phase %d/%d, score %d for the side to move\n", e.Phase, MaxPhase, e.Score)
+	return s.String()
+}
+
+// The built in evaluation.
+//
+// Material and piece-square values are tapered between the midgame and
+// the endgame by the game phase. They are kept up to date by the board
+// as moves are pushed and popped. Mobility, pawn structure and king safety
+// are computed on demand.
+//
+//     board := chess.NewBitboard("")
+//     score := chess.DefaultEvaluator{}.Evaluate(board)
+//     fmt.Print(chess.DefaultEvaluator{}.Explain(board))
+type DefaultEvaluator struct{}
+
+func (e DefaultEvaluator) Evaluate(board *Bitboard) int {
+	return e.Explain(board).Score
+}
+
+// Evaluates the position and gives the score of each term.
+func (DefaultEvaluator) Explain(board *Bitboard) *Evaluation {
+	result := &Evaluation{Phase: board.phase}
+	if result.Phase > MaxPhase {
+		result.Phase = MaxPhase
+	}
+
+	total := TaperedScore{}
+	for color := White; color <= Black; color++ {
+		result.Terms[EvalMaterial][color] = board.material[color]
+		result.Terms[EvalPieceSquares][color] = board.pieceSquares[color]
+		result.Terms[EvalMobility][color] = board.mobility(color)
+		result.Terms[EvalPawnStructure][color] = board.pawnStructure(color)
+		result.Terms[EvalKingSafety][color] = board.kingSafety(color)
+
+		for term := EvalMaterial; term < evalTerms; term++ {
+			if color == White {
+				total = total.add(result.Terms[term][color])
+			} else {
+				total = total.sub(result.Terms[term][color])
+			}
+		}
+	}
+
+	result.Score = total.Taper(result.Phase)
+	if board.turn == Black {
+		result.Score = -result.Score
+	}
+	return result
+}
+
+func (b *Bitboard) mobility(color Colors) TaperedScore {
+	score := TaperedScore{}
+	for squares := b.occupiedCo[color] &^ (b.pawns | b.kings); squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		pieceType := b.pieces[square]
+
+		var attacks uint64
+		switch pieceType {
+		case Knight:
+			attacks = b.KnightAttacksFrom(square)
+		case Bishop:
+			attacks = b.BishopAttacksFrom(square)
+		case Rook:
+			attacks = b.RookAttacksFrom(square)
+		case Queen:
+			attacks = b.QueenAttacksFrom(square)
+		}
+
+		count := popCount(attacks&^b.occupiedCo[color]) - mobilityBase[pieceType]
+		score.Midgame += count * mobilityWeights[pieceType].Midgame
+		score.Endgame += count * mobilityWeights[pieceType].Endgame
+	}
+	return score
+}
+
+func (b *Bitboard) pawnStructure(color Colors) TaperedScore {
+	score := TaperedScore{}
+	pawns := b.pawns & b.occupiedCo[color]
+	opposingPawns := b.pawns & b.occupiedCo[color^1]
+
+	for file := 0; file < 8; file++ {
+		count := popCount(pawns & BBFiles[file])
+		if count == 0 {
+			continue
+		}
+
+		if count > 1 {
+			score.Midgame += (count - 1) * doubledPawnPenalty.Midgame
+			score.Endgame += (count - 1) * doubledPawnPenalty.Endgame
+		}
+
+		neighbours := BBVoid
+		if file > 0 {
+			neighbours |= BBFiles[file-1]
+		}
+		if file < 7 {
+			neighbours |= BBFiles[file+1]
+		}
+		if pawns&neighbours == 0 {
+			score.Midgame += count * isolatedPawnPenalty.Midgame
+			score.Endgame += count * isolatedPawnPenalty.Endgame
+		}
+	}
+
+	for squares := pawns; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		if passedPawnMasks[color][square]&opposingPawns != 0 {
+			continue
+		}
+
+		rank := rankIndex(square)
+		if color == Black {
+			rank = 7 - rank
+		}
+		score = score.add(passedPawnBonus[rank])
+	}
+
+	return score
+}
+
+func (b *Bitboard) kingSafety(color Colors) TaperedScore {
+	kings := b.kings & b.occupiedCo[color]
+	if kings == 0 {
+		return TaperedScore{}
+	}
+	king := lsb(kings)
+	zone := b.KingAttacksFrom(king) | BBSquares[king]
+
+	// Own pawns in front of the king.
+	shield := zone & b.pawns & b.occupiedCo[color]
+	if color == White {
+		shield &^= BBRanks[0]
+		shield &= ^uint64(0) << uint(king&^7+8)
+	} else {
+		shield &= ^uint64(0) >> uint(64-king&^7)
+	}
+
+	penalty := 0
+	for squares := zone; squares != 0; squares &= squares - 1 {
+		for attackers := b.AttackerMask(color^1, lsb(squares)); attackers != 0; attackers &= attackers - 1 {
+			penalty += kingAttackWeights[b.pieces[lsb(attackers)]]
+		}
+	}
+
+	return TaperedScore{popCount(shield)*pawnShieldBonus - penalty, 0}
+}
@@ -0,0 +1,107 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+// Gets the position with the ranks flipped and the colors swapped.
+func mirrorBoard(board *Bitboard) *Bitboard {
+	mirrored := NewBitboard("")
+	mirrored.Clear()
+	for square := range Squares {
+		if piece := board.PieceAt(square); piece != nil {
+			mirrored.SetPieceAt(square^070, NewPiece(piece.pieceType, piece.color^1))
+		}
+	}
+	mirrored.turn = board.turn ^ 1
+	return mirrored
+}
+
+var evalTestFens = []string{
+	StartingFen,
+	"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	"6k1/5ppp/8/2P5/8/8/5PPP/6K1 b - - 0 1",
+}
+
+func TestEvaluateSymmetry(t *testing.T) {
+	evaluator := DefaultEvaluator{}
+
+	for _, fen := range []string{StartingFen, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1"} {
+		if score := evaluator.Evaluate(NewBitboard(fen)); score != 0 {
+			t.Errorf("%s: expected 0, got %d", fen, score)
+		}
+	}
+
+	for _, fen := range evalTestFens {
+		board := NewBitboard(fen)
+		mirrored := mirrorBoard(board)
+		if score, mirroredScore := evaluator.Evaluate(board), evaluator.Evaluate(mirrored); score != mirroredScore {
+			t.Errorf("%s: %d, but %d for %s", fen, score, mirroredScore, mirrored.Fen())
+		}
+	}
+}
+
+func TestEvaluateIncremental(t *testing.T) {
+	evaluator := DefaultEvaluator{}
+	check := func(board *Bitboard, context string) {
+		t.Helper()
+		fresh := NewVariantBitboard(board.Variant(), board.Fen())
+		if board.material != fresh.material || board.pieceSquares != fresh.pieceSquares || board.phase != fresh.phase {
+			t.Errorf("%s: incremental terms differ from '%s'", context, board.Fen())
+		}
+		if score, freshScore := evaluator.Evaluate(board), evaluator.Evaluate(fresh); score != freshScore {
+			t.Errorf("%s: %d, but %d from scratch", context, score, freshScore)
+		}
+	}
+
+	boards := []*Bitboard{
+		NewVariantBitboard(Crazyhouse, "r1bqkbnr/ppp2ppp/2np4/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R[Pp] w KQkq - 0 4"),
+		NewBitboard("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3"),
+		NewBitboard("r3k2r/pPppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"),
+	}
+	for _, fen := range evalTestFens {
+		boards = append(boards, NewBitboard(fen))
+	}
+
+	for _, board := range boards {
+		fen := board.Fen()
+		for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			board.Push(move)
+			check(board, fen+" "+move.Uci())
+			board.Pop()
+			check(board, fen+" "+move.Uci()+" popped")
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	board := NewBitboard("6k1/5ppp/8/2P5/8/8/5PPP/6K1 b - - 0 1")
+	evaluation := DefaultEvaluator{}.Explain(board)
+
+	if evaluation.Phase != 0 || board.Phase() != 0 {
+		t.Errorf("expected phase 0 without pieces, got %d", evaluation.Phase)
+	}
+	if evaluation.Term(EvalMaterial) != 120 {
+		t.Errorf("expected a pawn up in the endgame, got %d", evaluation.Term(EvalMaterial))
+	}
+	if evaluation.Term(EvalPawnStructure) <= 0 {
+		t.Errorf("expected the passed pawn to count for white, got %d", evaluation.Term(EvalPawnStructure))
+	}
+	if evaluation.Score >= 0 {
+		t.Errorf("expected black to stand worse, got %d", evaluation.Score)
+	}
+
+	s := evaluation.String()
+	for _, name := range EvalTermNames {
+		if !strings.Contains(s, name) {
+			t.Errorf("expected '%s' in the breakdown:\n%s", name, s)
+		}
+	}
+
+	if phase := NewBitboard(StartingFen).Phase(); phase != MaxPhase {
+		t.Errorf("expected phase %d at the start, got %d", MaxPhase, phase)
+	}
+}
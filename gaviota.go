@@ -0,0 +1,901 @@
+package chess
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The maximum number of pieces supported by the Gaviota tables.
+const GaviotaMaxPieces = 5
+
+const gaviotaExtension = ".gtb.cp4"
+
+// Results as stored in the tables, relative to white and black.
+const (
+	gaviotaDraw   = 0
+	gaviotaWMate  = 1
+	gaviotaBMate  = 2
+	gaviotaForbid = 3
+)
+
+const (
+	gaviotaMaxKKIndex  = 462
+	gaviotaMaxPPIndex  = 576
+	gaviotaMaxPpIndex  = 24 * 48
+	gaviotaMaxAAIndex  = 2016
+	gaviotaMaxAAAIndex = 64 * 21 * 31
+)
+
+// The number of decompressed blocks kept in memory.
+const gaviotaCacheSize = 64
+
+var gaviotaKKIdx [64][64]int
+var gaviotaAAIdx [64][64]int
+var gaviotaPPIdx [24][48]int
+var gaviotaAAABase [64]int
+var gaviotaFlipType [64][64]int
+
+func init() {
+	for x := range gaviotaKKIdx {
+		for y := range gaviotaKKIdx[x] {
+			gaviotaKKIdx[x][y] = -1
+			gaviotaAAIdx[x][y] = -1
+		}
+	}
+
+	// Two kings, normalized so that the first one (the black king) is in
+	// the a1-d1-d4 triangle.
+	idx := 0
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			if gaviotaAdjacent(x, y) {
+				continue
+			}
+
+			i, j := gaviotaNormalizeKings(x, y)
+			if gaviotaKKIdx[i][j] == -1 {
+				gaviotaKKIdx[i][j] = idx
+				gaviotaKKIdx[x][y] = idx
+				idx++
+			} else {
+				gaviotaKKIdx[x][y] = gaviotaKKIdx[i][j]
+			}
+		}
+	}
+
+	// Two identical pieces.
+	idx = 0
+	for x := 0; x < 64; x++ {
+		for y := x + 1; y < 64; y++ {
+			gaviotaAAIdx[x][y] = idx
+			gaviotaAAIdx[y][x] = idx
+			idx++
+		}
+	}
+
+	// Two white pawns, normalized so that the anchor pawn is on the queen
+	// side.
+	for i := range gaviotaPPIdx {
+		for j := range gaviotaPPIdx[i] {
+			gaviotaPPIdx[i][j] = -1
+		}
+	}
+	idx = 0
+	for a := H7; a >= A2; a-- {
+		if fileIndex(a) < 4 {
+			continue
+		}
+
+		for b := a - 1; b >= A2; b-- {
+			anchor, loosen := gaviotaAnchorFirst(a, b)
+			if fileIndex(anchor) > 3 {
+				anchor = gaviotaFlipWE(anchor)
+				loosen = gaviotaFlipWE(loosen)
+			}
+
+			i, j := gaviotaPawnIdx24(anchor), gaviotaPawnIdx48(loosen)
+			if gaviotaPPIdx[i][j] == -1 {
+				gaviotaPPIdx[i][j] = idx
+				idx++
+			}
+		}
+	}
+
+	// Three identical pieces.
+	accum := 0
+	for a := 0; a < 63; a++ {
+		accum += a * (a - 1) / 2
+		gaviotaAAABase[a+1] = accum
+	}
+
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			gaviotaFlipType[x][y] = gaviotaCalcFlipType(x, y)
+		}
+	}
+}
+
+// Checks if two squares are equal or next to each other.
+func gaviotaAdjacent(x, y int) bool {
+	dx, dy := fileIndex(x)-fileIndex(y), rankIndex(x)-rankIndex(y)
+	return dx >= -1 && dx <= 1 && dy >= -1 && dy <= 1
+}
+
+func gaviotaFlipWE(square int) int {
+	return square ^ 07
+}
+
+func gaviotaFlipNS(square int) int {
+	return square ^ 070
+}
+
+func gaviotaFlipNWSE(square int) int {
+	return (square&07)<<3 | square>>3
+}
+
+func gaviotaNormalizeKings(x, y int) (int, int) {
+	if fileIndex(x) > 3 {
+		x, y = gaviotaFlipWE(x), gaviotaFlipWE(y)
+	}
+	if rankIndex(x) > 3 {
+		x, y = gaviotaFlipNS(x), gaviotaFlipNS(y)
+	}
+	rowX, colX := rankIndex(x), fileIndex(x)
+	if rowX > colX {
+		x, y = gaviotaFlipNWSE(x), gaviotaFlipNWSE(y)
+	}
+	if rowX == colX && rankIndex(y) > fileIndex(y) {
+		x, y = gaviotaFlipNWSE(x), gaviotaFlipNWSE(y)
+	}
+	return x, y
+}
+
+// Gets the flips that move `x` into the a1-d1-d4 triangle, and `y` below
+// the diagonal if `x` is on it. Bit 1 is a horizontal flip, bit 2 a
+// vertical flip and bit 4 a flip at the a1-h8 diagonal.
+func gaviotaCalcFlipType(x, y int) int {
+	result := 0
+	if fileIndex(x) > 3 {
+		x, y = gaviotaFlipWE(x), gaviotaFlipWE(y)
+		result |= 1
+	}
+	if rankIndex(x) > 3 {
+		x, y = gaviotaFlipNS(x), gaviotaFlipNS(y)
+		result |= 2
+	}
+	rowX, colX := rankIndex(x), fileIndex(x)
+	if rowX > colX {
+		x, y = gaviotaFlipNWSE(x), gaviotaFlipNWSE(y)
+		result |= 4
+	}
+	if rowX == colX && rankIndex(y) > fileIndex(y) {
+		result |= 4
+	}
+	return result
+}
+
+// Orders two white pawns. The anchor is the more advanced one, or on the
+// same rank the one closer to the center.
+func gaviotaAnchorFirst(a, b int) (int, int) {
+	rowA, rowB := a&070, b&070
+	if rowB > rowA {
+		return b, a
+	} else if rowB < rowA {
+		return a, b
+	}
+
+	hi := func(square int) int {
+		col := square & 07
+		x := 1<<uint(col) | 1<<uint(col^07)
+		return x & (x - 1)
+	}
+	if hi(b) > hi(a) {
+		return b, a
+	} else if hi(b) < hi(a) {
+		return a, b
+	}
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+// Index of a white pawn on the queen side, starting with a7.
+func gaviotaPawnIdx24(pawn int) int {
+	square := (pawn ^ 070) - 8
+	return (square + square&3) >> 1
+}
+
+// Index of a white pawn, starting with a7.
+func gaviotaPawnIdx48(pawn int) int {
+	return (pawn ^ 070) - 8
+}
+
+func gaviotaAAAIdx(x, y, z int) int {
+	return x + (y-1)*y/2 + gaviotaAAABase[z]
+}
+
+// Applies the flips to all squares.
+func gaviotaFlip(flipType int, squares []int) {
+	for i, square := range squares {
+		if flipType&1 != 0 {
+			square = gaviotaFlipWE(square)
+		}
+		if flipType&2 != 0 {
+			square = gaviotaFlipNS(square)
+		}
+		if flipType&4 != 0 {
+			square = gaviotaFlipNWSE(square)
+		}
+		squares[i] = square
+	}
+}
+
+// Maps the squares of the white and the black pieces, each starting with
+// the king and ordered by descending piece value, to an index. Returns -1
+// for impossible positions.
+type gaviotaIndexer func(w, b []int) int
+
+// Pawnless endgames are normalized by the position of the kings.
+func gaviotaPiecesIndexer(index func(ki int, w, b []int) int) gaviotaIndexer {
+	return func(w, b []int) int {
+		ws := append([]int{}, w...)
+		bs := append([]int{}, b...)
+		flipType := gaviotaFlipType[bs[0]][ws[0]]
+		gaviotaFlip(flipType, ws)
+		gaviotaFlip(flipType, bs)
+
+		ki := gaviotaKKIdx[bs[0]][ws[0]]
+		if ki == -1 {
+			return -1
+		}
+		return index(ki, ws, bs)
+	}
+}
+
+// Endgames with a single pawn are normalized by moving the pawn to the
+// queen side. The index of the pawn is computed from the point of view of
+// its own color.
+func gaviotaPawnIndexer(white bool, index func(slice int, w, b []int) int) gaviotaIndexer {
+	return func(w, b []int) int {
+		ws := append([]int{}, w...)
+		bs := append([]int{}, b...)
+
+		pawn := ws[len(ws)-1]
+		if !white {
+			pawn = bs[len(bs)-1]
+		}
+		if pawn < A2 || pawn >= A8 {
+			return -1
+		}
+
+		if fileIndex(pawn) > 3 {
+			gaviotaFlip(1, ws)
+			gaviotaFlip(1, bs)
+			pawn = gaviotaFlipWE(pawn)
+		}
+
+		square := pawn - 8
+		if white {
+			square = (pawn ^ 070) - 8
+		}
+		return index((square+square&3)>>1, ws, bs)
+	}
+}
+
+type gaviotaScheme struct {
+	maxIndex int
+	index    gaviotaIndexer
+}
+
+// Selects the index scheme for the material of a table, given as lower-case
+// piece letters of the white and the black side, each starting with the
+// king. Returns nil for unsupported material.
+func gaviotaSchemeFor(white, black string) *gaviotaScheme {
+	kk := gaviotaMaxKKIndex
+	pawns := strings.Count(white+black, "p")
+
+	switch {
+	case len(white) == 2 && len(black) == 1:
+		// kxk, kpk
+		if pawns == 0 {
+			return &gaviotaScheme{kk * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*64 + w[1]
+			})}
+		}
+		return &gaviotaScheme{24 * 64 * 64, gaviotaPawnIndexer(true, func(slice int, w, b []int) int {
+			return slice*64*64 + w[0]*64 + b[0]
+		})}
+
+	case len(white) == 2 && len(black) == 2:
+		if pawns == 0 {
+			// kakb
+			return &gaviotaScheme{kk * 64 * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*64*64 + w[1]*64 + b[1]
+			})}
+		} else if pawns == 1 && black[1] == 'p' {
+			// kakp
+			return &gaviotaScheme{24 * 64 * 64 * 64, gaviotaPawnIndexer(false, func(slice int, w, b []int) int {
+				return slice*64*64*64 + w[0]*64*64 + b[0]*64 + w[1]
+			})}
+		} else if pawns == 2 {
+			return &gaviotaScheme{gaviotaMaxPpIndex * 64 * 64, gaviotaIndexKPKP}
+		}
+
+	case len(white) == 3 && len(black) == 1:
+		if pawns == 0 && white[1] == white[2] {
+			// kaak
+			return &gaviotaScheme{kk * gaviotaMaxAAIndex, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*gaviotaMaxAAIndex + gaviotaAAIdx[w[1]][w[2]]
+			})}
+		} else if pawns == 0 {
+			// kabk
+			return &gaviotaScheme{kk * 64 * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*64*64 + w[1]*64 + w[2]
+			})}
+		} else if pawns == 1 {
+			// kapk
+			return &gaviotaScheme{24 * 64 * 64 * 64, gaviotaPawnIndexer(true, func(slice int, w, b []int) int {
+				return slice*64*64*64 + w[0]*64*64 + b[0]*64 + w[1]
+			})}
+		} else if pawns == 2 {
+			return &gaviotaScheme{gaviotaMaxPPIndex * 64 * 64, gaviotaIndexKPPK}
+		}
+
+	case len(white) == 3 && len(black) == 2:
+		if pawns == 0 && white[1] == white[2] {
+			// kaakb
+			return &gaviotaScheme{kk * gaviotaMaxAAIndex * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*gaviotaMaxAAIndex*64 + gaviotaAAIdx[w[1]][w[2]]*64 + b[1]
+			})}
+		} else if pawns == 0 {
+			// kabkc
+			return &gaviotaScheme{kk * 64 * 64 * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*64*64*64 + w[1]*64*64 + w[2]*64 + b[1]
+			})}
+		} else if pawns == 1 && white[2] == 'p' {
+			// kapkb
+			return &gaviotaScheme{24 * 64 * 64 * 64 * 64, gaviotaPawnIndexer(true, func(slice int, w, b []int) int {
+				return slice*64*64*64*64 + w[0]*64*64*64 + b[0]*64*64 + w[1]*64 + b[1]
+			})}
+		} else if pawns == 1 && black[1] == 'p' && white[1] != white[2] {
+			// kabkp
+			return &gaviotaScheme{24 * 64 * 64 * 64 * 64, gaviotaPawnIndexer(false, func(slice int, w, b []int) int {
+				return slice*64*64*64*64 + w[0]*64*64*64 + b[0]*64*64 + w[1]*64 + w[2]
+			})}
+		}
+
+	case len(white) == 4 && len(black) == 1:
+		if pawns == 0 && white[1] == white[3] {
+			// kaaak
+			return &gaviotaScheme{kk * gaviotaMaxAAAIndex, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				a := []int{w[1], w[2], w[3]}
+				sort.Ints(a)
+				if a[0] == a[1] || a[1] == a[2] {
+					return -1
+				}
+				return ki*gaviotaMaxAAAIndex + gaviotaAAAIdx(a[0], a[1], a[2])
+			})}
+		} else if pawns == 0 && white[1] == white[2] {
+			// kaabk
+			return &gaviotaScheme{kk * gaviotaMaxAAIndex * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*gaviotaMaxAAIndex*64 + gaviotaAAIdx[w[1]][w[2]]*64 + w[3]
+			})}
+		} else if pawns == 0 && white[2] == white[3] {
+			// kabbk
+			return &gaviotaScheme{kk * gaviotaMaxAAIndex * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*gaviotaMaxAAIndex*64 + gaviotaAAIdx[w[2]][w[3]]*64 + w[1]
+			})}
+		} else if pawns == 0 {
+			// kabck
+			return &gaviotaScheme{kk * 64 * 64 * 64, gaviotaPiecesIndexer(func(ki int, w, b []int) int {
+				return ki*64*64*64 + w[1]*64*64 + w[2]*64 + w[3]
+			})}
+		} else if pawns == 1 && white[1] == white[2] {
+			// kaapk
+			return &gaviotaScheme{24 * 64 * 64 * gaviotaMaxAAIndex, gaviotaPawnIndexer(true, func(slice int, w, b []int) int {
+				return slice*64*64*gaviotaMaxAAIndex + w[0]*64*gaviotaMaxAAIndex + b[0]*gaviotaMaxAAIndex + gaviotaAAIdx[w[1]][w[2]]
+			})}
+		} else if pawns == 1 {
+			// kabpk
+			return &gaviotaScheme{24 * 64 * 64 * 64 * 64, gaviotaPawnIndexer(true, func(slice int, w, b []int) int {
+				return slice*64*64*64*64 + w[0]*64*64*64 + b[0]*64*64 + w[1]*64 + w[2]
+			})}
+		}
+	}
+
+	return nil
+}
+
+func gaviotaIndexKPPK(w, b []int) int {
+	wk, bk := w[0], b[0]
+	anchor, loosen := gaviotaAnchorFirst(w[1], w[2])
+	if fileIndex(anchor) > 3 {
+		anchor, loosen = gaviotaFlipWE(anchor), gaviotaFlipWE(loosen)
+		wk, bk = gaviotaFlipWE(wk), gaviotaFlipWE(bk)
+	}
+
+	slice := gaviotaPPIdx[gaviotaPawnIdx24(anchor)][gaviotaPawnIdx48(loosen)]
+	if slice == -1 {
+		return -1
+	}
+	return slice*64*64 + wk*64 + bk
+}
+
+func gaviotaIndexKPKP(w, b []int) int {
+	wk, bk := w[0], b[0]
+	anchor, loosen := w[1], b[1]
+	if fileIndex(anchor) > 3 {
+		anchor, loosen = gaviotaFlipWE(anchor), gaviotaFlipWE(loosen)
+		wk, bk = gaviotaFlipWE(wk), gaviotaFlipWE(bk)
+	}
+
+	return (gaviotaPawnIdx24(anchor)*48+loosen-8)*64*64 + wk*64 + bk
+}
+
+// Converts a stored value to the result relative to white and black and
+// the distance to mate in plies.
+func gaviotaUnpack(turn Colors, packed byte) (int, int) {
+	if packed == gaviotaDraw || packed == gaviotaForbid {
+		return int(packed), 0
+	}
+
+	info := int(packed & 3)
+	store := int(packed >> 2)
+
+	if turn == White {
+		switch info {
+		case gaviotaWMate:
+			return gaviotaWMate, (store+1)*2 - 1
+		case gaviotaBMate:
+			return gaviotaBMate, store * 2
+		case gaviotaDraw:
+			return gaviotaWMate, (store+1+63)*2 - 1
+		default:
+			return gaviotaBMate, (store + 63) * 2
+		}
+	}
+
+	switch info {
+	case gaviotaBMate:
+		return gaviotaBMate, (store+1)*2 - 1
+	case gaviotaWMate:
+		return gaviotaWMate, store * 2
+	case gaviotaDraw:
+		// No position needs to store 63 for a black mate, so it is used
+		// for white mates.
+		if store == 63 {
+			return gaviotaWMate, (store + 1 + 63) * 2
+		}
+		return gaviotaBMate, (store+1+63)*2 - 1
+	default:
+		return gaviotaWMate, (store + 63) * 2
+	}
+}
+
+type gaviotaTable struct {
+	path   string
+	scheme *gaviotaScheme
+
+	mutex         sync.Mutex
+	initialized   bool
+	err           error
+	file          *os.File
+	blockSize     int
+	blockOffsets  []int64
+	blocksPerSide int
+}
+
+func (t *gaviotaTable) init() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.initialized {
+		return t.err
+	}
+	t.initialized = true
+
+	t.file, t.err = os.Open(t.path)
+	if t.err != nil {
+		return t.err
+	}
+
+	var header [40]byte
+	if _, t.err = io.ReadFull(io.NewSectionReader(t.file, 0, 40), header[:]); t.err != nil {
+		return t.err
+	}
+	t.blockSize = int(binary.LittleEndian.Uint32(header[32:36]))
+	numOffsets := int(binary.LittleEndian.Uint32(header[36:40]))
+	if t.blockSize <= 0 || numOffsets <= 0 {
+		t.err = fmt.Errorf("invalid gaviota table header: '%s'.", t.path)
+		return t.err
+	}
+
+	offsets := make([]byte, 4*numOffsets)
+	if _, t.err = io.ReadFull(io.NewSectionReader(t.file, 40, int64(len(offsets))), offsets); t.err != nil {
+		return t.err
+	}
+	t.blockOffsets = make([]int64, numOffsets)
+	for i := range t.blockOffsets {
+		t.blockOffsets[i] = int64(binary.LittleEndian.Uint32(offsets[4*i:]))
+	}
+
+	t.blocksPerSide = 1 + (t.scheme.maxIndex-1)/t.blockSize
+	if 2*t.blocksPerSide >= numOffsets {
+		t.err = fmt.Errorf("gaviota table is truncated: '%s'.", t.path)
+	}
+	return t.err
+}
+
+// Reads and decompresses the given block.
+func (t *gaviotaTable) readBlock(block int, entries int) ([]byte, error) {
+	start, end := t.blockOffsets[block], t.blockOffsets[block+1]
+	if end-start < 15 {
+		return nil, fmt.Errorf("invalid block in gaviota table: '%s'.", t.path)
+	}
+
+	data := make([]byte, end-start)
+	if _, err := t.file.ReadAt(data, start); err != nil {
+		return nil, err
+	}
+
+	// A flag byte is followed by the LZMA properties and the size. Some
+	// blocks have a header for an x86 filter instead, which can be
+	// decoded with the default properties.
+	properties := byte((2*5+0)*9 + 3)
+	dictSize := uint32(4096)
+	if data[0] == 0 {
+		properties = data[2]
+		dictSize = binary.LittleEndian.Uint32(data[3:7])
+	}
+
+	return lzmaDecode(properties, dictSize, data[15:], entries)
+}
+
+type gaviotaBlockKey struct {
+	table *gaviotaTable
+	block int
+}
+
+// Probes Gaviota endgame tablebases for the depth to mate.
+//
+// Only LZMA compressed tables (`.gtb.cp4`) are supported. They are read
+// with a native decoder, so no C library is needed. Tables are opened
+// lazily on first use and recently used blocks are cached.
+//
+//     tablebase, _ := chess.OpenGaviota("data/gaviota")
+//     defer tablebase.Close()
+//
+//     board := chess.NewBitboard("8/8/8/4k3/8/8/8/KQ6 w - - 0 1")
+//     dtm, err := tablebase.ProbeDTM(board)
+//
+// Five piece endgames where two pawns or two identical pieces face a
+// single piece or pawn of the other side (like KQQvKP or KPPvKP) use index
+// schemes that are not supported yet and return an error.
+//
+// Probing pushes and pops moves on the given board to handle en-passant
+// captures, which the tables do not know about.
+type Gaviota struct {
+	mutex      sync.Mutex
+	tables     map[string]*gaviotaTable
+	cache      map[gaviotaBlockKey][]byte
+	cacheOrder []gaviotaBlockKey
+}
+
+// Opens the Gaviota tables in the given directory.
+func OpenGaviota(directory string) (*Gaviota, error) {
+	g := &Gaviota{tables: map[string]*gaviotaTable{}, cache: map[gaviotaBlockKey][]byte{}}
+	if _, err := g.AddDirectory(directory); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Adds the tables in the given directory. Other files are ignored. Returns
+// the number of tables found.
+func (g *Gaviota) AddDirectory(directory string) (int, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return 0, err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), gaviotaExtension) {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), gaviotaExtension)
+		sides := strings.SplitN(name[1:], "k", 2)
+		if name[0] != 'k' || len(sides) != 2 || len(name) > GaviotaMaxPieces {
+			continue
+		}
+
+		scheme := gaviotaSchemeFor("k"+sides[0], "k"+sides[1])
+		if scheme == nil {
+			continue
+		}
+
+		if old, ok := g.tables[name]; ok {
+			old.close()
+		}
+		g.tables[name] = &gaviotaTable{path: filepath.Join(directory, entry.Name()), scheme: scheme}
+		count++
+	}
+
+	return count, nil
+}
+
+func (t *gaviotaTable) close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	t.initialized = false
+	return err
+}
+
+// Closes all open table files.
+func (g *Gaviota) Close() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var result error
+	for _, table := range g.tables {
+		if err := table.close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	g.cache = map[gaviotaBlockKey][]byte{}
+	g.cacheOrder = nil
+	return result
+}
+
+// Probes the depth to mate in plies, from the point of view of the side to
+// move. The value is positive if the side to move mates, negative if it
+// gets mated and `0` for draws. A checkmated side also gets `0`.
+//
+// The 50-move rule is not taken into account.
+//
+// Returns an error if the position has castling rights, more than five
+// pieces or a needed table is missing.
+func (g *Gaviota) ProbeDTM(board *Bitboard) (int, error) {
+	if board.variant != Standard {
+		return 0, fmt.Errorf("gaviota tables do not support %s: '%s'.", board.variant.Name(), board.Fen())
+	}
+	if board.castlingRights != CastlingNone {
+		return 0, fmt.Errorf("gaviota tables do not contain positions with castling rights: '%s'.", board.Fen())
+	}
+	if popCount(board.occupied) > GaviotaMaxPieces {
+		return 0, fmt.Errorf("gaviota tables support up to %d pieces, not %d: '%s'.", GaviotaMaxPieces, popCount(board.occupied), board.Fen())
+	}
+
+	return g.probeDtm(board)
+}
+
+func (g *Gaviota) probeDtm(b *Bitboard) (int, error) {
+	dtm, err := g.probeDtmTable(b)
+	if err != nil || b.epSquare == 0 {
+		return dtm, err
+	}
+
+	// Now handle en-passant, which the tables do not know about.
+	moves := b.GenerateLegalMoves(true, true, true, true, true, true, true)
+	best, found, onlyEnPassant := 0, false, true
+	for _, move := range moves {
+		if !b.IsEnPassant(move) {
+			onlyEnPassant = false
+			continue
+		}
+
+		v, err := g.probeDtmAfter(b, move)
+		if err != nil {
+			return 0, err
+		}
+		if !found || gaviotaBetter(v, best) {
+			best, found = v, true
+		}
+	}
+
+	if !found {
+		return dtm, nil
+	}
+	if onlyEnPassant || gaviotaBetter(best, dtm) {
+		// If en-passant is the only legal move, the table value is
+		// meaningless.
+		return best, nil
+	}
+	return dtm, nil
+}
+
+// Probes the position after the move, from the point of view of the side
+// making the move.
+func (g *Gaviota) probeDtmAfter(b *Bitboard, move *Move) (int, error) {
+	b.Push(move)
+	v, err := g.probeDtm(b)
+	mate := err == nil && v == 0 && b.IsCheckmate()
+	b.Pop()
+	if err != nil {
+		return 0, err
+	}
+
+	if mate {
+		return 1, nil
+	} else if v > 0 {
+		return -(v + 1), nil
+	} else if v < 0 {
+		return -v + 1, nil
+	}
+	return 0, nil
+}
+
+// Checks if a depth to mate is preferable to another one for the side to
+// move: faster mates first, then draws, then slower losses.
+func gaviotaBetter(a, b int) bool {
+	if (a > 0) != (b > 0) {
+		return a > 0
+	}
+	if a > 0 {
+		return a < b
+	}
+	if a == 0 || b == 0 {
+		return a == 0
+	}
+	return a < b
+}
+
+// Probes the table for the position, ignoring en-passant.
+func (g *Gaviota) probeDtmTable(b *Bitboard) (int, error) {
+	// Two bare kings are a draw.
+	if b.kings == b.occupied {
+		return 0, nil
+	}
+
+	white := gaviotaPieceList(b, White)
+	black := gaviotaPieceList(b, Black)
+	turn := b.turn
+
+	g.mutex.Lock()
+	table, ok := g.tables[gaviotaKey(white)+gaviotaKey(black)]
+	reversed := false
+	if !ok {
+		// Try with the colors reversed.
+		table, ok = g.tables[gaviotaKey(black)+gaviotaKey(white)]
+		reversed = true
+	}
+	g.mutex.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("did not find gaviota table for %s%s.", gaviotaKey(white), gaviotaKey(black))
+	}
+
+	ws, bs := gaviotaSquares(white), gaviotaSquares(black)
+	if reversed {
+		ws, bs = bs, ws
+		for i := range ws {
+			ws[i] = gaviotaFlipNS(ws[i])
+		}
+		for i := range bs {
+			bs[i] = gaviotaFlipNS(bs[i])
+		}
+		turn ^= 1
+	}
+
+	if err := table.init(); err != nil {
+		return 0, err
+	}
+
+	idx := table.scheme.index(ws, bs)
+	if idx < 0 || idx >= table.scheme.maxIndex {
+		return 0, fmt.Errorf("position is not indexed in gaviota table: '%s'.", b.Fen())
+	}
+
+	block := int(turn)*table.blocksPerSide + idx/table.blockSize
+	data, err := g.block(table, block, idx)
+	if err != nil {
+		return 0, err
+	}
+
+	result, plies := gaviotaUnpack(turn, data[idx%table.blockSize])
+	if result == gaviotaForbid {
+		return 0, fmt.Errorf("illegal position in gaviota table: '%s'.", b.Fen())
+	}
+	if result == gaviotaDraw {
+		return 0, nil
+	}
+
+	// The winner in the stored position.
+	winner := White
+	if result == gaviotaBMate {
+		winner = Black
+	}
+	if reversed {
+		winner ^= 1
+	}
+	if winner == b.turn {
+		return plies, nil
+	}
+	return -plies, nil
+}
+
+// Gets a block from the cache or decompresses it.
+func (g *Gaviota) block(table *gaviotaTable, block, idx int) ([]byte, error) {
+	key := gaviotaBlockKey{table, block}
+
+	g.mutex.Lock()
+	data, ok := g.cache[key]
+	g.mutex.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	// The last block of a side may be shorter.
+	entries := table.blockSize
+	if start := idx / table.blockSize * table.blockSize; start+entries > table.scheme.maxIndex {
+		entries = table.scheme.maxIndex - start
+	}
+
+	data, err := table.readBlock(block, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.cache[key]; !ok {
+		if len(g.cacheOrder) >= gaviotaCacheSize {
+			delete(g.cache, g.cacheOrder[0])
+			g.cacheOrder = g.cacheOrder[1:]
+		}
+		g.cache[key] = data
+		g.cacheOrder = append(g.cacheOrder, key)
+	}
+	return data, nil
+}
+
+type gaviotaPiece struct {
+	pieceType PieceTypes
+	square    int
+}
+
+// Gets the pieces of one side, the king first and then by descending
+// value. Pieces of the same type are ordered by square.
+func gaviotaPieceList(b *Bitboard, color Colors) []gaviotaPiece {
+	pieces := []gaviotaPiece{}
+	for squares := b.occupiedCo[color]; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		pieces = append(pieces, gaviotaPiece{b.pieces[square], square})
+	}
+	sort.SliceStable(pieces, func(i, j int) bool {
+		return pieces[i].pieceType > pieces[j].pieceType
+	})
+	return pieces
+}
+
+func gaviotaKey(pieces []gaviotaPiece) string {
+	key := ""
+	for _, piece := range pieces {
+		key += PieceSymbols[piece.pieceType]
+	}
+	return key
+}
+
+func gaviotaSquares(pieces []gaviotaPiece) []int {
+	squares := make([]int, len(pieces))
+	for i, piece := range pieces {
+		squares[i] = piece.square
+	}
+	return squares
+}
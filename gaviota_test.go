@@ -0,0 +1,300 @@
+package chess
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Opens the Gaviota tables from `$GAVIOTA_PATH` or `data/gaviota`. The test
+// is skipped unless the tables of the given materials are there, or fails
+// on CI like `openTestSyzygy()`.
+func openTestGaviota(t *testing.T, names ...string) *Gaviota {
+	directory := os.Getenv("GAVIOTA_PATH")
+	if directory == "" {
+		directory = filepath.Join("data", "gaviota")
+	}
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(directory, name+gaviotaExtension)); err != nil {
+			if os.Getenv("CI") != "" {
+				t.Fatalf("gaviota table %s%s not found in %s, set $GAVIOTA_PATH", name, gaviotaExtension, directory)
+			}
+			t.Skipf("gaviota table %s%s not found in %s", name, gaviotaExtension, directory)
+		}
+	}
+
+	tablebase, err := OpenGaviota(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tablebase.Close() })
+	return tablebase
+}
+
+func TestGaviotaAddDirectory(t *testing.T) {
+	directory := t.TempDir()
+	// An empty header with a block size of zero.
+	if err := os.WriteFile(filepath.Join(directory, "kqk.gtb.cp4"), make([]byte, 40), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"krkp.gtb.cp4", "kbnkr.gtb.cp4", "kqk.gtb.cp2", "README", "kqqkp.gtb.cp4", "kqqqqk.gtb.cp4", "qkk.gtb.cp4"} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte("not a table"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(directory, "krk.gtb.cp4"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tablebase, err := OpenGaviota(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tablebase.Close()
+
+	if count, err := tablebase.AddDirectory(directory); err != nil || count != 3 {
+		t.Errorf("expected 3 tables, got %d (%v)", count, err)
+	}
+	if _, err := tablebase.AddDirectory(filepath.Join(directory, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+	if _, err := OpenGaviota(filepath.Join(directory, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+
+	// Two bare kings do not need a table.
+	if dtm, err := tablebase.ProbeDTM(NewBitboard("8/8/8/4k3/8/8/8/4K3 w - - 0 1")); err != nil || dtm != 0 {
+		t.Errorf("expected a draw with bare kings, got %d (%v)", dtm, err)
+	}
+
+	errors := []struct {
+		board   *Bitboard
+		message string
+	}{
+		{NewBitboard("8/8/8/4k3/8/8/8/4K2Q w - - 0 1"), "invalid gaviota table header"},
+		{NewBitboard("8/8/8/4k3/8/8/8/4K2R w - - 0 1"), "did not find gaviota table for krk"},
+		// Found with the colors reversed, but not a table.
+		{NewBitboard("8/8/8/4k3/1r6/8/4P3/4K3 w - - 0 1"), "unexpected EOF"},
+		{NewBitboard("4k3/8/8/8/8/8/8/4K2R w K - 0 1"), "castling rights"},
+		{NewBitboard("4k3/8/8/8/8/8/3PPP2/3QK3 w - - 0 1"), "up to 5 pieces"},
+		{NewVariantBitboard(Atomic, "8/8/8/4k3/8/8/8/4K2Q w - - 0 1"), "do not support"},
+	}
+	for _, test := range errors {
+		if _, err := tablebase.ProbeDTM(test.board); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing '%s', got %v", test.board.Fen(), test.message, err)
+		}
+	}
+}
+
+func TestGaviotaSchemeFor(t *testing.T) {
+	tests := []struct {
+		white, black string
+		maxIndex     int
+	}{
+		{"kq", "k", gaviotaMaxKKIndex * 64},
+		{"kp", "k", 24 * 64 * 64},
+		{"kr", "kb", gaviotaMaxKKIndex * 64 * 64},
+		{"kq", "kp", 24 * 64 * 64 * 64},
+		{"kp", "kp", gaviotaMaxPpIndex * 64 * 64},
+		{"krr", "k", gaviotaMaxKKIndex * gaviotaMaxAAIndex},
+		{"kbn", "k", gaviotaMaxKKIndex * 64 * 64},
+		{"krp", "k", 24 * 64 * 64 * 64},
+		{"kpp", "k", gaviotaMaxPPIndex * 64 * 64},
+		{"kbb", "kr", gaviotaMaxKKIndex * gaviotaMaxAAIndex * 64},
+		{"kqr", "kb", gaviotaMaxKKIndex * 64 * 64 * 64},
+		{"krp", "kq", 24 * 64 * 64 * 64 * 64},
+		{"kqr", "kp", 24 * 64 * 64 * 64 * 64},
+		{"knnn", "k", gaviotaMaxKKIndex * gaviotaMaxAAAIndex},
+		{"kqqr", "k", gaviotaMaxKKIndex * gaviotaMaxAAIndex * 64},
+		{"kqrr", "k", gaviotaMaxKKIndex * gaviotaMaxAAIndex * 64},
+		{"kqrb", "k", gaviotaMaxKKIndex * 64 * 64 * 64},
+		{"krrp", "k", 24 * 64 * 64 * gaviotaMaxAAIndex},
+		{"kqrp", "k", 24 * 64 * 64 * 64 * 64},
+		// Not supported.
+		{"kqq", "kp", 0},
+		{"kpp", "kp", 0},
+		{"krp", "kp", 0},
+		{"kpp", "kr", 0},
+		{"kpp", "kpp", 0},
+		{"kppp", "k", 0},
+	}
+
+	for _, test := range tests {
+		scheme := gaviotaSchemeFor(test.white, test.black)
+		if test.maxIndex == 0 {
+			if scheme != nil {
+				t.Errorf("%s%s: expected no scheme", test.white, test.black)
+			}
+		} else if scheme == nil {
+			t.Errorf("%s%s: expected a scheme", test.white, test.black)
+		} else if scheme.maxIndex != test.maxIndex {
+			t.Errorf("%s%s: expected %d indexes, got %d", test.white, test.black, test.maxIndex, scheme.maxIndex)
+		}
+	}
+}
+
+// Checks that positions with two pawns have distinct indexes in range,
+// unless they are mirrored at the d/e line or only swap identical pawns.
+func TestGaviotaPawnIndexes(t *testing.T) {
+	tests := []struct {
+		name     string
+		index    gaviotaIndexer
+		maxIndex int
+		white    bool
+	}{
+		{"kppk", gaviotaIndexKPPK, gaviotaMaxPPIndex * 64 * 64, true},
+		{"kpkp", gaviotaIndexKPKP, gaviotaMaxPpIndex * 64 * 64, false},
+	}
+
+	kings := []int{A1, H1, D4, E5, G7}
+	for _, test := range tests {
+		seen := map[int][4]int{}
+		for a := A2; a < A8; a++ {
+			for b := A2; b < A8; b++ {
+				if a == b || (test.white && a < b) {
+					continue
+				}
+				for _, wk := range kings {
+					for _, bk := range kings {
+						w, bs := []int{wk, a}, []int{bk}
+						if test.white {
+							w = append(w, b)
+						} else {
+							bs = append(bs, b)
+						}
+
+						idx := test.index(w, bs)
+						if idx < 0 || idx >= test.maxIndex {
+							t.Fatalf("%s: index %d out of range for %v %v", test.name, idx, w, bs)
+						}
+
+						key := gaviotaTestKey(test.white, wk, bk, a, b)
+						if other, ok := seen[idx]; ok && other != key {
+							t.Fatalf("%s: index %d shared by %v and %v", test.name, idx, other, key)
+						}
+						seen[idx] = key
+
+						// Identical pawns can be given in any order.
+						if test.white {
+							if swapped := test.index([]int{wk, b, a}, bs); swapped != idx {
+								t.Fatalf("%s: index %d changed to %d after swapping the pawns %v", test.name, idx, swapped, w)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Identifies a position with two pawns by the smaller of its squares and
+// its mirrored squares. Identical pawns are ordered.
+func gaviotaTestKey(identical bool, wk, bk, a, b int) [4]int {
+	key := [4]int{wk, bk, a, b}
+	mirrored := [4]int{gaviotaFlipWE(wk), gaviotaFlipWE(bk), gaviotaFlipWE(a), gaviotaFlipWE(b)}
+	for _, k := range []*[4]int{&key, &mirrored} {
+		if identical && k[2] > k[3] {
+			k[2], k[3] = k[3], k[2]
+		}
+	}
+
+	for i := range key {
+		if mirrored[i] != key[i] {
+			if mirrored[i] < key[i] {
+				return mirrored
+			}
+			break
+		}
+	}
+	return key
+}
+
+func TestGaviotaProbe(t *testing.T) {
+	tablebase := openTestGaviota(t, "kqk", "krk", "kpk")
+
+	tests := []struct {
+		fen string
+		dtm int
+	}{
+		// Mate in one, also with the colors swapped.
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", 1},
+		{"K7/8/1k6/8/8/8/8/6q1 b - - 0 1", 1},
+		// Checkmated and stalemated.
+		{"k6R/8/1K6/8/8/8/8/8 b - - 0 1", 0},
+		{"k7/8/1Q6/8/8/8/8/7K b - - 0 1", 0},
+		// The only move runs into mate.
+		{"k7/7R/1K6/8/8/8/8/8 b - - 0 1", -2},
+		// Black saves the draw by taking the queen.
+		{"7K/8/8/8/8/8/3Q4/4k3 b - - 0 1", 0},
+		// Rook pawn with the defending king in the corner.
+		{"k7/8/8/8/8/8/P7/K7 w - - 0 1", 0},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		dtm, err := tablebase.ProbeDTM(board)
+		if err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+		} else if dtm != test.dtm {
+			t.Errorf("%s: expected dtm %d, got %d", test.fen, test.dtm, dtm)
+		}
+		if board.Fen() != test.fen {
+			t.Errorf("%s: board changed to '%s'", test.fen, board.Fen())
+		}
+	}
+}
+
+// Compares the Gaviota tables with generated endgame tables.
+func TestGaviotaEndgame(t *testing.T) {
+	tablebase := openTestGaviota(t, "kqk", "krk")
+
+	endgames := NewEndgameTablebase()
+	for _, material := range []string{"KQvK", "KRvK"} {
+		if err := endgames.Generate(material); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kingSquares := []int{A1, B1, C3, D4}
+	if testing.Short() {
+		kingSquares = kingSquares[:1]
+	}
+
+	board := NewBitboard("")
+	for _, pieceType := range []PieceTypes{Queen, Rook} {
+		for _, kingSquare := range kingSquares {
+			for pieceSquare := range Squares {
+				for otherKingSquare := range Squares {
+					for _, turn := range []Colors{White, Black} {
+						if pieceSquare == kingSquare || otherKingSquare == kingSquare || otherKingSquare == pieceSquare {
+							continue
+						}
+
+						board.Clear()
+						board.SetPieceAt(kingSquare, NewPiece(King, White))
+						board.SetPieceAt(pieceSquare, NewPiece(pieceType, White))
+						board.SetPieceAt(otherKingSquare, NewPiece(King, Black))
+						board.turn = turn
+						if board.Status() != StatusValid {
+							continue
+						}
+
+						expected, err := endgames.Probe(board)
+						if err != nil {
+							t.Fatalf("%s: %s", board.Fen(), err)
+						}
+						dtm, err := tablebase.ProbeDTM(board)
+						if err != nil {
+							t.Fatalf("%s: %s", board.Fen(), err)
+						}
+						if dtm != expected {
+							t.Errorf("%s: expected dtm %d, got %d", board.Fen(), expected, dtm)
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package chess
+
+import (
+	"fmt"
+)
+
+// A minimal decoder for raw LZMA streams with a known uncompressed size,
+// as used by the compressed Gaviota tablebases. It follows the reference
+// decoder of the LZMA specification.
+
+const (
+	lzmaNumBitModelTotalBits = 11
+	lzmaBitModelTotal        = 1 << lzmaNumBitModelTotalBits
+	lzmaNumMoveBits          = 5
+	lzmaNumPosBitsMax        = 4
+	lzmaNumStates            = 12
+	lzmaNumLenToPosStates    = 4
+	lzmaNumAlignBits         = 4
+	lzmaStartPosModelIndex   = 4
+	lzmaEndPosModelIndex     = 14
+	lzmaNumFullDistances     = 1 << (lzmaEndPosModelIndex >> 1)
+	lzmaMatchMinLen          = 2
+)
+
+type lzmaRangeDecoder struct {
+	data  []byte
+	pos   int
+	rng   uint32
+	code  uint32
+	error bool
+}
+
+func (rc *lzmaRangeDecoder) readByte() byte {
+	if rc.pos >= len(rc.data) {
+		rc.error = true
+		return 0
+	}
+	b := rc.data[rc.pos]
+	rc.pos++
+	return b
+}
+
+func (rc *lzmaRangeDecoder) init() {
+	rc.rng = 0xffffffff
+	if rc.readByte() != 0 {
+		rc.error = true
+	}
+	for i := 0; i < 4; i++ {
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+	if rc.code == rc.rng {
+		rc.error = true
+	}
+}
+
+func (rc *lzmaRangeDecoder) normalize() {
+	if rc.rng < 1<<24 {
+		rc.rng <<= 8
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+}
+
+func (rc *lzmaRangeDecoder) decodeDirectBits(numBits int) uint32 {
+	result := uint32(0)
+	for ; numBits > 0; numBits-- {
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		if rc.code == rc.rng {
+			rc.error = true
+		}
+		rc.normalize()
+		result = result<<1 + t + 1
+	}
+	return result
+}
+
+func (rc *lzmaRangeDecoder) decodeBit(prob *uint16) uint32 {
+	v := uint32(*prob)
+	bound := (rc.rng >> lzmaNumBitModelTotalBits) * v
+	var symbol uint32
+	if rc.code < bound {
+		v += (lzmaBitModelTotal - v) >> lzmaNumMoveBits
+		rc.rng = bound
+		symbol = 0
+	} else {
+		v -= v >> lzmaNumMoveBits
+		rc.code -= bound
+		rc.rng -= bound
+		symbol = 1
+	}
+	*prob = uint16(v)
+	rc.normalize()
+	return symbol
+}
+
+func lzmaInitProbs(probs []uint16) {
+	for i := range probs {
+		probs[i] = lzmaBitModelTotal / 2
+	}
+}
+
+func (rc *lzmaRangeDecoder) bitTreeDecode(probs []uint16, numBits int) uint32 {
+	m := uint32(1)
+	for i := 0; i < numBits; i++ {
+		m = m<<1 + rc.decodeBit(&probs[m])
+	}
+	return m - 1<<uint(numBits)
+}
+
+func (rc *lzmaRangeDecoder) bitTreeReverseDecode(probs []uint16, numBits int) uint32 {
+	m := uint32(1)
+	symbol := uint32(0)
+	for i := 0; i < numBits; i++ {
+		bit := rc.decodeBit(&probs[m])
+		m = m<<1 + bit
+		symbol |= bit << uint(i)
+	}
+	return symbol
+}
+
+type lzmaLenDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [1 << lzmaNumPosBitsMax][1 << 3]uint16
+	mid     [1 << lzmaNumPosBitsMax][1 << 3]uint16
+	high    [1 << 8]uint16
+}
+
+func (d *lzmaLenDecoder) init() {
+	d.choice = lzmaBitModelTotal / 2
+	d.choice2 = lzmaBitModelTotal / 2
+	lzmaInitProbs(d.high[:])
+	for i := range d.low {
+		lzmaInitProbs(d.low[i][:])
+		lzmaInitProbs(d.mid[i][:])
+	}
+}
+
+func (d *lzmaLenDecoder) decode(rc *lzmaRangeDecoder, posState uint32) uint32 {
+	if rc.decodeBit(&d.choice) == 0 {
+		return rc.bitTreeDecode(d.low[posState][:], 3)
+	}
+	if rc.decodeBit(&d.choice2) == 0 {
+		return 8 + rc.bitTreeDecode(d.mid[posState][:], 3)
+	}
+	return 16 + rc.bitTreeDecode(d.high[:], 8)
+}
+
+// Decodes a raw LZMA stream into exactly `size` bytes. `properties` is the
+// usual lc/lp/pb byte.
+func lzmaDecode(properties byte, dictSize uint32, data []byte, size int) ([]byte, error) {
+	d := int(properties)
+	if d >= 9*5*5 {
+		return nil, fmt.Errorf("invalid lzma properties: %d.", d)
+	}
+	lc := uint(d % 9)
+	d /= 9
+	lp := uint(d % 5)
+	pb := uint(d / 5)
+
+	out := make([]byte, 0, size)
+	rc := &lzmaRangeDecoder{data: data}
+	rc.init()
+
+	literalProbs := make([]uint16, 0x300<<(lc+lp))
+	lzmaInitProbs(literalProbs)
+
+	var posSlot [lzmaNumLenToPosStates][1 << 6]uint16
+	for i := range posSlot {
+		lzmaInitProbs(posSlot[i][:])
+	}
+	var posDecoders [1 + lzmaNumFullDistances - lzmaEndPosModelIndex]uint16
+	lzmaInitProbs(posDecoders[:])
+	var align [1 << lzmaNumAlignBits]uint16
+	lzmaInitProbs(align[:])
+
+	var isMatch [lzmaNumStates << lzmaNumPosBitsMax]uint16
+	var isRep, isRepG0, isRepG1, isRepG2 [lzmaNumStates]uint16
+	var isRep0Long [lzmaNumStates << lzmaNumPosBitsMax]uint16
+	lzmaInitProbs(isMatch[:])
+	lzmaInitProbs(isRep[:])
+	lzmaInitProbs(isRepG0[:])
+	lzmaInitProbs(isRepG1[:])
+	lzmaInitProbs(isRepG2[:])
+	lzmaInitProbs(isRep0Long[:])
+
+	var lenDecoder, repLenDecoder lzmaLenDecoder
+	lenDecoder.init()
+	repLenDecoder.init()
+
+	var rep0, rep1, rep2, rep3 uint32
+	state := uint32(0)
+
+	for len(out) < size {
+		if rc.error {
+			return nil, fmt.Errorf("corrupted lzma data.")
+		}
+
+		posState := uint32(len(out)) & (1<<pb - 1)
+
+		if rc.decodeBit(&isMatch[state<<lzmaNumPosBitsMax+posState]) == 0 {
+			// Literal.
+			prevByte := uint32(0)
+			if len(out) > 0 {
+				prevByte = uint32(out[len(out)-1])
+			}
+			litState := (uint32(len(out))&(1<<lp-1))<<lc + prevByte>>(8-lc)
+			probs := literalProbs[0x300*litState:]
+
+			symbol := uint32(1)
+			if state >= 7 {
+				if int(rep0) >= len(out) {
+					return nil, fmt.Errorf("corrupted lzma data.")
+				}
+				matchByte := uint32(out[len(out)-int(rep0)-1])
+				for symbol < 0x100 {
+					matchBit := (matchByte >> 7) & 1
+					matchByte <<= 1
+					bit := rc.decodeBit(&probs[(1+matchBit)<<8+symbol])
+					symbol = symbol<<1 | bit
+					if matchBit != bit {
+						break
+					}
+				}
+			}
+			for symbol < 0x100 {
+				symbol = symbol<<1 | rc.decodeBit(&probs[symbol])
+			}
+			out = append(out, byte(symbol-0x100))
+
+			if state < 4 {
+				state = 0
+			} else if state < 10 {
+				state -= 3
+			} else {
+				state -= 6
+			}
+			continue
+		}
+
+		var length uint32
+		if rc.decodeBit(&isRep[state]) != 0 {
+			if len(out) == 0 {
+				return nil, fmt.Errorf("corrupted lzma data.")
+			}
+			if rc.decodeBit(&isRepG0[state]) == 0 {
+				if rc.decodeBit(&isRep0Long[state<<lzmaNumPosBitsMax+posState]) == 0 {
+					// Short rep.
+					if state < 7 {
+						state = 9
+					} else {
+						state = 11
+					}
+					if int(rep0) >= len(out) {
+						return nil, fmt.Errorf("corrupted lzma data.")
+					}
+					out = append(out, out[len(out)-int(rep0)-1])
+					continue
+				}
+			} else {
+				var dist uint32
+				if rc.decodeBit(&isRepG1[state]) == 0 {
+					dist = rep1
+				} else {
+					if rc.decodeBit(&isRepG2[state]) == 0 {
+						dist = rep2
+					} else {
+						dist = rep3
+						rep3 = rep2
+					}
+					rep2 = rep1
+				}
+				rep1 = rep0
+				rep0 = dist
+			}
+			length = repLenDecoder.decode(rc, posState)
+			if state < 7 {
+				state = 8
+			} else {
+				state = 11
+			}
+		} else {
+			rep3 = rep2
+			rep2 = rep1
+			rep1 = rep0
+			length = lenDecoder.decode(rc, posState)
+			if state < 7 {
+				state = 7
+			} else {
+				state = 10
+			}
+
+			// Distance.
+			lenState := length
+			if lenState > lzmaNumLenToPosStates-1 {
+				lenState = lzmaNumLenToPosStates - 1
+			}
+			slot := rc.bitTreeDecode(posSlot[lenState][:], 6)
+			if slot < 4 {
+				rep0 = slot
+			} else {
+				numDirectBits := int(slot>>1) - 1
+				dist := (2 | slot&1) << uint(numDirectBits)
+				if slot < lzmaEndPosModelIndex {
+					dist += rc.bitTreeReverseDecode(posDecoders[dist-slot:], numDirectBits)
+				} else {
+					dist += rc.decodeDirectBits(numDirectBits-lzmaNumAlignBits) << lzmaNumAlignBits
+					dist += rc.bitTreeReverseDecode(align[:], lzmaNumAlignBits)
+				}
+				rep0 = dist
+			}
+
+			if rep0 == 0xffffffff {
+				// End marker.
+				break
+			}
+			if rep0 >= dictSize || int(rep0) >= len(out) {
+				return nil, fmt.Errorf("corrupted lzma data.")
+			}
+		}
+
+		length += lzmaMatchMinLen
+		for ; length > 0 && len(out) < size; length-- {
+			out = append(out, out[len(out)-int(rep0)-1])
+		}
+	}
+
+	if len(out) != size {
+		return nil, fmt.Errorf("unexpected end of lzma data.")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package chess
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Compressed with lc=3, lp=0, pb=2 and a 4 KiB dictionary, ending with an
+// end marker.
+var lzmaTestData = []byte{
+	0x00, 0x31, 0x9a, 0x08, 0xd4, 0xa1, 0x25, 0x0b, 0x78, 0x2a, 0xcc, 0x6f, 0x98, 0xf5, 0x57, 0xe4,
+	0x03, 0x1e, 0xd7, 0xe9, 0x03, 0x7e, 0x20, 0xa9, 0xc1, 0x3d, 0x14, 0x6f, 0x29, 0xf6, 0xe9, 0x24,
+	0xe3, 0xbf, 0x49, 0xcd, 0x81, 0x93, 0xc8, 0xf8, 0x0d, 0x67, 0x2f, 0x9b, 0xda, 0xac, 0x35, 0xfe,
+	0x50, 0x3e, 0x5f, 0xff, 0xff, 0x8b, 0x1a, 0x00, 0x00,
+}
+
+func lzmaTestExpected() []byte {
+	expected := []byte("chess.go chess.go chess.go: ")
+	for i := 0; i < 3; i++ {
+		for b := 0; b < 32; b++ {
+			expected = append(expected, byte(b))
+		}
+	}
+	return expected
+}
+
+func TestLzmaDecode(t *testing.T) {
+	expected := lzmaTestExpected()
+	properties := byte((2*5+0)*9 + 3)
+
+	out, err := lzmaDecode(properties, 4096, lzmaTestData, len(expected))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	// A shorter size stops early.
+	if out, err := lzmaDecode(properties, 4096, lzmaTestData, 10); err != nil || !bytes.Equal(out, expected[:10]) {
+		t.Errorf("expected %q, got %q (%v)", expected[:10], out, err)
+	}
+
+	// The end marker comes before the size is reached.
+	if _, err := lzmaDecode(properties, 4096, lzmaTestData, len(expected)+1); err == nil {
+		t.Error("expected an error for a missing end")
+	}
+	if _, err := lzmaDecode(properties, 4096, lzmaTestData[:20], len(expected)); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+	if _, err := lzmaDecode(9*5*5, 4096, lzmaTestData, len(expected)); err == nil {
+		t.Error("expected an error for invalid properties")
+	}
+}
@@ -0,0 +1,59 @@
+package chess
+
+import "testing"
+
+func TestSliderAttacks(t *testing.T) {
+	for _, test := range perftTests {
+		board := NewBitboard(test.fen)
+		for square := range Squares {
+			if attacks := board.RookAttacksFrom(square); attacks != slidingAttacks(square, board.occupied, rookDeltas) {
+				t.Errorf("%s: wrong rook attacks from %s", test.name, SquareNames[square])
+			}
+			if attacks := board.BishopAttacksFrom(square); attacks != slidingAttacks(square, board.occupied, bishopDeltas) {
+				t.Errorf("%s: wrong bishop attacks from %s", test.name, SquareNames[square])
+			}
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b     int
+		expected uint64
+	}{
+		{A1, H8, BBB2 | BBC3 | BBD4 | BBE5 | BBF6 | BBG7},
+		{E1, E4, BBE2 | BBE3},
+		{H3, C3, BBD3 | BBE3 | BBF3 | BBG3},
+		{B1, C3, BBVoid},
+		{D4, D5, BBVoid},
+	}
+
+	for _, test := range tests {
+		if between := BBBetween[test.a][test.b]; between != test.expected {
+			t.Errorf("wrong squares between %s and %s: %x", SquareNames[test.a], SquareNames[test.b], between)
+		}
+		if BBBetween[test.a][test.b] != BBBetween[test.b][test.a] {
+			t.Errorf("squares between %s and %s are not symmetric", SquareNames[test.a], SquareNames[test.b])
+		}
+	}
+}
+
+func BenchmarkGenerateLegalMoves(b *testing.B) {
+	board := NewBitboard("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	for i := 0; i < b.N; i++ {
+		board.GenerateLegalMoves(true, true, true, true, true, true, true)
+	}
+}
+
+func BenchmarkSliderAttacks(b *testing.B) {
+	board := NewBitboard("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	attacks := BBVoid
+	for i := 0; i < b.N; i++ {
+		for square := range Squares {
+			attacks |= board.QueenAttacksFrom(square)
+		}
+	}
+	if attacks == BBVoid {
+		b.Fatal("no attacks")
+	}
+}
@@ -1,36 +1,61 @@
 package chess
 
+import (
+	"strings"
+)
+
 // Represents a move from a square to a square and possibly the promotion piece
 // type.
 //
 // Castling moves are identified only by the movement of the king.
 //
+// In variants like Crazyhouse a move can also drop a piece from the pocket.
+// Source and target square of a drop are the same.
+//
 // Null moves are supported.
 type Move struct {
 	fromSquare int
 	toSquare   int
 	promotion  PieceTypes
+	drop       PieceTypes
 }
 
 func NewMove(fromSquare, toSquare int, promotion PieceTypes) *Move {
-	return &Move{fromSquare, toSquare, promotion}
+	return &Move{fromSquare: fromSquare, toSquare: toSquare, promotion: promotion}
+}
+
+// Creates a move that drops a piece of the given type on the square.
+func NewDrop(square int, drop PieceTypes) *Move {
+	return &Move{fromSquare: square, toSquare: square, drop: drop}
 }
 
 func (m *Move) Equals(move *Move) bool {
     return m.fromSquare == move.fromSquare && m.toSquare == move.toSquare &&
-        m.promotion == move.promotion
+        m.promotion == move.promotion && m.drop == move.drop
 }
 
 func (m *Move) String() string {
+    if m.drop != None {
+        return strings.ToUpper(PieceSymbols[m.drop])+"@"+SquareNames[m.toSquare]
+    }
     return SquareNames[m.fromSquare]+"->"+SquareNames[m.toSquare]
 }
 
+// Gets the type of the dropped piece, or `None` if the move is not a drop.
+func (m *Move) Drop() PieceTypes {
+	return m.drop
+}
+
 // Gets an UCI string for the move.
 //
 // For example a move from A7 to A8 would be `a7a8` or `a7a8q` if it is
-// a promotion to a queen. The UCI representatin of null moves is `0000`.
+// a promotion to a queen. Drops are written like `N@f3`. The UCI
+// representatin of null moves is `0000`.
 func (m *Move) Uci() string {
 	if m != nil {
+		if m.drop != None {
+			return strings.ToUpper(PieceSymbols[m.drop]) + "@" + SquareNames[m.toSquare]
+		}
 		return SquareNames[m.fromSquare] + SquareNames[m.toSquare] + PieceSymbols[m.promotion]
 	}
 	return "0000"
@@ -42,6 +67,14 @@ func (m *Move) Uci() string {
 func MoveFromUci(uci string) *Move {
 	if uci == "0000" {
 		return nil
+	} else if len(uci) == 4 && uci[1] == '@' {
+		piece := PieceFromSymbol(uci[0:1])
+		for square := range SquareNames {
+			if SquareNames[square] == uci[2:4] && piece != nil && piece.pieceType != King {
+				return NewDrop(square, piece.pieceType)
+			}
+		}
+		return nil
 	} else if len(uci) == 4 {
 		var fromSquare, toSquare int
 		for i := range SquareNames {
@@ -82,3 +115,159 @@ func MoveFromUci(uci string) *Move {
 func NullMove() *Move {
 	return nil
 }
+
+// A move packed into 16 bits, for when allocating a `Move` for every
+// generated move is too expensive.
+//
+// Bits 0-5 hold the source square, bits 6-11 the target square and bits
+// 12-14 the promotion piece type. Bit 15 marks drops, which keep the
+// dropped piece type in the promotion bits. The zero value is the null
+// move, since a move from A1 to A1 is never valid.
+type PackedMove uint16
+
+// The packed representation of the null move.
+const PackedNullMove PackedMove = 0
+
+func NewPackedMove(fromSquare, toSquare int, promotion PieceTypes) PackedMove {
+	return PackedMove(fromSquare | toSquare<<6 | int(promotion)<<12)
+}
+
+func NewPackedDrop(square int, drop PieceTypes) PackedMove {
+	return PackedMove(square|square<<6|int(drop)<<12) | packedDropFlag
+}
+
+const packedDropFlag PackedMove = 1 << 15
+
+// Packs a move. Null moves become `PackedNullMove`.
+func PackMove(move *Move) PackedMove {
+	if move == nil {
+		return PackedNullMove
+	}
+	if move.drop != None {
+		return NewPackedDrop(move.toSquare, move.drop)
+	}
+	return NewPackedMove(move.fromSquare, move.toSquare, move.promotion)
+}
+
+func (m PackedMove) FromSquare() int {
+	return int(m & 0x3f)
+}
+
+func (m PackedMove) ToSquare() int {
+	return int((m >> 6) & 0x3f)
+}
+
+func (m PackedMove) Promotion() PieceTypes {
+	if m&packedDropFlag != 0 {
+		return None
+	}
+	return PieceTypes((m >> 12) & 0x7)
+}
+
+// Gets the type of the dropped piece, or `None` if the move is not a drop.
+func (m PackedMove) Drop() PieceTypes {
+	if m&packedDropFlag == 0 {
+		return None
+	}
+	return PieceTypes((m >> 12) & 0x7)
+}
+
+// Unpacks the move. Returns nil for the null move.
+func (m PackedMove) Move() *Move {
+	if m == PackedNullMove {
+		return nil
+	}
+	return &Move{m.FromSquare(), m.ToSquare(), m.Promotion(), m.Drop()}
+}
+
+// Gets an UCI string for the move, just like `Move.Uci()`.
+func (m PackedMove) Uci() string {
+	if m == PackedNullMove {
+		return "0000"
+	}
+	if m&packedDropFlag != 0 {
+		return strings.ToUpper(PieceSymbols[m.Drop()]) + "@" + SquareNames[m.ToSquare()]
+	}
+	return SquareNames[m.FromSquare()] + SquareNames[m.ToSquare()] + PieceSymbols[m.Promotion()]
+}
+
+// A list of packed moves that can be reused to avoid allocations.
+//
+//     var moves chess.MoveList
+//     for {
+//         moves.Clear()
+//         board.GenerateMovesInto(&moves, chess.GenerateAll)
+//         for i := 0; i < moves.Len(); i++ {
+//             move := moves.At(i)
+//             ...
+//         }
+//     }
+//
+// The zero value is an empty list.
+type MoveList struct {
+	moves []PackedMove
+}
+
+// Creates an empty list with room for the given number of moves.
+func NewMoveList(capacity int) *MoveList {
+	return &MoveList{moves: make([]PackedMove, 0, capacity)}
+}
+
+func (l *MoveList) Len() int {
+	return len(l.moves)
+}
+
+func (l *MoveList) At(index int) PackedMove {
+	return l.moves[index]
+}
+
+// Removes all moves, keeping the allocated space.
+func (l *MoveList) Clear() {
+	l.moves = l.moves[:0]
+}
+
+func (l *MoveList) Append(move PackedMove) {
+	l.moves = append(l.moves, move)
+}
+
+// Gets the moves as a slice. The slice is only valid until the list is
+// modified.
+func (l *MoveList) Slice() []PackedMove {
+	return l.moves
+}
+
+// Unpacks all moves. The moves share a single allocation.
+func (l *MoveList) Moves() []*Move {
+	moves := make([]Move, len(l.moves))
+	result := make([]*Move, len(l.moves))
+	for i, move := range l.moves {
+		moves[i] = Move{move.FromSquare(), move.ToSquare(), move.Promotion(), move.Drop()}
+		result[i] = &moves[i]
+	}
+	return result
+}
+
+func (l *MoveList) add(fromSquare, toSquare int, promotion PieceTypes) {
+	l.moves = append(l.moves, NewPackedMove(fromSquare, toSquare, promotion))
+}
+
+func (l *MoveList) addDrop(square int, drop PieceTypes) {
+	l.moves = append(l.moves, NewPackedDrop(square, drop))
+}
+
+// Selects the kinds of moves to generate with
+// `Bitboard.GenerateMovesInto()`. Drops are selected by the type of the
+// dropped piece.
+type MoveFilter int
+
+const (
+	GenerateCastling MoveFilter = 1 << iota
+	GeneratePawns
+	GenerateKnights
+	GenerateBishops
+	GenerateRooks
+	GenerateQueens
+	GenerateKing
+
+	GenerateAll = GenerateCastling | GeneratePawns | GenerateKnights | GenerateBishops | GenerateRooks | GenerateQueens | GenerateKing
+)
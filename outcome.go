@@ -0,0 +1,142 @@
+package chess
+
+// The reason a game ended.
+type Termination int
+
+const (
+	TerminationCheckmate Termination = iota + 1
+	TerminationStalemate
+	TerminationInsufficientMaterial
+	TerminationSeventyfiveMoves
+	TerminationFivefoldRepetition
+	TerminationFiftyMoves
+	TerminationThreefoldRepetition
+	TerminationVariantWin
+	TerminationVariantLoss
+	TerminationVariantDraw
+)
+
+var terminationNames = [...]string{
+	TerminationCheckmate:            "checkmate",
+	TerminationStalemate:            "stalemate",
+	TerminationInsufficientMaterial: "insufficient material",
+	TerminationSeventyfiveMoves:     "seventyfive moves",
+	TerminationFivefoldRepetition:   "fivefold repetition",
+	TerminationFiftyMoves:           "fifty moves",
+	TerminationThreefoldRepetition:  "threefold repetition",
+	TerminationVariantWin:           "variant win",
+	TerminationVariantLoss:          "variant loss",
+	TerminationVariantDraw:          "variant draw",
+}
+
+func (t Termination) String() string {
+	if t <= 0 || int(t) >= len(terminationNames) {
+		return "unknown"
+	}
+	return terminationNames[t]
+}
+
+// How a game ended.
+type Outcome struct {
+	Termination Termination
+
+	// The side that won. Only meaningful if the game is not drawn.
+	Winner Colors
+	Draw   bool
+}
+
+// Gets the result in PGN notation: `1-0`, `0-1` or `1/2-1/2`.
+func (o *Outcome) Result() string {
+	if o.Draw {
+		return "1/2-1/2"
+	} else if o.Winner == White {
+		return "1-0"
+	}
+	return "0-1"
+}
+
+// Checks if the game is over and tells why.
+//
+// Games end by checkmate, stalemate, insufficient material, the
+// seventyfive-move rule, fivefold repetition or the special rules of the
+// variant. With `claimDraw` the side to move also claims a draw by the
+// fifty-move rule or threefold repetition, if possible.
+//
+// Legal moves are generated only once, and only until the first one is
+// found.
+//
+// Returns nil if the game is not over.
+//
+//     if outcome := board.Outcome(false); outcome != nil {
+//         fmt.Println(outcome.Result(), outcome.Termination)
+//     }
+func (b *Bitboard) Outcome(claimDraw bool) *Outcome {
+	// Variant win, loss or draw.
+	if b.IsVariantEnd() {
+		if b.variant.isVariantWin(b) {
+			return &Outcome{Termination: TerminationVariantWin, Winner: b.turn}
+		} else if b.variant.isVariantLoss(b) {
+			return &Outcome{Termination: TerminationVariantLoss, Winner: b.turn ^ 1}
+		}
+		return &Outcome{Termination: TerminationVariantDraw, Draw: true}
+	}
+
+	var moves MoveList
+	b.GenerateMovesInto(&moves, GenerateAll)
+	hasLegalMove := b.firstLegalMove(&moves) != -1
+
+	// Checkmate.
+	if !hasLegalMove && b.IsCheck() {
+		return &Outcome{Termination: TerminationCheckmate, Winner: b.turn ^ 1}
+	}
+
+	// Insufficient material.
+	if b.IsInsufficientMaterial() {
+		return &Outcome{Termination: TerminationInsufficientMaterial, Draw: true}
+	}
+
+	// Stalemate.
+	if !hasLegalMove {
+		return &Outcome{Termination: TerminationStalemate, Draw: true}
+	}
+
+	// Seventyfive-move rule.
+	if b.halfMoveClock >= 150 {
+		return &Outcome{Termination: TerminationSeventyfiveMoves, Draw: true}
+	}
+
+	// Fivefold repetition.
+	if b.IsFivefoldRepitition() {
+		return &Outcome{Termination: TerminationFivefoldRepetition, Draw: true}
+	}
+
+	if claimDraw {
+		// Fifty-move rule.
+		if b.halfMoveClock >= 100 {
+			return &Outcome{Termination: TerminationFiftyMoves, Draw: true}
+		}
+
+		// Threefold repetition.
+		if b.canClaimThreefoldRepitition(&moves) {
+			return &Outcome{Termination: TerminationThreefoldRepetition, Draw: true}
+		}
+	}
+
+	return nil
+}
+
+// Gets the index of the first legal move in the list of pseudo legal
+// moves, or -1 if there is none.
+func (b *Bitboard) firstLegalMove(moves *MoveList) int {
+	forcedCapture := b.variant.capturesCompulsory() && b.canCapture()
+	for i := 0; i < moves.Len(); i++ {
+		move := moves.At(i).Move()
+		if forcedCapture && !b.IsCapture(move) {
+			continue
+		}
+		if !b.IsIntoCheck(move) {
+			return i
+		}
+	}
+	return -1
+}
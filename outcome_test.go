@@ -0,0 +1,87 @@
+package chess
+
+import "testing"
+
+func TestOutcome(t *testing.T) {
+	knights := []string{"Nf3", "Nf6", "Ng1", "Ng8"}
+	repeat := func(n int) []string {
+		moves := []string{}
+		for i := 0; i < n; i++ {
+			moves = append(moves, knights...)
+		}
+		return moves
+	}
+
+	tests := []struct {
+		variant     Variant
+		fen         string
+		moves       []string
+		claimDraw   bool
+		termination Termination
+		result      string
+	}{
+		{Standard, StartingFen, nil, true, 0, ""},
+		{Standard, "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", nil, false, TerminationCheckmate, "0-1"},
+		{Standard, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", nil, false, TerminationStalemate, "1/2-1/2"},
+		{Standard, "8/8/8/4k3/8/8/8/4KN2 w - - 0 1", nil, false, TerminationInsufficientMaterial, "1/2-1/2"},
+		// The fifty-move rule can be claimed, the seventyfive-move rule
+		// applies by itself. Mate and stalemate take precedence.
+		{Standard, "8/8/8/4k3/8/8/4P3/4K3 w - - 149 100", nil, true, TerminationFiftyMoves, "1/2-1/2"},
+		{Standard, "8/8/8/4k3/8/8/4P3/4K3 w - - 150 100", nil, false, TerminationSeventyfiveMoves, "1/2-1/2"},
+		{Standard, "8/8/8/8/8/5k2/5p2/5K2 w - - 150 100", nil, false, TerminationStalemate, "1/2-1/2"},
+		{Standard, "8/8/8/8/8/5k2/5q2/5K2 w - - 150 100", nil, false, TerminationCheckmate, "0-1"},
+		// Without a claim the game goes on. Threefold repetition can also
+		// be claimed with the move that repeats.
+		{Standard, "8/8/8/4k3/8/8/4P3/4K3 w - - 100 80", nil, false, 0, ""},
+		{Standard, StartingFen, repeat(2), false, 0, ""},
+		{Standard, StartingFen, repeat(2), true, TerminationThreefoldRepetition, "1/2-1/2"},
+		{Standard, StartingFen, repeat(2)[:7], true, TerminationThreefoldRepetition, "1/2-1/2"},
+		{Standard, StartingFen, repeat(4), false, TerminationFivefoldRepetition, "1/2-1/2"},
+		// Variants.
+		{KingOfTheHill, "4k3/8/8/8/3K4/8/8/8 b - - 0 1", nil, false, TerminationVariantLoss, "1-0"},
+		{Antichess, "8/8/8/8/8/p7/P7/8 w - - 0 1", nil, false, TerminationVariantWin, "1-0"},
+		{RacingKings, "K6k/8/8/8/8/8/8/8 w - - 0 1", nil, false, TerminationVariantDraw, "1/2-1/2"},
+		{ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 0 1 +2+0", []string{"Ra8+"}, false, TerminationVariantLoss, "1-0"},
+		{Horde, "4k3/8/8/8/8/8/8/8 w - - 0 1", nil, false, TerminationVariantLoss, "0-1"},
+	}
+
+	for _, test := range tests {
+		board := NewVariantBitboard(test.variant, test.fen)
+		for _, san := range test.moves {
+			if _, err := board.PushSan(san); err != nil {
+				t.Fatalf("%s %s: %s", test.fen, san, err)
+			}
+		}
+
+		outcome := board.Outcome(test.claimDraw)
+		if test.termination == 0 {
+			if outcome != nil {
+				t.Errorf("%s after %d moves: expected the game to go on, got %s", test.fen, len(test.moves), outcome.Termination)
+			}
+			if board.IsGameOver() {
+				t.Errorf("%s after %d moves: expected IsGameOver to agree", test.fen, len(test.moves))
+			}
+			continue
+		}
+
+		if outcome == nil {
+			t.Errorf("%s after %d moves: expected %s, got nil", test.fen, len(test.moves), test.termination)
+			continue
+		}
+		if outcome.Termination != test.termination || outcome.Result() != test.result {
+			t.Errorf("%s after %d moves: expected %s %s, got %s %s", test.fen, len(test.moves), test.termination, test.result, outcome.Termination, outcome.Result())
+		}
+		if !test.claimDraw && !board.IsGameOver() {
+			t.Errorf("%s after %d moves: expected IsGameOver to agree", test.fen, len(test.moves))
+		}
+	}
+}
+
+func TestTerminationString(t *testing.T) {
+	if s := TerminationFivefoldRepetition.String(); s != "fivefold repetition" {
+		t.Errorf("unexpected name '%s'", s)
+	}
+	if s := Termination(0).String(); s != "unknown" {
+		t.Errorf("unexpected name '%s'", s)
+	}
+}
@@ -0,0 +1,51 @@
+package chess
+
+// Counts the leaf nodes of the tree of legal moves with the given depth.
+//
+// Perft (performance test) results are well known for many positions, so
+// comparing them is a thorough way to verify move generation, making and
+// unmaking moves. It is also a convenient benchmark for the move
+// generator.
+//
+//     board := chess.NewBitboard("")
+//     board.Perft(4) // 197281
+func (b *Bitboard) Perft(depth int) int64 {
+	if depth < 1 {
+		return 1
+	}
+
+	moves := b.GenerateLegalMoves(true, true, true, true, true, true, true)
+	if depth == 1 {
+		return int64(len(moves))
+	}
+
+	nodes := int64(0)
+	for _, move := range moves {
+		b.Push(move)
+		nodes += b.Perft(depth - 1)
+		b.Pop()
+	}
+
+	return nodes
+}
+
+// Like `Perft()`, but the leaf nodes are counted separately for each legal
+// move in the current position. The result is keyed by the UCI notation of
+// the moves.
+//
+// This helps to narrow down the move that is handled incorrectly when
+// perft results differ.
+func (b *Bitboard) Divide(depth int) map[string]int64 {
+	result := map[string]int64{}
+	if depth < 1 {
+		return result
+	}
+
+	for _, move := range b.GenerateLegalMoves(true, true, true, true, true, true, true) {
+		b.Push(move)
+		result[move.Uci()] = b.Perft(depth - 1)
+		b.Pop()
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+package chess
+
+import "testing"
+
+// Well known perft results, see https://www.chessprogramming.org/Perft_Results.
+var perftTests = []struct {
+	name  string
+	fen   string
+	nodes []int64
+}{
+	{
+		"start",
+		StartingFen,
+		[]int64{20, 400, 8902, 197281},
+	},
+	{
+		"kiwipete",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		[]int64{48, 2039, 97862},
+	},
+	{
+		"position 3",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		[]int64{14, 191, 2812, 43238, 674624},
+	},
+	{
+		"position 4",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		[]int64{6, 264, 9467, 422333},
+	},
+	{
+		"position 5",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		[]int64{44, 1486, 62379},
+	},
+	{
+		"position 6",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		[]int64{46, 2079, 89890},
+	},
+}
+
+func TestPerft(t *testing.T) {
+	for _, test := range perftTests {
+		board := NewBitboard(test.fen)
+		for i, expected := range test.nodes {
+			depth := i + 1
+			if testing.Short() && expected > 100000 {
+				break
+			}
+			if nodes := board.Perft(depth); nodes != expected {
+				t.Errorf("%s: perft(%d) = %d, expected %d", test.name, depth, nodes, expected)
+			}
+		}
+		if board.Fen() != test.fen {
+			t.Errorf("%s: board not restored, got '%s'", test.name, board.Fen())
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	board := NewBitboard(StartingFen)
+	divide := board.Divide(3)
+	if len(divide) != 20 {
+		t.Fatalf("expected 20 moves, got %d", len(divide))
+	}
+
+	total := int64(0)
+	for _, nodes := range divide {
+		total += nodes
+	}
+	if total != 8902 {
+		t.Errorf("expected 8902 nodes in total, got %d", total)
+	}
+	if divide["e2e4"] != 600 || divide["g1f3"] != 440 {
+		t.Errorf("unexpected divide: e2e4 = %d, g1f3 = %d", divide["e2e4"], divide["g1f3"])
+	}
+}
+
+func BenchmarkPerft(b *testing.B) {
+	board := NewBitboard("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	for i := 0; i < b.N; i++ {
+		board.Perft(3)
+	}
+}
@@ -42,7 +42,7 @@ const (
 
 var TagRegex = regexp.MustCompile("\\[([A-Za-z0-9]+)\\s+\"(.*)\"\\]")
 
-var MoveTextRegex = regexp.MustCompile("(?s)(%.*?[\\n\\r])|(\\{.*)|(\\$[0-9]+)|(\\()|(\\))|(\\*|1-0|0-1|1/2-1/2)|([NBKRQ]?[a-h]?[1-8]?[\\-x]?[a-h][1-8](?:=[nbrqNBRQ])?|--|O-O(?:-O)?|0-0(?:-0)?)|([\\?!]{1,2})")
+var MoveTextRegex = regexp.MustCompile("(?s)(%.*?[\\n\\r])|(\\{.*)|(\\$[0-9]+)|(\\()|(\\))|(\\*|1-0|0-1|1/2-1/2)|([NBKRQ]?[a-h]?[1-8]?[\\-x]?[a-h][1-8](?:=[nbrqNBRQ])?|[NBRQP]?@[a-h][1-8]|--|O-O(?:-O)?|0-0(?:-0)?)|([\\?!]{1,2})")
 
 type GameNode struct {
 	parent          *GameNode
@@ -65,13 +65,25 @@ type GameNode struct {
 // It's a copy, so modifying the board will not alter the game.
 func (g *GameNode) Board() *Bitboard {
 	if g.parent == nil {
+		// Unknown variants are played by the standard rules.
+		variant := VariantByName(g.Headers["Variant"])
+		if variant == nil {
+			variant = Standard
+		}
+
+		board := NewVariantBitboard(variant, "")
 		if fen, ok := g.Headers["FEN"]; ok {
 			if v, ok := g.Headers["SetUp"]; ok && v == "1" {
-				return NewBitboard(fen)
+				board = NewVariantBitboard(variant, fen)
 			}
 		}
 
-		return NewBitboard("")
+		switch strings.ToLower(g.Headers["Variant"]) {
+		case "chess960", "chess 960", "fischerandom", "fischer random":
+			board.SetChess960(true)
+		}
+
+		return board
 	}
 
 	if g.boardCached == nil {
@@ -79,9 +91,7 @@ func (g *GameNode) Board() *Bitboard {
 		g.boardCached.Push(g.move)
 	}
 
-	board := NewBitboard(g.boardCached.Fen())
-
-	return board
+	return g.boardCached.Copy(true)
 }
 
 func (g *GameNode) GetParent() *GameNode {
@@ -371,17 +381,47 @@ func NewGame() *GameNode {
 }
 
 // Setup a specific starting position. This sets (or resets) the `SetUp`
-// and `FEN` header tags.
+// and `FEN` header tags, and the `Variant` tag for games that are not
+// standard chess.
 func (g *GameNode) Setup(board *Bitboard) {
 	fen := board.Fen()
 
-	if fen == StartingFen {
+	if fen == board.Variant().StartingFen() {
 		delete(g.Headers, "SetUp")
 		delete(g.Headers, "FEN")
 	} else {
 		g.Headers["SetUp"] = "1"
 		g.Headers["FEN"] = fen
 	}
+
+	if board.Variant() != Standard {
+		g.Headers["Variant"] = board.Variant().Name()
+	} else if board.IsChess960() {
+		g.Headers["Variant"] = "Chess960"
+	} else {
+		delete(g.Headers, "Variant")
+	}
+}
+
+// Sets the `Result` and `Termination` header tags from the outcome at the
+// end of the main line, see `Bitboard.Outcome()`. The termination is
+// `normal`, as defined by the PGN standard. Games that are not over get
+// the result `*` and no termination.
+//
+// Returns the outcome or nil if the game is not over.
+func (g *GameNode) UpdateResult(claimDraw bool) *Outcome {
+	root := g.Root()
+	outcome := root.End().Board().Outcome(claimDraw)
+
+	if outcome == nil {
+		root.Headers["Result"] = "*"
+		delete(root.Headers, "Termination")
+	} else {
+		root.Headers["Result"] = outcome.Result()
+		root.Headers["Termination"] = "normal"
+	}
+
+	return outcome
 }
 
 // Allows exporting a game as a string.
@@ -806,7 +846,7 @@ func (r *PGNReader) Next() bool {
 					variationStack.Push(tmp.parent)
 
 					tmpBoard := boardStack.Pop().(*Bitboard)
-					board := NewBitboard(tmpBoard.Fen())
+					board := tmpBoard.Copy(true)
 					board.Pop()
 					boardStack.Push(tmpBoard)
 					boardStack.Push(board)
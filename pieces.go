@@ -55,10 +55,14 @@ const (
 	StatusBadCastlingRights
 	StatusInvalidEpSquare
 	StatusOppositeCheck
+	StatusRaceCheck
+	StatusRaceMaterial
 )
 
-var SanRegex = regexp.MustCompile("^([NBKRQ])?([a-h])?([1-8])?x?([a-h][1-8])(=[nbrqNBRQ])?(\\+|#)?$")
-var FenCastlingRegex = regexp.MustCompile("^(KQ?k?q?|Qk?q?|kq?|q|-)$")
+var SanRegex = regexp.MustCompile("^([NBKRQ])?([a-h])?([1-8])?x?([a-h][1-8])(=[nbrqkNBRQK])?(\\+|#)?$")
+var DropSanRegex = regexp.MustCompile("^([NBRQP])?@([a-h][1-8])(\\+|#)?$")
+var FenCastlingRegex = regexp.MustCompile("^(-|[KQA-H]{1,2}[kqa-h]{0,2}|[kqa-h]{1,2})$")
+var FenChecksRegex = regexp.MustCompile("^(\\+)?([0-3])\\+([0-3])$")
 
 const (
 	A1 = iota
@@ -149,39 +153,6 @@ var Squares180 = [...]int{
 	A1, B1, C1, D1, E1, F1, G1, H1,
 }
 
-var SquaresL90 = [...]int{
-	H1, H2, H3, H4, H5, H6, H7, H8,
-	G1, G2, G3, G4, G5, G6, G7, G8,
-	F1, F2, F3, F4, F5, F6, F7, F8,
-	E1, E2, E3, E4, E5, E6, E7, E8,
-	D1, D2, D3, D4, D5, D6, D7, D8,
-	C1, C2, C3, C4, C5, C6, C7, C8,
-	B1, B2, B3, B4, B5, B6, B7, B8,
-	A1, A2, A3, A4, A5, A6, A7, A8,
-}
-
-var SquaresR45 = [...]int{
-	A1, B8, C7, D6, E5, F4, G3, H2,
-	A2, B1, C8, D7, E6, F5, G4, H3,
-	A3, B2, C1, D8, E7, F6, G5, H4,
-	A4, B3, C2, D1, E8, F7, G6, H5,
-	A5, B4, C3, D2, E1, F8, G7, H6,
-	A6, B5, C4, D3, E2, F1, G8, H7,
-	A7, B6, C5, D4, E3, F2, G1, H8,
-	A8, B7, C6, D5, E4, F3, G2, H1,
-}
-
-var SquaresL45 = [...]int{
-	A2, B3, C4, D5, E6, F7, G8, H1,
-	A3, B4, C5, D6, E7, F8, G1, H2,
-	A4, B5, C6, D7, E8, F1, G2, H3,
-	A5, B6, C7, D8, E1, F2, G3, H4,
-	A6, B7, C8, D1, E2, F3, G4, H5,
-	A7, B8, C1, D2, E3, F4, G5, H6,
-	A8, B1, C2, D3, E4, F5, G6, H7,
-	A1, B2, C3, D4, E5, F6, G7, H8,
-}
-
 var SquareNames = [...]string{
 	"a1", "b1", "c1", "d1", "e1", "f1", "g1", "h1",
 	"a2", "b2", "c2", "d2", "e2", "f2", "g2", "h2",
@@ -215,6 +186,20 @@ const (
 	Castling      = CastlingWhite | CastlingBlack
 )
 
+// Castling sides, used together with a color to index castling flags and
+// the files of the castling rooks.
+const (
+	kingSide  = 0
+	queenSide = 1
+)
+
+var castlingFlags = [2][2]int{
+	{CastlingWhiteKingSide, CastlingWhiteQueenSide},
+	{CastlingBlackKingSide, CastlingBlackQueenSide},
+}
+
+var defaultCastlingRookFiles = [2][2]int{{7, 0}, {7, 0}}
+
 const BBVoid uint64 = 0
 const BBAll uint64 = 0xffffffffffffffff
 
@@ -296,10 +281,6 @@ var BBSquares = [...]uint64{
 	BBA8, BBB8, BBC8, BBD8, BBE8, BBF8, BBG8, BBH8,
 }
 
-var BBSquaresL90 [64]uint64
-var BBSquaresL45 [64]uint64
-var BBSquaresR45 [64]uint64
-
 var BBLightSquares = BBVoid
 var BBDarkSquares = BBVoid
 
@@ -336,6 +317,9 @@ const (
 	BBRank8 = BBA8 | BBB8 | BBC8 | BBD8 | BBE8 | BBF8 | BBG8 | BBH8
 )
 
+// The four center squares.
+const BBCenter = BBD4 | BBE4 | BBD5 | BBE5
+
 var BBRanks = [...]uint64{
 	BBRank1,
 	BBRank2,
@@ -349,33 +333,6 @@ var BBRanks = [...]uint64{
 
 var BBKnightAttacks []uint64
 var BBKingAttacks []uint64
-var BBRankAttacks [64][64]uint64
-var BBFileAttacks [64][64]uint64
-
-var BBShiftR45 = [...]uint{
-	1, 58, 51, 44, 37, 30, 23, 16,
-	9, 1, 58, 51, 44, 37, 30, 23,
-	17, 9, 1, 58, 51, 44, 37, 30,
-	25, 17, 9, 1, 58, 51, 44, 37,
-	33, 25, 17, 9, 1, 58, 51, 44,
-	41, 33, 25, 17, 9, 1, 58, 51,
-	49, 41, 33, 25, 17, 9, 1, 58,
-	57, 49, 41, 33, 25, 17, 9, 1,
-}
-
-var BBShiftL45 = [...]uint{
-	9, 17, 25, 33, 41, 49, 57, 1,
-	17, 25, 33, 41, 49, 57, 1, 10,
-	25, 33, 41, 49, 57, 1, 10, 19,
-	33, 41, 49, 57, 1, 10, 19, 28,
-	41, 49, 57, 1, 10, 19, 28, 37,
-	49, 57, 1, 10, 19, 28, 37, 46,
-	57, 1, 10, 19, 28, 37, 46, 55,
-	1, 10, 19, 28, 37, 46, 55, 64,
-}
-
-var BBL45Attacks [64][64]uint64
-var BBR45Attacks [64][64]uint64
 
 var BBPawnAttacks [2][64]uint64
 var BBPawnF1 [2][64]uint64
@@ -385,23 +342,13 @@ var BBPawnAll [2][64]uint64
 
 func init() {
 	for square, mask := range BBSquares {
-		if (fileIndex(square) + rankIndex(square)%2) == 1 {
+		if (fileIndex(square)+rankIndex(square))%2 == 1 {
 			BBLightSquares |= mask
 		} else {
 			BBDarkSquares |= mask
 		}
 	}
 
-	for _, square := range Squares {
-		BBSquaresL90[square] = BBSquares[SquaresL90[square]]
-	}
-	for _, square := range Squares {
-		BBSquaresL45[square] = BBSquares[SquaresL45[square]]
-	}
-	for _, square := range Squares {
-		BBSquaresR45[square] = BBSquares[SquaresR45[square]]
-	}
-
 	for _, bbSquare := range BBSquares {
 		mask := BBVoid
 		mask |= shiftLeft(shift2Up(bbSquare))
@@ -426,98 +373,6 @@ func init() {
 		BBKingAttacks = append(BBKingAttacks, mask&BBAll)
 	}
 
-	for _, square := range Squares {
-		for bitrow := 0; bitrow < 64; bitrow++ {
-			f := fileIndex(square) + 1
-			q := square + 1
-			for f < 8 {
-				BBRankAttacks[square][bitrow] |= BBSquares[q]
-				if (1<<uint(f))&(bitrow<<1) > 0 {
-					break
-				}
-				q++
-				f++
-			}
-
-			f = fileIndex(square) - 1
-			q = square - 1
-			for f >= 0 {
-				BBRankAttacks[square][bitrow] |= BBSquares[q]
-				if (1<<uint(f))&(bitrow<<1) > 0 {
-					break
-				}
-				q--
-				f--
-			}
-
-			r := rankIndex(square) + 1
-			q = square + 8
-			for r < 8 {
-				BBFileAttacks[square][bitrow] |= BBSquares[q]
-				if (1<<uint(7-r))&(bitrow<<1) > 0 {
-					break
-				}
-				q += 8
-				r++
-			}
-
-			r = rankIndex(square) - 1
-			q = square - 8
-			for r >= 0 {
-				BBFileAttacks[square][bitrow] |= BBSquares[q]
-				if (1<<uint(7-r))&(bitrow<<1) > 0 {
-					break
-				}
-				q -= 8
-				r--
-			}
-
-			mask := BBVoid
-
-			q = square
-			for fileIndex(q) > 0 && rankIndex(q) < 7 {
-				q += 7
-				mask |= BBSquares[q]
-				if uint64(bitrow)&(BBSquaresL45[q]>>BBShiftL45[square]) > 0 {
-					break
-				}
-			}
-
-			q = square
-			for fileIndex(q) < 7 && rankIndex(q) > 0 {
-				q -= 7
-				mask |= BBSquares[q]
-				if uint64(bitrow)&(BBSquaresL45[q]>>BBShiftL45[square]) > 0 {
-					break
-				}
-			}
-
-			BBL45Attacks[square][bitrow] = mask
-
-			mask = BBVoid
-
-			q = square
-			for fileIndex(q) < 7 && rankIndex(q) < 7 {
-				q += 9
-				mask |= BBSquares[q]
-				if uint64(bitrow)&(BBSquaresR45[q]>>BBShiftR45[square]) > 0 {
-					break
-				}
-			}
-
-			q = square
-			for fileIndex(q) > 0 && rankIndex(q) > 0 {
-				q -= 9
-				mask |= BBSquares[q]
-				if uint64(bitrow)&(BBSquaresR45[q]>>BBShiftR45[square]) > 0 {
-					break
-				}
-			}
-
-			BBR45Attacks[square][bitrow] = mask
-		}
-	}
-
 	for i, s := range BBSquares {
 		BBPawnAttacks[0][i] = shiftUpLeft(s) | shiftUpRight(s)
 		BBPawnAttacks[1][i] = shiftDownLeft(s) | shiftDownRight(s)
@@ -525,8 +380,9 @@ func init() {
 		BBPawnF1[0][i] = shiftUp(s)
 		BBPawnF1[1][i] = shiftDown(s)
 
-		BBPawnF2[0][i] = shift2Up(s)
-		BBPawnF2[1][i] = shift2Down(s)
+		// Double pawn pushes are only possible from the starting rank.
+		BBPawnF2[0][i] = shift2Up(s & (BBRank1 | BBRank2))
+		BBPawnF2[1][i] = shift2Down(s & (BBRank7 | BBRank8))
 	}
 
 	for i := range Squares {
@@ -583,42 +439,6 @@ func shiftDownRight(b uint64) uint64 {
 	return (b >> 7) & ^BBFileA
 }
 
-func l90(b uint64) uint64 {
-	mask := BBVoid
-
-	square := bitScan(b, 0)
-	for square != -1 {
-		mask |= BBSquaresL90[square]
-		square = bitScan(b, square+1)
-	}
-
-	return mask
-}
-
-func r45(b uint64) uint64 {
-	mask := BBVoid
-
-	square := bitScan(b, 0)
-	for square != -1 {
-		mask |= BBSquaresR45[square]
-		square = bitScan(b, square+1)
-	}
-
-	return mask
-}
-
-func l45(b uint64) uint64 {
-	mask := BBVoid
-
-	square := bitScan(b, 0)
-	for square != -1 {
-		mask |= BBSquaresL45[square]
-		square = bitScan(b, square+1)
-	}
-
-	return mask
-}
-
 var PolyglotRandomArray = []uint64{
 	0x9D39247E33776D41, 0x2AF7398005AAA5C7, 0x44DB015024623547, 0x9C15F73E62A76AE2,
 	0x75834465489C0C89, 0x3290AC3A203001BF, 0x0FBBAD1F61042279, 0xE83A908FF2FB60CA,
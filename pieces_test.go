@@ -0,0 +1,40 @@
+package chess
+
+import "testing"
+
+func TestSquareColors(t *testing.T) {
+	if popCount(BBLightSquares) != 32 || popCount(BBDarkSquares) != 32 || BBLightSquares&BBDarkSquares != 0 {
+		t.Fatalf("light and dark squares do not split the board: %x, %x", BBLightSquares, BBDarkSquares)
+	}
+
+	for _, square := range []int{A1, C1, B2, H2, E5, H8} {
+		if BBDarkSquares&BBSquares[square] == 0 {
+			t.Errorf("expected %s to be dark", SquareNames[square])
+		}
+	}
+	for _, square := range []int{B1, D1, H1, A2, D5, A8} {
+		if BBLightSquares&BBSquares[square] == 0 {
+			t.Errorf("expected %s to be light", SquareNames[square])
+		}
+	}
+}
+
+func TestInsufficientMaterialBishops(t *testing.T) {
+	tests := []struct {
+		fen          string
+		insufficient bool
+	}{
+		// Bishops on b1 and d1 are both on light squares.
+		{"4k3/8/8/8/8/8/8/1B1bK3 w - - 0 1", true},
+		// Bishops on c2 and g1 are on different colors.
+		{"4k3/8/8/8/8/8/2B5/4K1b1 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1", true},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if insufficient := board.IsInsufficientMaterial(); insufficient != test.insufficient {
+			t.Errorf("%s: expected %v, got %v", test.fen, test.insufficient, insufficient)
+		}
+	}
+}
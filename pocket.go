@@ -0,0 +1,234 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// State of variants, saved as part of `boardState` before each move and
+// restored by `Pop()`.
+type variantState struct {
+	pockets  [2][7]int
+	promoted uint64
+	checks   [2]int
+
+	// Pieces removed by an explosion in Atomic.
+	exploded []explodedPiece
+}
+
+type explodedPiece struct {
+	square int
+	piece  *Piece
+}
+
+// Creates a new bitboard for the given variant. An empty FEN gives the
+// starting position of the variant.
+func NewVariantBitboard(variant Variant, fen string) *Bitboard {
+	if fen == "" {
+		fen = variant.StartingFen()
+	}
+
+	result := NewBitboard("")
+	result.variant = variant
+	result.SetFen(fen)
+	return result
+}
+
+// Gets the variant of the board.
+func (b *Bitboard) Variant() Variant {
+	return b.variant
+}
+
+// Switches the rules to the given variant. Pockets are emptied when
+// switching to a variant without drops. This should not be called while
+// there are moves on the stack.
+func (b *Bitboard) SetVariant(variant Variant) {
+	b.variant = variant
+	if !variant.HasDrops() {
+		b.pockets = [2][7]int{}
+		b.promoted = BBVoid
+	}
+}
+
+// Gets the number of pieces of the given type in the pocket of the given
+// color.
+func (b *Bitboard) Pocket(color Colors, pieceType PieceTypes) int {
+	return b.pockets[color][pieceType]
+}
+
+// Sets the number of pieces of the given type in the pocket of the given
+// color. Kings can not be put into a pocket and counts above
+// `maxPocketCount` are ignored.
+func (b *Bitboard) SetPocket(color Colors, pieceType PieceTypes, count int) {
+	if pieceType >= Pawn && pieceType < King && count >= 0 && count <= maxPocketCount {
+		b.pockets[color][pieceType] = count
+	}
+}
+
+// Gets a mask of pieces that were promoted from pawns. In variants with
+// drops they turn back into pawns when captured.
+func (b *Bitboard) Promoted() uint64 {
+	return b.promoted
+}
+
+// Gets the total number of pieces in the pocket of the given color.
+func (b *Bitboard) pocketCount(color Colors) int {
+	count := 0
+	for pieceType := Pawn; pieceType < King; pieceType++ {
+		count += b.pockets[color][pieceType]
+	}
+	return count
+}
+
+// Keeps track of promoted pieces and puts captured pieces into the pocket
+// of the side to move. Called by `Push()` before the pieces are moved.
+func (b *Bitboard) updatePockets(move *Move, capturedPiece PieceTypes) {
+	toMask := BBSquares[move.toSquare]
+	capturedPromoted := b.promoted&toMask > 0
+	b.promoted &= ^toMask
+
+	if capturedPiece != None {
+		if capturedPromoted {
+			capturedPiece = Pawn
+		}
+		b.pockets[b.turn][capturedPiece]++
+	}
+
+	if b.promoted&BBSquares[move.fromSquare] > 0 || move.promotion != None {
+		b.promoted = b.promoted&^BBSquares[move.fromSquare] | toMask
+	}
+}
+
+// Appends drops of the pieces in the pocket of the side to move. Pawns can
+// not be dropped on the backranks.
+func (b *Bitboard) generateDrops(buf *MoveList, filter MoveFilter) {
+	for pieceType := Pawn; pieceType < King; pieceType++ {
+		if b.pockets[b.turn][pieceType] == 0 || filter&dropFilters[pieceType] == 0 {
+			continue
+		}
+
+		targets := ^b.occupied
+		if pieceType == Pawn {
+			targets &= ^(BBRank1 | BBRank8)
+		}
+		for squares := targets; squares != 0; squares &= squares - 1 {
+			buf.addDrop(lsb(squares), pieceType)
+		}
+	}
+}
+
+// Counts the drops of the side to move, like `generateDrops()`.
+func (b *Bitboard) dropCount() int {
+	count := 0
+	for pieceType := Pawn; pieceType < King; pieceType++ {
+		if b.pockets[b.turn][pieceType] == 0 {
+			continue
+		}
+
+		targets := ^b.occupied
+		if pieceType == Pawn {
+			targets &= ^(BBRank1 | BBRank8)
+		}
+		count += popCount(targets)
+	}
+	return count
+}
+
+// The filter flags selecting drops by piece type.
+var dropFilters = [...]MoveFilter{
+	None:   0,
+	Pawn:   GeneratePawns,
+	Knight: GenerateKnights,
+	Bishop: GenerateBishops,
+	Rook:   GenerateRooks,
+	Queen:  GenerateQueens,
+	King:   0,
+}
+
+// The most pieces of a type a pocket can hold when set up from a FEN or
+// with `SetPocket()`. There are only 32 pieces in a game.
+const maxPocketCount = 32
+
+// Values to hash in the number of pieces of each type in the pockets,
+// indexed by color, piece type and count. No piece at all leaves the hash
+// unchanged.
+var pocketZobristArray [2][7][maxPocketCount + 1]uint64
+
+func init() {
+	// Fixed seed, so that hashes are the same across runs.
+	seed := uint64(0x9e3779b97f4a7c15)
+	for color := range pocketZobristArray {
+		for pieceType := range pocketZobristArray[color] {
+			for count := 1; count < len(pocketZobristArray[color][pieceType]); count++ {
+				pocketZobristArray[color][pieceType][count] = splitMix64(&seed)
+			}
+		}
+	}
+}
+
+// Gets the value to hash in for the number of pieces of a type in a
+// pocket. Positions with more pieces than a game has can still fill a
+// pocket beyond `maxPocketCount` by captures. Those counts are mixed from
+// the last value of the table.
+func pocketZobrist(color Colors, pieceType PieceTypes, count int) uint64 {
+	values := &pocketZobristArray[color][pieceType]
+	if count < len(values) {
+		return values[count]
+	}
+	seed := values[maxPocketCount] ^ uint64(count)
+	return splitMix64(&seed)
+}
+
+// Gets the next value of a SplitMix64 generator.
+func splitMix64(seed *uint64) uint64 {
+	*seed += 0x9e3779b97f4a7c15
+	z := *seed
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Gets the pocket part of a FEN, for example `[Nbp]`. White pieces come
+// first, both sorted from queens to pawns.
+func (b *Bitboard) pocketFen() string {
+	result := "["
+	for color := White; color <= Black; color++ {
+		for pieceType := Queen; pieceType >= Pawn; pieceType-- {
+			symbol := NewPiece(pieceType, color).String()
+			result += strings.Repeat(symbol, b.pockets[color][pieceType])
+		}
+	}
+	return result + "]"
+}
+
+// Splits the pockets from the board part of a FEN. They can be given in
+// brackets or as a ninth row: `RNBQKBNR[Nbp]` or `RNBQKBNR/Nbp`.
+func splitPocketFen(boardPart string) (string, string, bool) {
+	if strings.HasSuffix(boardPart, "]") {
+		if i := strings.Index(boardPart, "["); i >= 0 {
+			return boardPart[:i], boardPart[i+1 : len(boardPart)-1], true
+		}
+	}
+
+	if rows := strings.Split(boardPart, "/"); len(rows) == 9 {
+		return strings.Join(rows[:8], "/"), rows[8], true
+	}
+
+	return boardPart, "", false
+}
+
+// Parses the pockets of a FEN.
+func parsePocketFen(pocketPart string) ([2][7]int, error) {
+	var pockets [2][7]int
+	for _, c := range pocketPart {
+		piece := PieceFromSymbol(string(c))
+		if piece == nil || piece.pieceType == King {
+			return pockets, fmt.Errorf("invalid pocket in fen: '%s'.", pocketPart)
+		}
+		pockets[piece.color][piece.pieceType]++
+		if pockets[piece.color][piece.pieceType] > maxPocketCount {
+			return pockets, fmt.Errorf("too many pieces in pocket in fen: '%s'.", pocketPart)
+		}
+	}
+	return pockets, nil
+}
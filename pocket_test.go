@@ -0,0 +1,120 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCrazyhouseSan(t *testing.T) {
+	board := NewVariantBitboard(Crazyhouse, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/R1BQKBNR[NPp] w KQkq - 0 1")
+
+	tests := []struct {
+		san string
+		uci string
+	}{
+		{"d4", "d2d4"},
+		{"Nh3", "g1h3"},
+		{"Nf3", "g1f3"},
+		{"N@c3", "N@c3"},
+		{"@e4", "P@e4"},
+		{"P@e4", "P@e4"},
+	}
+	for _, test := range tests {
+		move, err := board.ParseSan(test.san)
+		if err != nil {
+			t.Errorf("%s: %s", test.san, err)
+		} else if move.Uci() != test.uci {
+			t.Errorf("%s: expected %s, got %s", test.san, test.uci, move.Uci())
+		}
+	}
+
+	for _, san := range []string{"Q@d4", "@e1", "Nb1"} {
+		if _, err := board.ParseSan(san); err == nil {
+			t.Errorf("%s: expected an error", san)
+		}
+	}
+
+	// Every legal move, including drops, round-trips through SAN.
+	for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+		san := board.San(move)
+		parsed, err := board.ParseSan(san)
+		if err != nil {
+			t.Errorf("%s: %s", san, err)
+		} else if !parsed.Equals(move) {
+			t.Errorf("%s: expected %s, got %s", san, move.Uci(), parsed.Uci())
+		}
+	}
+}
+
+func TestCrazyhousePgn(t *testing.T) {
+	pgn := "[Variant \"Crazyhouse\"]\n\n1. e4 d5 2. exd5 Qxd5 3. Nc3 Qa5 4. Nf3 Nf6 5. d4 @e4 *\n"
+
+	reader := NewPGNReader(strings.NewReader(pgn))
+	if !reader.Next() {
+		t.Fatal("no game found")
+	}
+	game, err := reader.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	board := game.End().Board()
+	if len(board.MoveStack()) != 10 {
+		t.Fatalf("expected 10 moves, got %d", len(board.MoveStack()))
+	}
+	expected := "rnb1kb1r/ppp1pppp/5n2/q7/3Pp3/2N2N2/PPP2PPP/R1BQKB1R[P] w KQkq - 1 6"
+	if fen := board.Fen(); fen != expected {
+		t.Errorf("expected '%s', got '%s'", expected, fen)
+	}
+
+	// The exported game reads back to the same position.
+	exporter := NewStringExporter(0)
+	game.Export(exporter, true, true, nil, false, true)
+	exported := exporter.String()
+	reader = NewPGNReader(strings.NewReader(exported + "\n"))
+	if !reader.Next() {
+		t.Fatalf("no game found in exported pgn: %s", exported)
+	}
+	reread, err := reader.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fen := reread.End().Board().Fen(); fen != expected {
+		t.Errorf("exported game ends in '%s':\n%s", fen, exported)
+	}
+}
+
+func TestPocketLimits(t *testing.T) {
+	board := NewVariantBitboard(Crazyhouse, "")
+
+	pocket := strings.Repeat("P", maxPocketCount+1)
+	if err := board.SetFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[" + pocket + "] w KQkq - 0 1"); err == nil {
+		t.Error("expected an error for too many pieces in a pocket")
+	}
+
+	board.SetPocket(White, Pawn, maxPocketCount+8)
+	if count := board.Pocket(White, Pawn); count != 0 {
+		t.Errorf("expected the count to be ignored, got %d", count)
+	}
+	board.SetPocket(White, Pawn, maxPocketCount)
+	if count := board.Pocket(White, Pawn); count != maxPocketCount {
+		t.Errorf("expected %d pawns, got %d", maxPocketCount, count)
+	}
+
+	// Captures can still overflow the pocket in made up positions.
+	if err := board.SetFen("k6r/8/8/8/8/8/8/K6Q[" + strings.Repeat("q", maxPocketCount) + "] b - - 0 1"); err != nil {
+		t.Fatal(err)
+	}
+	hash := board.ZobristHash(nil)
+	board.Push(NewMove(H8, H1, None))
+	if count := board.Pocket(Black, Queen); count != maxPocketCount+1 {
+		t.Errorf("expected %d queens, got %d", maxPocketCount+1, count)
+	}
+	if board.ZobristHash(nil) == hash {
+		t.Error("expected the capture to change the hash")
+	}
+	board.Pop()
+	if board.ZobristHash(nil) != hash {
+		t.Error("hash changed after undoing the capture")
+	}
+}
@@ -0,0 +1,552 @@
+package chess
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// Size of a single entry in a polyglot opening book in bytes.
+const PolyglotEntrySize = 16
+
+// An entry from a polyglot opening book.
+//
+// The key is the Zobrist hash of the position the entry belongs to, as
+// produced by `Bitboard.ZobristHash(nil)`. The raw move is the packed 16 bit
+// move as stored in the book, while `Move` is the decoded move in the
+// context of the position.
+type PolyglotEntry struct {
+	Key     uint64
+	RawMove uint16
+	Weight  uint16
+	Learn   uint32
+	Move    *Move
+}
+
+// Reads entries from a polyglot opening book.
+//
+// A book is a sorted sequence of 16 byte entries, so looking up a position
+// is a binary search over the file. The book is never loaded into memory
+// as a whole.
+//
+//     book, _ := os.Open("data/opening-books/performance.bin")
+//     reader, _ := chess.NewPolyglotReader(book)
+//     entry, err := reader.Find(chess.NewBitboard(""))
+//     if err == nil {
+//         fmt.Println(entry.Move.Uci()) // e2e4
+//     }
+type PolyglotReader struct {
+	handle  io.ReadSeeker
+	entries int64
+}
+
+func NewPolyglotReader(handle io.ReadSeeker) (*PolyglotReader, error) {
+	size, err := handle.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	if size%PolyglotEntrySize != 0 {
+		return nil, fmt.Errorf("invalid polyglot book size: %d bytes.", size)
+	}
+
+	return &PolyglotReader{handle: handle, entries: size / PolyglotEntrySize}, nil
+}
+
+// Gets the number of entries in the book.
+func (r *PolyglotReader) Len() int {
+	return int(r.entries)
+}
+
+// Reads the entry with the given index. The move is not decoded, since
+// that requires a position.
+func (r *PolyglotReader) entryAt(index int64) (*PolyglotEntry, error) {
+	if _, err := r.handle.Seek(index*PolyglotEntrySize, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var buf [PolyglotEntrySize]byte
+	if _, err := io.ReadFull(r.handle, buf[:]); err != nil {
+		return nil, err
+	}
+
+	return &PolyglotEntry{
+		Key:     binary.BigEndian.Uint64(buf[0:8]),
+		RawMove: binary.BigEndian.Uint16(buf[8:10]),
+		Weight:  binary.BigEndian.Uint16(buf[10:12]),
+		Learn:   binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+// Finds the index of the first entry with the given key or a greater key.
+func (r *PolyglotReader) bisectKeyLeft(key uint64) (int64, error) {
+	lo, hi := int64(0), r.entries
+	for lo < hi {
+		mid := (lo + hi) / 2
+		entry, err := r.entryAt(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if entry.Key < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// Decodes a packed polyglot move in the context of the given position.
+//
+// Polyglot encodes castling as the king capturing its own rook. Unless the
+// board is in Chess960 mode, where this is the native encoding, such moves
+// are converted to the usual `E1->G1` style used by `Move`.
+func DecodePolyglotMove(board *Bitboard, rawMove uint16) *Move {
+	toSquare := int(rawMove & 0x3f)
+	fromSquare := int((rawMove >> 6) & 0x3f)
+	promotionPart := int((rawMove >> 12) & 0x7)
+
+	promotion := None
+	if promotionPart > 0 {
+		promotion = PieceTypes(promotionPart + 1)
+	}
+
+	// Convert castling moves.
+	move := NewMove(fromSquare, toSquare, promotion)
+	if promotion == None && !board.chess960 {
+		if side := board.castlingSide(move); side != -1 {
+			move.toSquare, _ = castlingTargets(board.CheckSquareColor(fromSquare), side)
+		}
+	}
+
+	return move
+}
+
+// Gets all entries for the given position, in the order they appear in
+// the book.
+//
+// Entries with moves that are not legal in the position (for example due
+// to a hash collision) are skipped.
+func (r *PolyglotReader) Entries(board *Bitboard) ([]*PolyglotEntry, error) {
+	key := board.ZobristHash(nil)
+	result := []*PolyglotEntry{}
+
+	index, err := r.bisectKeyLeft(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for ; index < r.entries; index++ {
+		entry, err := r.entryAt(index)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Key != key {
+			break
+		}
+
+		entry.Move = DecodePolyglotMove(board, entry.RawMove)
+		if !board.IsLegal(entry.Move) {
+			continue
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+// Gets the entry with the highest weight for the given position.
+//
+// Returns an error if there is no entry for the position.
+func (r *PolyglotReader) Find(board *Bitboard) (*PolyglotEntry, error) {
+	entries, err := r.Entries(board)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *PolyglotEntry
+	for _, entry := range entries {
+		if best == nil || entry.Weight > best.Weight {
+			best = entry
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no polyglot entry found for '%s'.", board.Fen())
+	}
+
+	return best, nil
+}
+
+// Selects a random entry for the given position, distributed by the
+// weights of the entries. Moves in `exclude` are never chosen.
+//
+// If all remaining entries have a weight of zero, one of them is chosen
+// uniformly.
+//
+// Returns an error if there is no entry to choose from.
+func (r *PolyglotReader) Choice(board *Bitboard, exclude []*Move) (*PolyglotEntry, error) {
+	entries, err := r.Entries(board)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*PolyglotEntry{}
+	totalWeight := int64(0)
+	for _, entry := range entries {
+		excluded := false
+		for _, move := range exclude {
+			if move != nil && move.Equals(entry.Move) {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			candidates = append(candidates, entry)
+			totalWeight += int64(entry.Weight)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no polyglot entry found for '%s'.", board.Fen())
+	}
+
+	if totalWeight == 0 {
+		return candidates[rand.Intn(len(candidates))], nil
+	}
+
+	choice := rand.Int63n(totalWeight)
+	for _, entry := range candidates {
+		choice -= int64(entry.Weight)
+		if choice < 0 {
+			return entry, nil
+		}
+	}
+
+	return candidates[len(candidates)-1], nil
+}
+
+// Encodes a move in the packed 16 bit polyglot format.
+//
+// Castling moves are encoded as the king capturing its own rook, as
+// required by the polyglot specification. The position is needed to tell
+// castling apart from other king moves. Null moves can not be encoded
+// and result in `0`.
+func EncodePolyglotMove(board *Bitboard, move *Move) uint16 {
+	if move == nil {
+		return 0
+	}
+
+	toSquare := move.toSquare
+	if side := board.castlingSide(move); side != -1 {
+		toSquare = board.castlingRookSquare(board.CheckSquareColor(move.fromSquare), side)
+	}
+
+	promotionPart := 0
+	if move.promotion != None {
+		promotionPart = int(move.promotion) - 1
+	}
+
+	return uint16(toSquare | move.fromSquare<<6 | promotionPart<<12)
+}
+
+// Sorts entries in the order required for polyglot books: by key and
+// then by descending weight.
+func sortPolyglotEntries(entries []*PolyglotEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight > entries[j].Weight
+		}
+		return entries[i].RawMove < entries[j].RawMove
+	})
+}
+
+// Writes the given entries as a polyglot book. The entries must already be
+// sorted.
+func writePolyglotEntries(w io.Writer, entries []*PolyglotEntry) error {
+	bw := bufio.NewWriter(w)
+
+	var buf [PolyglotEntrySize]byte
+	for _, entry := range entries {
+		binary.BigEndian.PutUint64(buf[0:8], entry.Key)
+		binary.BigEndian.PutUint16(buf[8:10], entry.RawMove)
+		binary.BigEndian.PutUint16(buf[10:12], entry.Weight)
+		binary.BigEndian.PutUint32(buf[12:16], entry.Learn)
+		if _, err := bw.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+type polyglotKey struct {
+	key     uint64
+	rawMove uint16
+}
+
+type polyglotCounter struct {
+	weight int64
+	learn  int64
+}
+
+// Builds polyglot opening books from games.
+//
+// For each position of the main line up to `MaxPly` half moves (`0` means
+// no limit) the played move is recorded. The weight of a move is the sum
+// of `WinWeight`, `DrawWeight` or `LossWeight` over all games, depending
+// on the result from the point of view of the side that played the move.
+// The learn field counts how many games the move was played in. Games
+// without a result are ignored.
+//
+//     pgn, _ := os.Open("repertoire.pgn")
+//     builder := chess.NewPolyglotBuilder(20)
+//     builder.AddPGN(chess.NewPGNReader(pgn))
+//
+//     book, _ := os.Create("repertoire.bin")
+//     builder.Write(book)
+//
+// Moves with a total weight of zero are omitted from the book.
+type PolyglotBuilder struct {
+	MaxPly     int
+	WinWeight  int
+	DrawWeight int
+	LossWeight int
+
+	counters map[polyglotKey]*polyglotCounter
+}
+
+func NewPolyglotBuilder(maxPly int) *PolyglotBuilder {
+	return &PolyglotBuilder{
+		MaxPly:     maxPly,
+		WinWeight:  2,
+		DrawWeight: 1,
+		LossWeight: 0,
+		counters:   map[polyglotKey]*polyglotCounter{},
+	}
+}
+
+// Records the main line of the given game.
+//
+// Returns false if the game was ignored because it has no result.
+func (p *PolyglotBuilder) AddGame(game *GameNode) bool {
+	var whiteWeight, blackWeight int
+	switch game.Root().Headers["Result"] {
+	case "1-0":
+		whiteWeight, blackWeight = p.WinWeight, p.LossWeight
+	case "0-1":
+		whiteWeight, blackWeight = p.LossWeight, p.WinWeight
+	case "1/2-1/2":
+		whiteWeight, blackWeight = p.DrawWeight, p.DrawWeight
+	default:
+		return false
+	}
+
+	node := game.Root()
+	board := node.Board()
+	for ply := 0; len(node.variations) > 0 && (p.MaxPly <= 0 || ply < p.MaxPly); ply++ {
+		node = node.variations[0]
+
+		// Null moves can not be represented in a book.
+		if node.move == nil {
+			break
+		}
+
+		key := polyglotKey{board.ZobristHash(nil), EncodePolyglotMove(board, node.move)}
+		counter, ok := p.counters[key]
+		if !ok {
+			counter = &polyglotCounter{}
+			p.counters[key] = counter
+		}
+
+		if board.turn == White {
+			counter.weight += int64(whiteWeight)
+		} else {
+			counter.weight += int64(blackWeight)
+		}
+		counter.learn++
+
+		board.Push(node.move)
+	}
+
+	return true
+}
+
+// Records all games from the given reader.
+//
+// Games that can not be parsed completely are skipped. Returns the number
+// of games that were recorded.
+func (p *PolyglotBuilder) AddPGN(reader *PGNReader) int {
+	count := 0
+	for reader.Next() {
+		game, err := reader.Scan()
+		if err != nil || game == nil {
+			continue
+		}
+
+		if p.AddGame(game) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Gets the sorted entries of the book built so far.
+//
+// Weights are scaled down per position if they do not fit into 16 bits, so
+// that their proportions are kept.
+func (p *PolyglotBuilder) Entries() []*PolyglotEntry {
+	maxWeights := map[uint64]int64{}
+	for key, counter := range p.counters {
+		if counter.weight > maxWeights[key.key] {
+			maxWeights[key.key] = counter.weight
+		}
+	}
+
+	entries := []*PolyglotEntry{}
+	for key, counter := range p.counters {
+		weight := counter.weight
+		if maxWeight := maxWeights[key.key]; maxWeight > 0xffff {
+			weight = weight * 0xffff / maxWeight
+		}
+
+		if weight <= 0 {
+			continue
+		}
+
+		learn := counter.learn
+		if learn > 0xffffffff {
+			learn = 0xffffffff
+		}
+
+		entries = append(entries, &PolyglotEntry{
+			Key:     key.key,
+			RawMove: key.rawMove,
+			Weight:  uint16(weight),
+			Learn:   uint32(learn),
+		})
+	}
+
+	sortPolyglotEntries(entries)
+	return entries
+}
+
+// Writes the book built so far in the polyglot format.
+func (p *PolyglotBuilder) Write(w io.Writer) error {
+	return writePolyglotEntries(w, p.Entries())
+}
+
+type PolyglotMergePolicy int
+
+const (
+	// Weights and learn counters of entries present in both books are
+	// added.
+	PolyglotMergeSum PolyglotMergePolicy = iota
+	// The entry with the greater weight is kept if it is present in both
+	// books.
+	PolyglotMergeMax
+	// Positions present in the first book are taken from the first book
+	// only. The second book only contributes positions unknown to the
+	// first one.
+	PolyglotMergePreferFirst
+)
+
+// Reads all entries of the book in the order they are stored. Moves are
+// not decoded.
+func (r *PolyglotReader) rawEntries() ([]*PolyglotEntry, error) {
+	if _, err := r.handle.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(r.handle)
+	entries := make([]*PolyglotEntry, 0, r.entries)
+
+	var buf [PolyglotEntrySize]byte
+	for i := int64(0); i < r.entries; i++ {
+		if _, err := io.ReadFull(reader, buf[:]); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &PolyglotEntry{
+			Key:     binary.BigEndian.Uint64(buf[0:8]),
+			RawMove: binary.BigEndian.Uint16(buf[8:10]),
+			Weight:  binary.BigEndian.Uint16(buf[10:12]),
+			Learn:   binary.BigEndian.Uint32(buf[12:16]),
+		})
+	}
+
+	return entries, nil
+}
+
+// Merges two polyglot books into a new book written to `w`, combining
+// entries present in both books according to the given policy.
+func MergePolyglotBooks(first, second *PolyglotReader, policy PolyglotMergePolicy, w io.Writer) error {
+	firstEntries, err := first.rawEntries()
+	if err != nil {
+		return err
+	}
+
+	secondEntries, err := second.rawEntries()
+	if err != nil {
+		return err
+	}
+
+	merged := map[polyglotKey]*PolyglotEntry{}
+	firstKeys := map[uint64]bool{}
+	for _, entry := range firstEntries {
+		firstKeys[entry.Key] = true
+		merged[polyglotKey{entry.Key, entry.RawMove}] = entry
+	}
+
+	for _, entry := range secondEntries {
+		if policy == PolyglotMergePreferFirst && firstKeys[entry.Key] {
+			continue
+		}
+
+		key := polyglotKey{entry.Key, entry.RawMove}
+		existing, ok := merged[key]
+		if !ok {
+			merged[key] = entry
+			continue
+		}
+
+		switch policy {
+		case PolyglotMergeSum:
+			weight := uint32(existing.Weight) + uint32(entry.Weight)
+			if weight > 0xffff {
+				weight = 0xffff
+			}
+			existing.Weight = uint16(weight)
+
+			learn := uint64(existing.Learn) + uint64(entry.Learn)
+			if learn > 0xffffffff {
+				learn = 0xffffffff
+			}
+			existing.Learn = uint32(learn)
+		case PolyglotMergeMax:
+			if entry.Weight > existing.Weight {
+				merged[key] = entry
+			}
+		}
+	}
+
+	entries := make([]*PolyglotEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+
+	sortPolyglotEntries(entries)
+	return writePolyglotEntries(w, entries)
+}
@@ -0,0 +1,257 @@
+package chess
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Keys from the polyglot specification.
+func TestPolyglotKeys(t *testing.T) {
+	tests := []struct {
+		moves []string
+		key   uint64
+	}{
+		{[]string{}, 0x463b96181691fc9c},
+		{[]string{"e2e4"}, 0x823c9b50fd114196},
+		{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+		{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3"}, 0x5c3f9b829b279560},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(StartingFen)
+		for _, uci := range test.moves {
+			move := MoveFromUci(uci)
+			if !board.IsLegal(move) {
+				t.Fatalf("%v: illegal move %s", test.moves, uci)
+			}
+			board.Push(move)
+		}
+
+		if key := board.ZobristHash(nil); key != test.key {
+			t.Errorf("%v: expected key %016x, got %016x", test.moves, test.key, key)
+		}
+	}
+}
+
+func TestPolyglotMoveEncoding(t *testing.T) {
+	tests := []struct {
+		fen     string
+		uci     string
+		rawMove uint16
+	}{
+		{StartingFen, "e2e4", E4 | E2<<6},
+		{StartingFen, "g1f3", F3 | G1<<6},
+		// Castling is encoded as the king taking its rook.
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", H1 | E1<<6},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", A1 | E1<<6},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8g8", H8 | E8<<6},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", A8 | E8<<6},
+		// Other king moves are not castling.
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1f1", F1 | E1<<6},
+		// Promotions.
+		{"8/P6k/8/8/8/8/8/K7 w - - 0 1", "a7a8q", A8 | A7<<6 | 4<<12},
+		{"8/P6k/8/8/8/8/8/K7 w - - 0 1", "a7a8r", A8 | A7<<6 | 3<<12},
+		{"8/P6k/8/8/8/8/8/K7 w - - 0 1", "a7a8b", A8 | A7<<6 | 2<<12},
+		{"8/P6k/8/8/8/8/8/K7 w - - 0 1", "a7a8n", A8 | A7<<6 | 1<<12},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		move := MoveFromUci(test.uci)
+		if rawMove := EncodePolyglotMove(board, move); rawMove != test.rawMove {
+			t.Errorf("%s %s: expected %04x, got %04x", test.fen, test.uci, test.rawMove, rawMove)
+		}
+		if decoded := DecodePolyglotMove(board, test.rawMove); !decoded.Equals(move) {
+			t.Errorf("%s %04x: expected %s, got %s", test.fen, test.rawMove, test.uci, decoded.Uci())
+		}
+	}
+
+	// In Chess960 mode castling is already king takes rook.
+	board := NewChess960Bitboard("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if move := DecodePolyglotMove(board, H1|E1<<6); move.Uci() != "e1h1" {
+		t.Errorf("expected e1h1 in Chess960 mode, got %s", move.Uci())
+	}
+	if rawMove := EncodePolyglotMove(board, MoveFromUci("e1h1")); rawMove != H1|E1<<6 {
+		t.Errorf("expected %04x in Chess960 mode, got %04x", H1|E1<<6, rawMove)
+	}
+
+	if rawMove := EncodePolyglotMove(board, nil); rawMove != 0 {
+		t.Errorf("expected 0 for a null move, got %04x", rawMove)
+	}
+}
+
+const polyglotTestPgn = `[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Nf6 4. O-O 1-0
+
+[Result "1/2-1/2"]
+
+1. e4 c5 1/2-1/2
+
+[Result "0-1"]
+
+1. d4 d5 0-1
+
+[Result "*"]
+
+1. c4 *
+`
+
+func buildTestPolyglot(t *testing.T, maxPly int) *PolyglotReader {
+	builder := NewPolyglotBuilder(maxPly)
+	if count := builder.AddPGN(NewPGNReader(strings.NewReader(polyglotTestPgn))); count != 3 {
+		t.Errorf("expected 3 games with a result, got %d", count)
+	}
+
+	var buf bytes.Buffer
+	if err := builder.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewPolyglotReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestPolyglotBuildRead(t *testing.T) {
+	reader := buildTestPolyglot(t, 0)
+
+	// Lost moves (d4, e5, Nc6, Nf6) have a weight of zero and are left out.
+	if reader.Len() != 6 {
+		t.Errorf("expected 6 entries, got %d", reader.Len())
+	}
+
+	board := NewBitboard(StartingFen)
+	entry, err := reader.Find(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Move.Uci() != "e2e4" || entry.Weight != 3 || entry.Learn != 2 {
+		t.Errorf("expected e2e4 with weight 3 in 2 games, got %s with %d in %d", entry.Move.Uci(), entry.Weight, entry.Learn)
+	}
+	if _, err := reader.Choice(board, []*Move{MoveFromUci("e2e4")}); err == nil {
+		t.Error("expected no choice without e2e4")
+	}
+
+	board.PushSan("e4")
+	entries, err := reader.Entries(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Move.Uci() != "c7c5" || entries[0].Weight != 1 {
+		t.Errorf("expected only c7c5 with weight 1, got %v", entries)
+	}
+
+	// Castling is decoded to the usual notation.
+	for _, san := range []string{"e5", "Nf3", "Nc6", "Bc4", "Nf6"} {
+		board.PushSan(san)
+	}
+	entry, err = reader.Find(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Move.Uci() != "e1g1" || entry.RawMove != H1|E1<<6 {
+		t.Errorf("expected e1g1 stored as e1h1, got %s (%04x)", entry.Move.Uci(), entry.RawMove)
+	}
+
+	if _, err := reader.Find(NewBitboard("4k3/8/8/8/8/8/8/4K3 w - - 0 1")); err == nil {
+		t.Error("expected an error for an unknown position")
+	}
+
+	// Only the first plies are recorded: e4, c5 and d5.
+	reader = buildTestPolyglot(t, 2)
+	if reader.Len() != 3 {
+		t.Errorf("expected 3 entries within 2 plies, got %d", reader.Len())
+	}
+
+	if _, err := NewPolyglotReader(bytes.NewReader(make([]byte, 20))); err == nil {
+		t.Error("expected an error for a truncated book")
+	}
+}
+
+func TestMergePolyglotBooks(t *testing.T) {
+	writeBook := func(entries []*PolyglotEntry) *PolyglotReader {
+		var buf bytes.Buffer
+		if err := writePolyglotEntries(&buf, entries); err != nil {
+			t.Fatal(err)
+		}
+		reader, err := NewPolyglotReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reader
+	}
+	books := func() (*PolyglotReader, *PolyglotReader) {
+		first := writeBook([]*PolyglotEntry{
+			{Key: 1, RawMove: 10, Weight: 10, Learn: 1},
+			{Key: 1, RawMove: 20, Weight: 5, Learn: 1},
+			{Key: 2, RawMove: 10, Weight: 7, Learn: 1},
+		})
+		second := writeBook([]*PolyglotEntry{
+			{Key: 1, RawMove: 10, Weight: 0xfffa, Learn: 2},
+			{Key: 1, RawMove: 30, Weight: 4, Learn: 1},
+			{Key: 3, RawMove: 10, Weight: 9, Learn: 1},
+		})
+		return first, second
+	}
+
+	tests := []struct {
+		policy   PolyglotMergePolicy
+		expected []PolyglotEntry
+	}{
+		{PolyglotMergeSum, []PolyglotEntry{
+			{Key: 1, RawMove: 10, Weight: 0xffff, Learn: 3},
+			{Key: 1, RawMove: 20, Weight: 5, Learn: 1},
+			{Key: 1, RawMove: 30, Weight: 4, Learn: 1},
+			{Key: 2, RawMove: 10, Weight: 7, Learn: 1},
+			{Key: 3, RawMove: 10, Weight: 9, Learn: 1},
+		}},
+		{PolyglotMergeMax, []PolyglotEntry{
+			{Key: 1, RawMove: 10, Weight: 0xfffa, Learn: 2},
+			{Key: 1, RawMove: 20, Weight: 5, Learn: 1},
+			{Key: 1, RawMove: 30, Weight: 4, Learn: 1},
+			{Key: 2, RawMove: 10, Weight: 7, Learn: 1},
+			{Key: 3, RawMove: 10, Weight: 9, Learn: 1},
+		}},
+		{PolyglotMergePreferFirst, []PolyglotEntry{
+			{Key: 1, RawMove: 10, Weight: 10, Learn: 1},
+			{Key: 1, RawMove: 20, Weight: 5, Learn: 1},
+			{Key: 2, RawMove: 10, Weight: 7, Learn: 1},
+			{Key: 3, RawMove: 10, Weight: 9, Learn: 1},
+		}},
+	}
+
+	for _, test := range tests {
+		first, second := books()
+		var buf bytes.Buffer
+		if err := MergePolyglotBooks(first, second, test.policy, &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		merged, err := NewPolyglotReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := merged.rawEntries()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != len(test.expected) {
+			t.Errorf("policy %d: expected %d entries, got %d", test.policy, len(test.expected), len(entries))
+			continue
+		}
+		for i, entry := range entries {
+			if *entry != test.expected[i] {
+				t.Errorf("policy %d: expected entry %d to be %+v, got %+v", test.policy, i, test.expected[i], *entry)
+			}
+		}
+	}
+}
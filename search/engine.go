@@ -0,0 +1,701 @@
+// Package search is a small alpha-beta chess engine built on
+// `chess.Bitboard`.
+//
+//     engine := search.NewEngine(16)
+//     board := chess.NewBitboard("")
+//     bestMove, ponder := engine.Search(board, &uci.Limits{Depth: 6}, nil, nil)
+//
+// The engine implements `uci.Searcher`, so it can be served to GUIs:
+//
+//     server := uci.NewServer(search.NewEngine(16), "chess.go", "Me")
+//     server.Options = append(server.Options, search.HashOption)
+//     server.Serve(os.Stdin, os.Stdout)
+//
+// It uses iterative deepening with principal variation search, quiescence
+// search, a transposition table, killer and history move ordering,
+// null-move pruning and check extensions.
+package search
+
+import (
+	"strconv"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+	"github.com/TheOnly92/chess.go/uci"
+)
+
+const (
+	// The maximum depth of the search, including quiescence search and
+	// extensions.
+	MaxPly = 128
+
+	infinity  = 32000
+	mateValue = 31000
+	mateBound = mateValue - MaxPly
+
+	// The depth reduction of null-move searches.
+	nullMoveReduction = 2
+
+	// Moves to plan with, if the GUI does not say.
+	defaultMovesToGo = 30
+)
+
+// Priorities of move ordering.
+const (
+	orderHashMove   = 1 << 30
+	orderCapture    = 1 << 20
+	orderKiller     = 1 << 19
+	orderMaxHistory = 1 << 18
+)
+
+// The `Hash` option, in megabytes, understood by `Engine.SetOption()`.
+var HashOption = &uci.Option{Name: "Hash", Type: "spin", Default: "16", Min: 1, Max: 4096}
+
+// An alpha-beta searcher.
+//
+// An engine can only search one position at a time. The transposition
+// table and move ordering statistics are kept between searches until
+// `NewGame()` is called.
+type Engine struct {
+	// Evaluates quiet positions in centipawns, from the point of view of
+	// the side to move. Defaults to `chess.DefaultEvaluator`. Wrap
+	// `Material` in `chess.EvaluatorFunc` to only count material.
+	Evaluator chess.Evaluator
+
+	tt      *transpositionTable
+	killers [MaxPly][2]chess.PackedMove
+	history [2][64][64]int
+
+	moves  [MaxPly]chess.MoveList
+	scores [MaxPly][]int
+
+	pv       [MaxPly][MaxPly]chess.PackedMove
+	pvLength [MaxPly]int
+
+	board     *chess.Bitboard
+	hashes    []uint64
+	rootMoves []chess.PackedMove
+
+	nodes    int64
+	selDepth int
+	maxNodes int64
+	stop     <-chan struct{}
+	stopped  bool
+	deadline time.Time
+
+	// While pondering there is no time limit. Once `ponderHit` is closed
+	// the time is allocated from then on.
+	limits    *uci.Limits
+	pondering bool
+	ponderHit <-chan struct{}
+	soft      time.Time
+}
+
+// Creates an engine with a transposition table of about the given size in
+// megabytes.
+func NewEngine(hashMegabytes int) *Engine {
+	return &Engine{
+		Evaluator: chess.DefaultEvaluator{},
+		tt:        newTranspositionTable(hashMegabytes),
+	}
+}
+
+// Forgets everything learned in previous searches.
+func (e *Engine) NewGame() {
+	e.tt.clear()
+	e.killers = [MaxPly][2]chess.PackedMove{}
+	e.history = [2][64][64]int{}
+}
+
+// Handles the `Hash` option. Other options are ignored.
+func (e *Engine) SetOption(name, value string) {
+	if name == HashOption.Name {
+		if megabytes, err := strconv.Atoi(value); err == nil {
+			e.tt = newTranspositionTable(megabytes)
+		}
+	}
+}
+
+// Gets the number of nodes visited in the last search.
+func (e *Engine) Nodes() int64 {
+	return e.nodes
+}
+
+// Searches the position within the limits and returns the best move and
+// the expected reply. `info` is called after each completed iteration and
+// may be nil. The search returns early once `stop` is closed, which may
+// also be nil.
+//
+// With `Infinite` or `Ponder` the search does not return before `stop` is
+// closed, as required by UCI. After a ponder hit the search goes on under
+// the time control of the limits. The board is restored before returning.
+func (e *Engine) Search(board *chess.Bitboard, limits *uci.Limits, info func(*uci.Info), stop <-chan struct{}) (bestMove, ponder *chess.Move) {
+	if limits == nil {
+		limits = &uci.Limits{}
+	}
+
+	start := time.Now()
+	e.board = board
+	e.stop = stop
+	e.stopped = false
+	e.nodes = 0
+	e.maxNodes = int64(limits.Nodes)
+	e.killers = [MaxPly][2]chess.PackedMove{}
+	for color := range e.history {
+		for from := range e.history[color] {
+			for to := range e.history[color][from] {
+				e.history[color][from][to] /= 8
+			}
+		}
+	}
+
+	e.limits = limits
+	e.pondering = limits.Ponder
+	e.ponderHit = limits.PonderHit
+	e.soft = e.allocateTime(board, limits, start)
+	e.setupHistory()
+
+	e.rootMoves = nil
+	for _, move := range limits.SearchMoves {
+		e.rootMoves = append(e.rootMoves, chess.PackMove(move))
+	}
+
+	legal := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+	if len(legal) == 0 || board.IsVariantEnd() {
+		e.wait(limits)
+		return nil, nil
+	}
+
+	maxDepth := MaxPly - 1
+	if limits.Depth > 0 && limits.Depth < maxDepth {
+		maxDepth = limits.Depth
+	}
+
+	var line []chess.PackedMove
+	for depth := 1; depth <= maxDepth; depth++ {
+		e.selDepth = 0
+		score := e.alphaBeta(depth, 0, -infinity, infinity, false)
+		if e.stopped && line != nil {
+			break
+		}
+
+		if e.pvLength[0] > 0 {
+			line = append(line[:0], e.pv[0][:e.pvLength[0]]...)
+		}
+
+		if info != nil {
+			info(e.info(depth, score, line, start))
+		}
+
+		if e.stopped {
+			break
+		}
+		if limits.Mate > 0 && score >= mateBound && (mateValue-score+1)/2 <= limits.Mate {
+			break
+		}
+		e.checkPonderHit()
+		if !e.soft.IsZero() && time.Now().After(e.soft) {
+			break
+		}
+	}
+
+	e.wait(limits)
+
+	if len(line) == 0 {
+		return legal[0], nil
+	}
+	bestMove = line[0].Move()
+	if len(line) > 1 {
+		ponder = line[1].Move()
+	}
+	return bestMove, ponder
+}
+
+// Waits for the GUI in infinite and ponder mode. A ponder hit ends the
+// wait, unless the search is infinite.
+func (e *Engine) wait(limits *uci.Limits) {
+	for (limits.Infinite || e.pondering) && e.stop != nil {
+		select {
+		case <-e.stop:
+			return
+		case <-e.ponderHit:
+			e.pondering = false
+			e.ponderHit = nil
+		}
+	}
+}
+
+// Switches from pondering to the time control of the limits, once the GUI
+// sent `ponderhit`.
+func (e *Engine) checkPonderHit() {
+	if !e.pondering || e.ponderHit == nil {
+		return
+	}
+
+	select {
+	case <-e.ponderHit:
+		e.pondering = false
+		e.ponderHit = nil
+		e.soft = e.allocateTime(e.board, e.limits, time.Now())
+	default:
+	}
+}
+
+// Sets the deadline, after which the search is aborted, and returns the
+// time after which no new iteration is started.
+func (e *Engine) allocateTime(board *chess.Bitboard, limits *uci.Limits, start time.Time) time.Time {
+	e.deadline = time.Time{}
+	if limits.Infinite || e.pondering {
+		return time.Time{}
+	}
+
+	if limits.MoveTime > 0 {
+		e.deadline = start.Add(limits.MoveTime)
+		return e.deadline
+	}
+
+	remaining, increment := limits.WhiteTime, limits.WhiteInc
+	if board.GetTurn() == chess.Black {
+		remaining, increment = limits.BlackTime, limits.BlackInc
+	}
+	if remaining <= 0 {
+		return time.Time{}
+	}
+
+	movesToGo := limits.MovesToGo
+	if movesToGo <= 0 || movesToGo > defaultMovesToGo {
+		movesToGo = defaultMovesToGo
+	}
+
+	// Keep a margin for communication with the GUI.
+	budget := remaining/time.Duration(movesToGo) + increment*3/4
+	hard := budget * 3
+	if limit := remaining/2 - 50*time.Millisecond; hard > limit {
+		hard = limit
+	}
+	if budget > hard {
+		budget = hard
+	}
+	if hard < 10*time.Millisecond {
+		hard = 10 * time.Millisecond
+	}
+
+	e.deadline = start.Add(hard)
+	return start.Add(budget / 2)
+}
+
+// Collects the hashes of the positions of the game, to detect
+// repetitions.
+func (e *Engine) setupHistory() {
+	moves := e.board.MoveStack()
+	e.hashes = e.hashes[:0]
+	for range moves {
+		e.board.Pop()
+	}
+	e.hashes = append(e.hashes, e.board.ZobristHash(nil))
+	for _, move := range moves {
+		e.board.Push(move)
+		e.hashes = append(e.hashes, e.board.ZobristHash(nil))
+	}
+}
+
+func (e *Engine) info(depth, score int, line []chess.PackedMove, start time.Time) *uci.Info {
+	elapsed := time.Since(start)
+	result := &uci.Info{
+		Depth:    depth,
+		SelDepth: e.selDepth,
+		Time:     elapsed,
+		Nodes:    e.nodes,
+		HashFull: e.tt.hashFull(),
+		Score:    &uci.Score{Cp: score},
+	}
+	if elapsed > 0 {
+		result.Nps = int64(float64(e.nodes) / elapsed.Seconds())
+	}
+
+	if score >= mateBound {
+		result.Score = &uci.Score{IsMate: true, Mate: (mateValue - score + 1) / 2}
+	} else if score <= -mateBound {
+		result.Score = &uci.Score{IsMate: true, Mate: -(mateValue + score) / 2}
+	}
+
+	for _, move := range line {
+		result.Pv = append(result.Pv, move.Move())
+	}
+	return result
+}
+
+// Checks the limits every few nodes.
+func (e *Engine) checkStop() bool {
+	if e.stopped || e.nodes&1023 != 0 {
+		return e.stopped
+	}
+
+	e.checkPonderHit()
+	if e.maxNodes > 0 && e.nodes >= e.maxNodes {
+		e.stopped = true
+	} else if !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		e.stopped = true
+	} else if e.stop != nil {
+		select {
+		case <-e.stop:
+			e.stopped = true
+		default:
+		}
+	}
+	return e.stopped
+}
+
+// Checks if the current position occurred before with the same side to
+// move.
+func (e *Engine) isRepetition() bool {
+	current := e.hashes[len(e.hashes)-1]
+	for i := len(e.hashes) - 3; i >= 0; i -= 2 {
+		if e.hashes[i] == current {
+			return true
+		}
+	}
+	return false
+}
+
+// Generates the moves into the list of the ply. In standard chess the
+// moves are pseudo legal. Other variants have special rules, so the legal
+// moves are generated.
+func (e *Engine) generate(ply int, capturesOnly bool) *chess.MoveList {
+	list := &e.moves[ply]
+	list.Clear()
+
+	if e.board.Variant() == chess.Standard {
+		e.board.GenerateMovesInto(list, chess.GenerateAll)
+	} else {
+		for _, move := range e.board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			list.Append(chess.PackMove(move))
+		}
+	}
+
+	if capturesOnly {
+		moves := list.Slice()
+		list.Clear()
+		for _, move := range moves {
+			if move.Promotion() != chess.None || e.board.IsCapture(move.Move()) {
+				list.Append(move)
+			}
+		}
+	}
+
+	return list
+}
+
+// Scores the moves for ordering.
+func (e *Engine) order(ply int, list *chess.MoveList, hashMove chess.PackedMove) []int {
+	scores := e.scores[ply][:0]
+	turn := e.board.GetTurn()
+	for _, move := range list.Slice() {
+		score := 0
+		if move == hashMove {
+			score = orderHashMove
+		} else if victim := e.victim(move); victim != chess.None || move.Promotion() != chess.None {
+			attacker := e.board.PieceTypeAt(move.FromSquare())
+			score = orderCapture + PieceValues[victim] + PieceValues[move.Promotion()] - int(attacker)
+		} else if move == e.killers[ply][0] {
+			score = orderKiller + 1
+		} else if move == e.killers[ply][1] {
+			score = orderKiller
+		} else {
+			score = e.history[turn][move.FromSquare()][move.ToSquare()]
+		}
+		scores = append(scores, score)
+	}
+	e.scores[ply] = scores
+	return scores
+}
+
+// Gets the type of the piece captured by the move.
+func (e *Engine) victim(move chess.PackedMove) chess.PieceTypes {
+	if move.Drop() != chess.None {
+		return chess.None
+	}
+
+	victim := e.board.PieceTypeAt(move.ToSquare())
+	if victim != chess.None && e.board.CheckSquareColor(move.ToSquare()) == e.board.GetTurn() {
+		// Castling in Chess960 moves the king onto the rook.
+		return chess.None
+	}
+	if victim == chess.None && e.board.PieceTypeAt(move.FromSquare()) == chess.Pawn && e.board.IsEnPassant(move.Move()) {
+		return chess.Pawn
+	}
+	return victim
+}
+
+// Moves the highest scored of the remaining moves to the given index.
+func pickMove(list *chess.MoveList, scores []int, index int) chess.PackedMove {
+	moves := list.Slice()
+	best := index
+	for i := index + 1; i < len(moves); i++ {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	moves[index], moves[best] = moves[best], moves[index]
+	scores[index], scores[best] = scores[best], scores[index]
+	return moves[index]
+}
+
+// Pushes the move, unless it leaves the king in check.
+func (e *Engine) makeMove(move chess.PackedMove) bool {
+	e.board.Push(move.Move())
+	if e.board.Variant() == chess.Standard && e.board.WasIntoCheck() {
+		e.board.Pop()
+		return false
+	}
+	e.hashes = append(e.hashes, e.board.ZobristHash(nil))
+	return true
+}
+
+func (e *Engine) unmakeMove() {
+	e.board.Pop()
+	e.hashes = e.hashes[:len(e.hashes)-1]
+}
+
+// Checks if the side to move has pieces other than pawns and the king, so
+// that passing is unlikely to be the best move (zugzwang).
+func (e *Engine) hasPieces() bool {
+	turn := e.board.GetTurn()
+	pieces := e.board.GetPieces()
+	for square, pieceType := range pieces {
+		if pieceType != chess.None && pieceType != chess.Pawn && pieceType != chess.King && e.board.CheckSquareColor(square) == turn {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) alphaBeta(depth, ply, alpha, beta int, nullAllowed bool) int {
+	e.pvLength[ply] = 0
+	if e.checkStop() {
+		return 0
+	}
+
+	if ply > 0 && e.isRepetition() {
+		return 0
+	}
+
+	if score, ok := e.variantEnd(ply); ok {
+		return score
+	}
+
+	// Extend checks, but stay within `MaxPly`. This also keeps the depth
+	// in the range stored by the transposition table.
+	inCheck := e.board.IsCheck()
+	if inCheck && ply+depth < MaxPly-1 {
+		depth++
+	}
+
+	if depth <= 0 {
+		return e.quiescence(ply, alpha, beta)
+	}
+
+	e.nodes++
+	if ply > e.selDepth {
+		e.selDepth = ply
+	}
+	if ply >= MaxPly-1 {
+		return e.Evaluator.Evaluate(e.board)
+	}
+
+	pvNode := beta-alpha > 1
+	hash := e.board.ZobristHash(nil)
+	hashMove := chess.PackedNullMove
+	if entry, ok := e.tt.probe(hash); ok {
+		hashMove = entry.move
+		if !pvNode && ply > 0 && int(entry.depth) >= depth {
+			score := scoreFromTT(int(entry.score), ply)
+			if entry.bound == boundExact ||
+				(entry.bound == boundLower && score >= beta) ||
+				(entry.bound == boundUpper && score <= alpha) {
+				return score
+			}
+		}
+	}
+
+	// Give the opponent a free move. If the position is still good enough,
+	// a real search would likely be too.
+	if nullAllowed && !pvNode && !inCheck && depth >= 3 && e.board.Variant() == chess.Standard &&
+		e.hasPieces() && e.Evaluator.Evaluate(e.board) >= beta {
+		e.board.Push(nil)
+		e.hashes = append(e.hashes, e.board.ZobristHash(nil))
+		score := -e.alphaBeta(depth-1-nullMoveReduction, ply+1, -beta, -beta+1, false)
+		e.unmakeMove()
+		if e.stopped {
+			return 0
+		}
+		if score >= beta {
+			if score >= mateBound {
+				return beta
+			}
+			return score
+		}
+	}
+
+	list := e.generate(ply, false)
+	scores := e.order(ply, list, hashMove)
+	turn := e.board.GetTurn()
+
+	best, bestMove, legal := -infinity, chess.PackedNullMove, 0
+	originalAlpha := alpha
+	for i := 0; i < list.Len(); i++ {
+		move := pickMove(list, scores, i)
+		if ply == 0 && !e.isRootMove(move) {
+			continue
+		}
+		if !e.makeMove(move) {
+			continue
+		}
+		legal++
+
+		// Principal variation search: expect the first move to be best
+		// and prove the others worse with null windows.
+		var score int
+		if legal == 1 {
+			score = -e.alphaBeta(depth-1, ply+1, -beta, -alpha, true)
+		} else {
+			score = -e.alphaBeta(depth-1, ply+1, -alpha-1, -alpha, true)
+			if score > alpha && score < beta {
+				score = -e.alphaBeta(depth-1, ply+1, -beta, -alpha, true)
+			}
+		}
+		e.unmakeMove()
+
+		if e.stopped {
+			return 0
+		}
+
+		if score > best {
+			best, bestMove = score, move
+		}
+		if score <= alpha {
+			continue
+		}
+
+		alpha = score
+		e.pv[ply][0] = move
+		copy(e.pv[ply][1:], e.pv[ply+1][:e.pvLength[ply+1]])
+		e.pvLength[ply] = e.pvLength[ply+1] + 1
+
+		if score >= beta {
+			if e.victim(move) == chess.None && move.Promotion() == chess.None {
+				if e.killers[ply][0] != move {
+					e.killers[ply][1] = e.killers[ply][0]
+					e.killers[ply][0] = move
+				}
+				history := &e.history[turn][move.FromSquare()][move.ToSquare()]
+				*history += depth * depth
+				if *history > orderMaxHistory {
+					*history = orderMaxHistory
+				}
+			}
+			break
+		}
+	}
+
+	if legal == 0 {
+		if e.board.Variant() != chess.Standard {
+			// The variant decides about positions without moves.
+			if e.board.IsVariantWin() {
+				return mateValue - ply
+			} else if e.board.IsVariantDraw() || !inCheck {
+				return 0
+			}
+		} else if !inCheck {
+			return 0
+		}
+		return -mateValue + ply
+	}
+
+	bound := boundExact
+	if best >= beta {
+		bound = boundLower
+	} else if best <= originalAlpha {
+		bound = boundUpper
+		bestMove = chess.PackedNullMove
+	}
+	e.tt.store(hash, bestMove, scoreToTT(best, ply), depth, bound)
+
+	return best
+}
+
+// Scores positions where the game ended by the special rules of a
+// variant.
+func (e *Engine) variantEnd(ply int) (int, bool) {
+	if e.board.Variant() == chess.Standard || !e.board.IsVariantEnd() {
+		return 0, false
+	}
+
+	if e.board.IsVariantWin() {
+		return mateValue - ply, true
+	} else if e.board.IsVariantLoss() {
+		return -mateValue + ply, true
+	}
+	return 0, true
+}
+
+func (e *Engine) isRootMove(move chess.PackedMove) bool {
+	if len(e.rootMoves) == 0 {
+		return true
+	}
+	for _, rootMove := range e.rootMoves {
+		if rootMove == move {
+			return true
+		}
+	}
+	return false
+}
+
+// Searches captures and promotions until the position is quiet, so that
+// the evaluation does not miss pieces hanging.
+func (e *Engine) quiescence(ply, alpha, beta int) int {
+	e.pvLength[ply] = 0
+	if e.checkStop() {
+		return 0
+	}
+
+	if score, ok := e.variantEnd(ply); ok {
+		return score
+	}
+
+	e.nodes++
+	if ply > e.selDepth {
+		e.selDepth = ply
+	}
+
+	standPat := e.Evaluator.Evaluate(e.board)
+	if ply >= MaxPly-1 || standPat >= beta {
+		return standPat
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+
+	list := e.generate(ply, true)
+	scores := e.order(ply, list, chess.PackedNullMove)
+	for i := 0; i < list.Len(); i++ {
+		move := pickMove(list, scores, i)
+		if !e.makeMove(move) {
+			continue
+		}
+		score := -e.quiescence(ply+1, -beta, -alpha)
+		e.unmakeMove()
+
+		if e.stopped {
+			return 0
+		}
+		if score > alpha {
+			alpha = score
+			if score >= beta {
+				break
+			}
+		}
+	}
+
+	return alpha
+}
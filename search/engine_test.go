@@ -0,0 +1,188 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+	"github.com/TheOnly92/chess.go/uci"
+)
+
+// Runs a search in the background and fails the test if it does not
+// return in time.
+func searchWithin(t *testing.T, timeout time.Duration, board *chess.Bitboard, limits *uci.Limits, stop <-chan struct{}) *chess.Move {
+	t.Helper()
+
+	done := make(chan *chess.Move)
+	go func() {
+		bestMove, _ := NewEngine(1).Search(board, limits, nil, stop)
+		done <- bestMove
+	}()
+
+	select {
+	case bestMove := <-done:
+		return bestMove
+	case <-time.After(timeout):
+		t.Fatal("search did not return in time")
+		return nil
+	}
+}
+
+func TestSearchDepth(t *testing.T) {
+	tests := []struct {
+		fen      string
+		depth    int
+		bestMove string
+	}{
+		// Take the hanging queen.
+		{"4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1", 2, "d2d5"},
+		// Fork king and queen.
+		{"4q1k1/8/8/8/4N3/8/8/3K4 w - - 0 1", 3, "e4f6"},
+		// Promote instead of taking the knight.
+		{"1n5k/P7/8/8/8/8/8/K7 w - - 0 1", 2, "a7b8q"},
+	}
+
+	for _, test := range tests {
+		board := chess.NewBitboard(test.fen)
+		var depths []int
+		bestMove, _ := NewEngine(1).Search(board, &uci.Limits{Depth: test.depth}, func(info *uci.Info) {
+			depths = append(depths, info.Depth)
+		}, nil)
+
+		if bestMove == nil || bestMove.Uci() != test.bestMove {
+			t.Errorf("%s: expected %s, got %v", test.fen, test.bestMove, bestMove)
+		}
+		if len(depths) != test.depth || depths[len(depths)-1] != test.depth {
+			t.Errorf("%s: expected iterations up to depth %d, got %v", test.fen, test.depth, depths)
+		}
+		if board.Fen() != test.fen {
+			t.Errorf("%s: board changed to '%s'", test.fen, board.Fen())
+		}
+	}
+}
+
+func TestSearchMateInTwo(t *testing.T) {
+	board := chess.NewBitboard("7k/8/8/8/8/8/R7/1R4K1 w - - 0 1")
+
+	var score *uci.Score
+	bestMove, _ := NewEngine(1).Search(board, &uci.Limits{Mate: 2}, func(info *uci.Info) {
+		score = info.Score
+	}, nil)
+	if score == nil || !score.IsMate || score.Mate != 2 {
+		t.Fatalf("expected mate in 2, got %+v", score)
+	}
+
+	// Every reply runs into mate.
+	board.Push(bestMove)
+	for _, reply := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+		board.Push(reply)
+		mated := false
+		for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+			board.Push(move)
+			mated = mated || board.IsCheckmate()
+			board.Pop()
+		}
+		if !mated {
+			t.Errorf("%s %s: no mate after the reply", bestMove.Uci(), reply.Uci())
+		}
+		board.Pop()
+	}
+}
+
+func TestSearchMated(t *testing.T) {
+	board := chess.NewBitboard("7k/6Q1/6K1/8/8/8/8/8 b - - 0 1")
+	if bestMove, ponder := NewEngine(1).Search(board, &uci.Limits{Depth: 3}, nil, nil); bestMove != nil || ponder != nil {
+		t.Errorf("expected no move when mated, got %v", bestMove)
+	}
+}
+
+func TestSearchStop(t *testing.T) {
+	board := chess.NewBitboard(chess.StartingFen)
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+
+	bestMove := searchWithin(t, 5*time.Second, board, &uci.Limits{Infinite: true}, stop)
+	if bestMove == nil || !board.IsLegal(bestMove) {
+		t.Errorf("expected a legal move, got %v", bestMove)
+	}
+	if board.Fen() != chess.StartingFen {
+		t.Errorf("board changed to '%s'", board.Fen())
+	}
+}
+
+func TestSearchTime(t *testing.T) {
+	board := chess.NewBitboard(chess.StartingFen)
+	start := time.Now()
+	searchWithin(t, 5*time.Second, board, &uci.Limits{MoveTime: 100 * time.Millisecond}, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the search to take about 100ms, took %s", elapsed)
+	}
+
+	start = time.Now()
+	searchWithin(t, 5*time.Second, board, &uci.Limits{WhiteTime: 2 * time.Second, BlackTime: 2 * time.Second}, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the search to use a fraction of the clock, took %s", elapsed)
+	}
+}
+
+// While pondering the search does not return on its own. After a ponder
+// hit it uses the clock as usual.
+func TestSearchPonderHit(t *testing.T) {
+	board := chess.NewBitboard(chess.StartingFen)
+	stop := make(chan struct{})
+	ponderHit := make(chan struct{})
+	limits := &uci.Limits{Ponder: true, PonderHit: ponderHit, WhiteTime: 2 * time.Second, BlackTime: 2 * time.Second}
+
+	done := make(chan *chess.Move)
+	go func() {
+		bestMove, _ := NewEngine(1).Search(board, limits, nil, stop)
+		done <- bestMove
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("search returned while pondering")
+	case <-time.After(time.Second):
+	}
+
+	close(ponderHit)
+	select {
+	case bestMove := <-done:
+		if bestMove == nil {
+			t.Error("expected a move after the ponder hit")
+		}
+	case <-time.After(5 * time.Second):
+		close(stop)
+		t.Fatal("search did not return after the ponder hit")
+	}
+}
+
+func TestTranspositionTable(t *testing.T) {
+	tt := newTranspositionTable(1)
+	move := chess.PackMove(chess.NewMove(chess.E2, chess.E4, chess.None))
+
+	tt.store(42, move, 100, MaxPly-1, boundLower)
+	entry, ok := tt.probe(42)
+	if !ok || entry.move != move || entry.score != 100 || int(entry.depth) != MaxPly-1 || entry.bound != boundLower {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	// A shallower bound does not replace a deeper one, but keeps its move.
+	tt.store(42, chess.PackedNullMove, 50, 3, boundUpper)
+	if entry, _ := tt.probe(42); entry.score != 100 {
+		t.Errorf("expected the deeper entry to be kept, got %+v", entry)
+	}
+	tt.store(42, chess.PackedNullMove, 50, 3, boundExact)
+	if entry, _ := tt.probe(42); entry.score != 50 || entry.move != move {
+		t.Errorf("expected an exact entry with the old move, got %+v", entry)
+	}
+
+	if _, ok := tt.probe(43); ok {
+		t.Error("unexpected entry for another key")
+	}
+
+	// Mate scores are relative to the position.
+	if score := scoreFromTT(scoreToTT(mateValue-5, 3), 7); score != mateValue-9 {
+		t.Errorf("unexpected mate score %d", score)
+	}
+}
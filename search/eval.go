@@ -0,0 +1,36 @@
+package search
+
+import (
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// Values of the pieces in centipawns. Kings are never traded, so their
+// value only matters for move ordering.
+var PieceValues = [...]int{
+	chess.None:   0,
+	chess.Pawn:   100,
+	chess.Knight: 320,
+	chess.Bishop: 330,
+	chess.Rook:   500,
+	chess.Queen:  900,
+	chess.King:   20000,
+}
+
+// Counts the material balance in centipawns, from the point of view of the
+// side to move.
+func Material(board *chess.Bitboard) int {
+	score := 0
+	pieces := board.GetPieces()
+	for square, pieceType := range pieces {
+		if pieceType == chess.None || pieceType == chess.King {
+			continue
+		}
+
+		if board.CheckSquareColor(square) == board.GetTurn() {
+			score += PieceValues[pieceType]
+		} else {
+			score -= PieceValues[pieceType]
+		}
+	}
+	return score
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"unsafe"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// Kinds of scores stored in the transposition table.
+const (
+	boundExact uint8 = iota + 1
+	boundLower
+	boundUpper
+)
+
+type ttEntry struct {
+	key   uint64
+	score int32
+	move  chess.PackedMove
+	depth int8 // Below `MaxPly`, see the check extension.
+	bound uint8
+}
+
+// A transposition table keyed by `Bitboard.ZobristHash()`. Entries are
+// always replaced, unless the stored one was searched deeper for the same
+// position.
+type transpositionTable struct {
+	entries []ttEntry
+	mask    uint64
+}
+
+// Creates a table of about the given size in megabytes. The number of
+// entries is rounded down to a power of two.
+func newTranspositionTable(megabytes int) *transpositionTable {
+	if megabytes < 1 {
+		megabytes = 1
+	}
+
+	size := uint64(megabytes) * 1024 * 1024 / uint64(unsafe.Sizeof(ttEntry{}))
+	n := uint64(1)
+	for n*2 <= size {
+		n *= 2
+	}
+
+	return &transpositionTable{entries: make([]ttEntry, n), mask: n - 1}
+}
+
+func (t *transpositionTable) clear() {
+	for i := range t.entries {
+		t.entries[i] = ttEntry{}
+	}
+}
+
+func (t *transpositionTable) probe(key uint64) (ttEntry, bool) {
+	entry := t.entries[key&t.mask]
+	return entry, entry.bound != 0 && entry.key == key
+}
+
+func (t *transpositionTable) store(key uint64, move chess.PackedMove, score, depth int, bound uint8) {
+	entry := &t.entries[key&t.mask]
+	if entry.key == key && int(entry.depth) > depth && bound != boundExact {
+		return
+	}
+
+	// Keep the known best move if there is no new one.
+	if move == chess.PackedNullMove && entry.key == key {
+		move = entry.move
+	}
+
+	*entry = ttEntry{key: key, score: int32(score), move: move, depth: int8(depth), bound: bound}
+}
+
+// Gets the permille of used entries, sampled from the start of the table.
+func (t *transpositionTable) hashFull() int {
+	n := len(t.entries)
+	if n > 1000 {
+		n = 1000
+	}
+
+	used := 0
+	for i := 0; i < n; i++ {
+		if t.entries[i].bound != 0 {
+			used++
+		}
+	}
+	return used * 1000 / n
+}
+
+// Mate scores are stored relative to the position instead of the root.
+func scoreToTT(score, ply int) int {
+	if score >= mateBound {
+		return score + ply
+	} else if score <= -mateBound {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score, ply int) int {
+	if score >= mateBound {
+		return score - ply
+	} else if score <= -mateBound {
+		return score + ply
+	}
+	return score
+}
@@ -0,0 +1,170 @@
+package chess
+
+// Values of the pieces for static exchange evaluation. Knights and bishops
+// are worth the same, so that trading them is even.
+var SEEValues = [...]int{
+	None:   0,
+	Pawn:   100,
+	Knight: 300,
+	Bishop: 300,
+	Rook:   500,
+	Queen:  900,
+	King:   20000,
+}
+
+// Gets all pieces of both colors attacking the given square, as if only
+// the given squares were occupied.
+func (b *Bitboard) attackersTo(square int, occupied uint64) uint64 {
+	attackers := BBPawnAttacks[Black][square] & b.pawns & b.occupiedCo[White]
+	attackers |= BBPawnAttacks[White][square] & b.pawns & b.occupiedCo[Black]
+	attackers |= BBKnightAttacks[square] & b.knights
+	attackers |= bishopAttacks(square, occupied) & (b.bishops | b.queens)
+	attackers |= rookAttacks(square, occupied) & (b.rooks | b.queens)
+	attackers |= BBKingAttacks[square] & b.kings
+	return attackers & occupied
+}
+
+// Statically evaluates the exchange on the target square of the given
+// move. Both sides take turns capturing on the square with their least
+// valuable attacker and may stop whenever continuing would lose material.
+//
+// Returns the material the side to move wins (or loses, if negative) in
+// `SEEValues`. Sliders behind other attackers join the exchange once
+// the way is clear. En-passant captures and promotions are accounted for.
+// Pins, checks and variant rules are ignored. Castling and null moves are
+// always even.
+//
+//     board := chess.NewBitboard("1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1")
+//     board.SEE(chess.NewMove(chess.E1, chess.E5, chess.None))  // 100
+func (b *Bitboard) SEE(move *Move) int {
+	if move == nil || b.castlingSide(move) != -1 {
+		return 0
+	}
+	return b.see(move, b.turn)
+}
+
+// Checks if the static exchange evaluation of the move is at least the
+// given threshold. Cheaper than `SEE()` when the bounds already decide.
+func (b *Bitboard) SEEGreaterOrEqual(move *Move, threshold int) bool {
+	if move == nil || b.castlingSide(move) != -1 {
+		return threshold <= 0
+	}
+
+	// No exchange gains more than the first capture.
+	gain, _ := b.seeFirstCapture(move)
+	if gain < threshold {
+		return false
+	}
+
+	return b.see(move, b.turn) >= threshold
+}
+
+// Gets the material won by the first capture of the move, including the
+// promotion, and the type of the piece then standing on the target square.
+func (b *Bitboard) seeFirstCapture(move *Move) (int, PieceTypes) {
+	gain := SEEValues[b.pieces[move.toSquare]]
+	if b.IsEnPassant(move) {
+		gain = SEEValues[Pawn]
+	}
+
+	pieceType := b.pieces[move.fromSquare]
+	if move.drop != None {
+		pieceType = move.drop
+		gain = 0
+	} else if move.promotion != None {
+		gain += SEEValues[move.promotion] - SEEValues[Pawn]
+		pieceType = move.promotion
+	}
+
+	return gain, pieceType
+}
+
+func (b *Bitboard) see(move *Move, color Colors) int {
+	var gains [32]int
+	var onSquare PieceTypes
+	gains[0], onSquare = b.seeFirstCapture(move)
+
+	to := move.toSquare
+	occupied := b.occupied
+	if move.drop == None {
+		occupied &^= BBSquares[move.fromSquare]
+	}
+	if b.IsEnPassant(move) {
+		if color == White {
+			occupied &^= BBSquares[to-8]
+		} else {
+			occupied &^= BBSquares[to+8]
+		}
+	}
+	occupied |= BBSquares[to]
+
+	promotes := BBSquares[to]&(BBRank1|BBRank8) != 0
+	attackers := b.attackersTo(to, occupied) &^ BBSquares[to]
+
+	depth := 0
+	for side := color ^ 1; depth+1 < len(gains); side ^= 1 {
+		own := attackers & b.occupiedCo[side]
+		if own == 0 {
+			break
+		}
+
+		// Find the least valuable attacker.
+		var attacker int
+		var attackerType PieceTypes
+		for pieceType := Pawn; pieceType <= King; pieceType++ {
+			if pieces := own & b.pieceMask(pieceType); pieces != 0 {
+				attacker = lsb(pieces)
+				attackerType = pieceType
+				break
+			}
+		}
+
+		occupied &^= BBSquares[attacker]
+		attackers |= bishopAttacks(to, occupied) & (b.bishops | b.queens)
+		attackers |= rookAttacks(to, occupied) & (b.rooks | b.queens)
+		attackers &= occupied &^ BBSquares[to]
+
+		// The king can not capture into a defended square.
+		if attackerType == King && attackers&b.occupiedCo[side^1] != 0 {
+			break
+		}
+
+		depth++
+		gains[depth] = SEEValues[onSquare] - gains[depth-1]
+		onSquare = attackerType
+		if attackerType == Pawn && promotes {
+			gains[depth] += SEEValues[Queen] - SEEValues[Pawn]
+			onSquare = Queen
+		}
+	}
+
+	// Either side stops capturing if that is better.
+	for ; depth > 0; depth-- {
+		if gains[depth] > -gains[depth-1] {
+			gains[depth-1] = -gains[depth]
+		}
+	}
+
+	return gains[0]
+}
+
+// Gets the pieces of the given color that the other side can win material
+// from by capturing them, judged by `SEE()`. Kings are never included.
+func (b *Bitboard) Hanging(color Colors) *SquareSet {
+	hanging := BBVoid
+	for squares := b.occupiedCo[color] &^ b.kings; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		for attackers := b.AttackerMask(color^1, square); attackers != 0; attackers &= attackers - 1 {
+			move := NewMove(lsb(attackers), square, None)
+			if b.pieces[move.fromSquare] == Pawn && BBSquares[square]&(BBRank1|BBRank8) != 0 {
+				move.promotion = Queen
+			}
+
+			if b.see(move, color^1) > 0 {
+				hanging |= BBSquares[square]
+				break
+			}
+		}
+	}
+	return NewSquareSet(hanging)
+}
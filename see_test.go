@@ -0,0 +1,89 @@
+package chess
+
+import "testing"
+
+func TestSEE(t *testing.T) {
+	tests := []struct {
+		fen   string
+		move  string
+		value int
+	}{
+		// The rook wins a pawn, the rook on d8 can not recapture.
+		{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+		// Queens behind the rook and bishop join the exchange.
+		{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", -200},
+		// The second rook x-rays through the first.
+		{"4k3/4r3/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", 100},
+		{"4k3/4r3/8/4p3/8/8/4R3/6K1 w - - 0 1", "e2e5", -400},
+		// Capture with promotion.
+		{"1r5k/P7/8/8/8/8/8/7K w - - 0 1", "a7b8q", 1300},
+		// The new queen is taken.
+		{"r6k/1P6/8/8/8/8/8/7K w - - 0 1", "b7b8q", -100},
+		// En passant, with and without a recapture.
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", "e5d6", 100},
+		{"4k3/2p5/8/3pP3/8/8/8/4K3 w - d6 0 2", "e5d6", 0},
+		// The king may only recapture if the square is not defended.
+		{"8/8/8/4k3/3p4/8/1B6/3R2K1 w - - 0 1", "b2d4", 100},
+		{"8/8/8/4k3/3p4/8/1B6/6K1 w - - 0 1", "b2d4", -200},
+		// Quiet moves to attacked squares.
+		{"4k3/8/8/8/2p5/8/8/3NK3 w - - 0 1", "d1b2", 0},
+		{"4k3/8/8/8/8/2p5/8/3NK3 w - - 0 1", "d1b2", -300},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		move := MoveFromUci(test.move)
+		if value := board.SEE(move); value != test.value {
+			t.Errorf("%s %s: expected %d, got %d", test.fen, test.move, test.value, value)
+		}
+
+		for _, threshold := range []int{test.value - 1, test.value, test.value + 1} {
+			if ok := board.SEEGreaterOrEqual(move, threshold); ok != (test.value >= threshold) {
+				t.Errorf("%s %s: wrong result for threshold %d", test.fen, test.move, threshold)
+			}
+		}
+
+		if board.Fen() != test.fen {
+			t.Errorf("%s: board changed to '%s'", test.fen, board.Fen())
+		}
+	}
+
+	board := NewBitboard(StartingFen)
+	if value := board.SEE(nil); value != 0 {
+		t.Errorf("expected 0 for a null move, got %d", value)
+	}
+	board = NewBitboard("4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1")
+	if value := board.SEE(MoveFromUci("e1g1")); value != 0 {
+		t.Errorf("expected 0 for castling, got %d", value)
+	}
+}
+
+func TestHanging(t *testing.T) {
+	tests := []struct {
+		fen   string
+		white uint64
+		black uint64
+	}{
+		// The knight is attacked by a pawn.
+		{"4k3/8/8/3n4/4P3/8/8/4K3 b - - 0 1", BBVoid, BBD5},
+		// Only the black rook is undefended.
+		{"3r4/5k2/8/8/8/8/8/3RK3 w - - 0 1", BBVoid, BBD8},
+		{"3rk3/8/8/8/8/8/8/3RK3 w - - 0 1", BBVoid, BBVoid},
+		// The pawn and the queen attack each other.
+		{"4k3/8/8/3q4/2P5/8/8/4K3 w - - 0 1", BBC4, BBD5},
+		// The king can take the queen, but is never hanging itself.
+		{"4k3/8/8/8/8/8/3q4/4K3 w - - 0 1", BBVoid, BBD2},
+		// Defended, but attacked by a less valuable piece.
+		{"4k3/8/3r4/8/8/8/3Q4/3QK3 w - - 0 1", BBD2, BBD6},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+		if hanging := board.Hanging(White); hanging.mask != test.white {
+			t.Errorf("%s: wrong hanging white pieces %v", test.fen, hanging.Squares())
+		}
+		if hanging := board.Hanging(Black); hanging.mask != test.black {
+			t.Errorf("%s: wrong hanging black pieces %v", test.fen, hanging.Squares())
+		}
+	}
+}
@@ -8,14 +8,49 @@ func NewSquareSet(mask uint64) *SquareSet {
 	return &SquareSet{mask}
 }
 
+// Gets the number of squares in the set.
+func (s *SquareSet) Len() int {
+	return popCount(s.mask)
+}
+
+// Gets the squares in the set, in ascending order.
+func (s *SquareSet) Squares() []int {
+	result := make([]int, 0, popCount(s.mask))
+	for squares := s.mask; squares != 0; squares &= squares - 1 {
+		result = append(result, lsb(squares))
+	}
+	return result
+}
+
+// Yields the squares in the set, in ascending order. The channel is closed
+// after the last square. `All()` does the same without starting a
+// goroutine.
 func (s *SquareSet) Iter() <-chan int {
 	ch := make(chan int)
 	go func() {
-        square := bitScan(s.mask, 0)
-        for square != -1 {
-            ch <- square
-            square = bitScan(s.mask, square+1)
-        }
+		for squares := s.mask; squares != 0; squares &= squares - 1 {
+			ch <- lsb(squares)
+		}
+		close(ch)
 	}()
 	return ch
 }
+
+// Yields the squares in the set, in ascending order, until `yield` returns
+// false. Nothing is allocated, so this is cheaper than `Iter()` and
+// `Squares()` in loops.
+//
+//     set.All()(func(square int) bool {
+//         fmt.Println(SquareNames[square])
+//         return true
+//     })
+func (s *SquareSet) All() func(yield func(int) bool) {
+	mask := s.mask
+	return func(yield func(int) bool) {
+		for squares := mask; squares != 0; squares &= squares - 1 {
+			if !yield(lsb(squares)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package chess
+
+import "testing"
+
+func TestSquareSetAll(t *testing.T) {
+	set := NewSquareSet(BBA1 | BBE4 | BBH8)
+
+	squares := []int{}
+	set.All()(func(square int) bool {
+		squares = append(squares, square)
+		return true
+	})
+	if len(squares) != 3 || squares[0] != A1 || squares[1] != E4 || squares[2] != H8 {
+		t.Errorf("unexpected squares: %v", squares)
+	}
+
+	count := 0
+	set.All()(func(square int) bool {
+		count++
+		return square != E4
+	})
+	if count != 2 {
+		t.Errorf("expected the iteration to stop after e4, got %d squares", count)
+	}
+
+	NewSquareSet(BBVoid).All()(func(square int) bool {
+		t.Errorf("unexpected square in empty set: %d", square)
+		return true
+	})
+}
+
+func TestSquareSetIter(t *testing.T) {
+	squares := []int{}
+	for square := range NewSquareSet(BBA1 | BBE4 | BBH8).Iter() {
+		squares = append(squares, square)
+	}
+	if len(squares) != 3 || squares[0] != A1 || squares[1] != E4 || squares[2] != H8 {
+		t.Errorf("unexpected squares: %v", squares)
+	}
+
+	for square := range NewSquareSet(BBVoid).Iter() {
+		t.Errorf("unexpected square in empty set: %d", square)
+	}
+}
+
+var benchmarkSquareSet = NewSquareSet(BBRank1 | BBRank2 | BBRank7 | BBRank8)
+
+func BenchmarkSquareSetAll(b *testing.B) {
+	b.ReportAllocs()
+	sum := 0
+	for i := 0; i < b.N; i++ {
+		benchmarkSquareSet.All()(func(square int) bool {
+			sum += square
+			return true
+		})
+	}
+	if sum == 0 {
+		b.Fatal("no squares")
+	}
+}
+
+func BenchmarkSquareSetIter(b *testing.B) {
+	b.ReportAllocs()
+	sum := 0
+	for i := 0; i < b.N; i++ {
+		for square := range benchmarkSquareSet.Iter() {
+			sum += square
+		}
+	}
+	if sum == 0 {
+		b.Fatal("no squares")
+	}
+}
+
+func BenchmarkSquareSetSquares(b *testing.B) {
+	b.ReportAllocs()
+	sum := 0
+	for i := 0; i < b.N; i++ {
+		for _, square := range benchmarkSquareSet.Squares() {
+			sum += square
+		}
+	}
+	if sum == 0 {
+		b.Fatal("no squares")
+	}
+}
@@ -0,0 +1,1507 @@
+package chess
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The maximum number of pieces supported by the Syzygy tables.
+const SyzygyMaxPieces = 6
+
+var syzygyWdlMagic = [4]byte{0x71, 0xe8, 0x23, 0x5d}
+var syzygyDtzMagic = [4]byte{0xd7, 0x66, 0x0c, 0xa5}
+
+var syzygyTableNameRegex = regexp.MustCompile("^K[QRBNP]*vK[QRBNP]*$")
+
+// Piece types in the order they appear in table names.
+var syzygyPieceOrder = [...]PieceTypes{King, Queen, Rook, Bishop, Knight, Pawn}
+
+var syzygyTriangle = [64]int{
+	6, 0, 1, 2, 2, 1, 0, 6,
+	0, 7, 3, 4, 4, 3, 7, 0,
+	1, 3, 8, 5, 5, 8, 3, 1,
+	2, 4, 5, 9, 9, 5, 4, 2,
+	2, 4, 5, 9, 9, 5, 4, 2,
+	1, 3, 8, 5, 5, 8, 3, 1,
+	0, 7, 3, 4, 4, 3, 7, 0,
+	6, 0, 1, 2, 2, 1, 0, 6,
+}
+
+var syzygyLower = [64]int{
+	28, 0, 1, 2, 3, 4, 5, 6,
+	0, 29, 7, 8, 9, 10, 11, 12,
+	1, 7, 30, 13, 14, 15, 16, 17,
+	2, 8, 13, 31, 18, 19, 20, 21,
+	3, 9, 14, 18, 32, 22, 23, 24,
+	4, 10, 15, 19, 22, 33, 25, 26,
+	5, 11, 16, 20, 23, 25, 34, 27,
+	6, 12, 17, 21, 24, 26, 27, 35,
+}
+
+var syzygyDiag = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 8,
+	0, 1, 0, 0, 0, 0, 9, 0,
+	0, 0, 2, 0, 0, 10, 0, 0,
+	0, 0, 0, 3, 11, 0, 0, 0,
+	0, 0, 0, 12, 4, 0, 0, 0,
+	0, 0, 13, 0, 0, 5, 0, 0,
+	0, 14, 0, 0, 0, 0, 6, 0,
+	15, 0, 0, 0, 0, 0, 0, 7,
+}
+
+var syzygyFlap = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 6, 12, 18, 18, 12, 6, 0,
+	1, 7, 13, 19, 19, 13, 7, 1,
+	2, 8, 14, 20, 20, 14, 8, 2,
+	3, 9, 15, 21, 21, 15, 9, 3,
+	4, 10, 16, 22, 22, 16, 10, 4,
+	5, 11, 17, 23, 23, 17, 11, 5,
+	0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var syzygyPtwist = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	47, 35, 23, 11, 10, 22, 34, 46,
+	45, 33, 21, 9, 8, 20, 32, 44,
+	43, 31, 19, 7, 6, 18, 30, 42,
+	41, 29, 17, 5, 4, 16, 28, 40,
+	39, 27, 15, 3, 2, 14, 26, 38,
+	37, 25, 13, 1, 0, 12, 24, 36,
+	0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var syzygyInvFlap = [24]int{
+	8, 16, 24, 32, 40, 48,
+	9, 17, 25, 33, 41, 49,
+	10, 18, 26, 34, 42, 50,
+	11, 19, 27, 35, 43, 51,
+}
+
+var syzygyFileToFile = [8]int{0, 1, 2, 3, 3, 2, 1, 0}
+
+// Index factors of the leading pieces for the encoding types of tables
+// without pawns.
+var syzygyPivotFactor = [3]uint64{31332, 28056, 462}
+
+// Maps WDL values to the value maps and the flags of DTZ tables.
+var syzygyWdlToMap = [5]int{1, 3, 0, 2, 0}
+var syzygyPaFlags = [5]byte{8, 0, 0, 0, 4}
+
+// DTZ values of positions that are decided by a capture or pawn move,
+// indexed by WDL value.
+var syzygyWdlToDtz = [5]int{-1, -101, 0, 101, 1}
+
+var syzygyBinomial [SyzygyMaxPieces - 1][64]uint64
+var syzygyPawnIdx [SyzygyMaxPieces - 1][24]uint64
+var syzygyPawnFactor [SyzygyMaxPieces - 1][4]uint64
+var syzygyKKIdx [10][64]uint64
+
+func init() {
+	// Binomial coefficients, syzygyBinomial[k - 1][n] is n over k.
+	for i := range syzygyBinomial {
+		for j := 0; j < 64; j++ {
+			f, l := j, 1
+			for k := 1; k <= i; k++ {
+				f *= j - k
+				l *= k + 1
+			}
+			syzygyBinomial[i][j] = uint64(f / l)
+		}
+	}
+
+	for i := range syzygyPawnIdx {
+		j := 0
+		for file := 0; file < 4; file++ {
+			s := uint64(0)
+			for ; j < 6*(file+1); j++ {
+				syzygyPawnIdx[i][j] = s
+				if i == 0 {
+					s++
+				} else {
+					s += syzygyBinomial[i-1][syzygyPtwist[syzygyInvFlap[j]]]
+				}
+			}
+			syzygyPawnFactor[i][file] = s
+		}
+	}
+
+	// All 462 legal positions of two kings, where the first one is in the
+	// a1-d1-d4 triangle. If the first king is on the diagonal, the second
+	// one must not be above it. Positions with both kings on the diagonal
+	// come last.
+	code := uint64(0)
+	bothOnDiagonal := [][2]int{}
+	for idx := 0; idx < 10; idx++ {
+		for s1 := A1; s1 <= D4; s1++ {
+			if fileIndex(s1) > 3 || rankIndex(s1) > fileIndex(s1) || syzygyTriangle[s1] != idx {
+				continue
+			}
+
+			for s2 := A1; s2 <= H8; s2++ {
+				if (BBKingAttacks[s1]|BBSquares[s1])&BBSquares[s2] > 0 {
+					continue
+				}
+
+				if syzygyOffDiag(s1) == 0 && syzygyOffDiag(s2) > 0 {
+					continue
+				}
+
+				if syzygyOffDiag(s1) == 0 && syzygyOffDiag(s2) == 0 {
+					bothOnDiagonal = append(bothOnDiagonal, [2]int{idx, s2})
+				} else {
+					syzygyKKIdx[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, pair := range bothOnDiagonal {
+		syzygyKKIdx[pair[0]][pair[1]] = code
+		code++
+	}
+}
+
+// Gets the distance of the square from the a1-h8 diagonal. Positive above
+// the diagonal and negative below it.
+func syzygyOffDiag(square int) int {
+	return rankIndex(square) - fileIndex(square)
+}
+
+// Mirrors the square at the a1-h8 diagonal.
+func syzygyFlipDiag(square int) int {
+	return ((square >> 3) | (square << 3)) & 63
+}
+
+// The number of ways to choose k squares out of n.
+func syzygySubfactor(k, n int) uint64 {
+	f := uint64(n)
+	l := uint64(1)
+	for i := 1; i < k; i++ {
+		f *= uint64(n - i)
+		l *= uint64(i + 1)
+	}
+	return f / l
+}
+
+// Gets the key of the material configuration of the position, for
+// example `KRPvKR`. With `mirror` the colors are swapped.
+func syzygyKey(b *Bitboard, mirror bool) string {
+	white, black := b.occupiedCo[White], b.occupiedCo[Black]
+	if mirror {
+		white, black = black, white
+	}
+
+	key := ""
+	for _, pieceType := range syzygyPieceOrder {
+		key += strings.Repeat(strings.ToUpper(PieceSymbols[pieceType]), popCount(b.pieceMask(pieceType)&white))
+	}
+	key += "v"
+	for _, pieceType := range syzygyPieceOrder {
+		key += strings.Repeat(strings.ToUpper(PieceSymbols[pieceType]), popCount(b.pieceMask(pieceType)&black))
+	}
+	return key
+}
+
+// Gets the key of a material configuration given by the piece codes from
+// a table header. Some tables are stored with the colors swapped compared
+// to their file name.
+func syzygyPiecesKey(pieces []int, mirror bool) string {
+	white, black := 0, 8
+	if mirror {
+		white, black = 8, 0
+	}
+
+	count := func(code int) int {
+		n := 0
+		for _, piece := range pieces {
+			if piece == code {
+				n++
+			}
+		}
+		return n
+	}
+
+	key := ""
+	for _, pieceType := range syzygyPieceOrder {
+		key += strings.Repeat(strings.ToUpper(PieceSymbols[pieceType]), count(int(pieceType)|white))
+	}
+	key += "v"
+	for _, pieceType := range syzygyPieceOrder {
+		key += strings.Repeat(strings.ToUpper(PieceSymbols[pieceType]), count(int(pieceType)|black))
+	}
+	return key
+}
+
+// Swaps the sides of a table name.
+func syzygyMirrorName(name string) string {
+	parts := strings.SplitN(name, "v", 2)
+	return parts[1] + "v" + parts[0]
+}
+
+// Huffman coded data of a table, see `decompress()`.
+type syzygyPairs struct {
+	indexTable int64
+	sizeTable  int64
+	data       int64
+
+	blockSize uint
+	idxBits   uint
+	minLen    int
+
+	// Indexed by the code length minus `minLen`.
+	offset []uint64
+	base   []uint64
+
+	symLen []int
+	symPat []byte
+}
+
+// The way the pieces of one side (and for tables with pawns one file of
+// the leading pawn) are mapped to an index.
+type syzygyEncoding struct {
+	pieces []int
+	norm   []int
+	factor [SyzygyMaxPieces]uint64
+	size   uint64
+	pairs  *syzygyPairs
+}
+
+type syzygyTable struct {
+	path        string
+	dtz         bool
+	key         string
+	mirroredKey string
+	symmetric   bool
+	num         int
+	hasPawns    bool
+	pawns       [2]int
+	encType     int
+
+	mutex       sync.Mutex
+	initialized bool
+	err         error
+	file        *os.File
+
+	// Indexed by the file of the leading pawn (always 0 for tables
+	// without pawns) and the side. DTZ tables store only one side.
+	encodings [4][2]*syzygyEncoding
+
+	// Flags and value maps of DTZ tables, indexed by file.
+	flags     [4]byte
+	mapOffset int64
+	mapIdx    [4][4]int64
+}
+
+func newSyzygyTable(path string, dtz bool) *syzygyTable {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	t := &syzygyTable{path: path, dtz: dtz}
+	t.key = name
+	t.mirroredKey = syzygyMirrorName(name)
+	t.symmetric = t.key == t.mirroredKey
+	t.num = len(name) - 1
+	t.hasPawns = strings.Contains(name, "P")
+
+	parts := strings.SplitN(name, "v", 2)
+	if t.hasPawns {
+		// The leading color is the one with fewer, but at least one, pawns.
+		t.pawns = [2]int{strings.Count(parts[0], "P"), strings.Count(parts[1], "P")}
+		if t.pawns[1] > 0 && (t.pawns[0] == 0 || t.pawns[1] < t.pawns[0]) {
+			t.pawns[0], t.pawns[1] = t.pawns[1], t.pawns[0]
+		}
+	} else {
+		unique := 0
+		for _, part := range parts {
+			for _, pieceType := range syzygyPieceOrder {
+				if strings.Count(part, strings.ToUpper(PieceSymbols[pieceType])) == 1 {
+					unique++
+				}
+			}
+		}
+		if unique >= 3 {
+			t.encType = 0
+		} else {
+			t.encType = 2
+		}
+	}
+
+	return t
+}
+
+func (t *syzygyTable) read(offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := t.file.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (t *syzygyTable) readByte(offset int64) (byte, error) {
+	buf, err := t.read(offset, 1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// Opens the file and reads the header on first use.
+func (t *syzygyTable) init() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.initialized {
+		return t.err
+	}
+	t.initialized = true
+
+	t.file, t.err = os.Open(t.path)
+	if t.err != nil {
+		return t.err
+	}
+
+	t.err = t.readHeader()
+	return t.err
+}
+
+func (t *syzygyTable) readHeader() error {
+	header, err := t.read(0, 5)
+	if err != nil {
+		return err
+	}
+
+	magic := syzygyWdlMagic
+	if t.dtz {
+		magic = syzygyDtzMagic
+	}
+	if [4]byte{header[0], header[1], header[2], header[3]} != magic {
+		return fmt.Errorf("invalid magic header in syzygy table: '%s'.", t.path)
+	}
+
+	// WDL tables may store both sides, DTZ tables store only one.
+	sides := 1
+	if !t.dtz && header[4]&0x01 != 0 {
+		sides = 2
+	}
+	files := 1
+	if header[4]&0x02 != 0 {
+		files = 4
+	}
+
+	// Piece codes, the order of the pieces in the index and the
+	// normalization of both sides (the low and the high nibble).
+	nibbles := 2
+	if t.dtz {
+		nibbles = 1
+	}
+	offset := int64(5)
+	if !t.hasPawns {
+		data, err := t.read(offset, t.num+1)
+		if err != nil {
+			return err
+		}
+		for side := 0; side < nibbles; side++ {
+			t.encodings[0][side] = t.pieceEncoding(data, side)
+		}
+		offset += int64(t.num + 1)
+	} else {
+		leading := 1
+		if t.pawns[1] > 0 {
+			leading = 2
+		}
+		for file := 0; file < 4; file++ {
+			data, err := t.read(offset, t.num+leading)
+			if err != nil {
+				return err
+			}
+			for side := 0; side < nibbles; side++ {
+				t.encodings[file][side] = t.pawnEncoding(data, side, file)
+			}
+			offset += int64(t.num + leading)
+		}
+	}
+	offset += offset & 0x01
+
+	sizes := [4][2][3]uint64{}
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			encoding := t.encodings[file][side]
+			pairs, next, flags, err := t.setupPairs(offset, encoding.size, &sizes[file][side])
+			if err != nil {
+				return err
+			}
+			encoding.pairs = pairs
+			t.flags[file] = flags
+			offset = next
+		}
+	}
+
+	// Value maps of DTZ tables.
+	if t.dtz {
+		t.mapOffset = offset
+		for file := 0; file < files; file++ {
+			if t.flags[file]&0x02 == 0 {
+				continue
+			}
+			for i := 0; i < 4; i++ {
+				length, err := t.readByte(offset)
+				if err != nil {
+					return err
+				}
+				t.mapIdx[file][i] = offset + 1 - t.mapOffset
+				offset += 1 + int64(length)
+			}
+		}
+		offset += offset & 0x01
+	}
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			t.encodings[file][side].pairs.indexTable = offset
+			offset += int64(sizes[file][side][0])
+		}
+	}
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			t.encodings[file][side].pairs.sizeTable = offset
+			offset += int64(sizes[file][side][1])
+		}
+	}
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			offset = (offset + 0x3f) &^ 0x3f
+			t.encodings[file][side].pairs.data = offset
+			offset += int64(sizes[file][side][2])
+		}
+	}
+
+	// Tables without pawns may be stored with the colors swapped.
+	if !t.hasPawns {
+		t.key = syzygyPiecesKey(t.encodings[0][0].pieces, false)
+		t.mirroredKey = syzygyPiecesKey(t.encodings[0][0].pieces, true)
+	}
+
+	return nil
+}
+
+func (t *syzygyTable) pieceEncoding(data []byte, side int) *syzygyEncoding {
+	shift := uint(4 * side)
+	encoding := &syzygyEncoding{
+		pieces: make([]int, t.num),
+		norm:   make([]int, t.num),
+	}
+	for i := range encoding.pieces {
+		encoding.pieces[i] = int(data[i+1]>>shift) & 0x0f
+	}
+	order := int(data[0]>>shift) & 0x0f
+
+	// The leading pieces are encoded together.
+	if t.encType == 0 {
+		encoding.norm[0] = 3
+	} else {
+		encoding.norm[0] = 2
+	}
+	t.normalize(encoding, encoding.norm[0])
+
+	n := 64 - encoding.norm[0]
+	f := uint64(1)
+	for i, k := encoding.norm[0], 0; i < t.num || k == order; k++ {
+		if k == order {
+			encoding.factor[0] = f
+			f *= syzygyPivotFactor[t.encType]
+		} else {
+			encoding.factor[i] = f
+			f *= syzygySubfactor(encoding.norm[i], n)
+			n -= encoding.norm[i]
+			i += encoding.norm[i]
+		}
+	}
+	encoding.size = f
+
+	return encoding
+}
+
+func (t *syzygyTable) pawnEncoding(data []byte, side, file int) *syzygyEncoding {
+	shift := uint(4 * side)
+	leading := 1
+	order2 := 0x0f
+	if t.pawns[1] > 0 {
+		leading = 2
+		order2 = int(data[1]>>shift) & 0x0f
+	}
+
+	encoding := &syzygyEncoding{
+		pieces: make([]int, t.num),
+		norm:   make([]int, t.num),
+	}
+	for i := range encoding.pieces {
+		encoding.pieces[i] = int(data[i+leading]>>shift) & 0x0f
+	}
+	order := int(data[0]>>shift) & 0x0f
+
+	// The pawns of the leading color and the other pawns are encoded
+	// separately.
+	encoding.norm[0] = t.pawns[0]
+	if t.pawns[1] > 0 {
+		encoding.norm[t.pawns[0]] = t.pawns[1]
+	}
+	t.normalize(encoding, t.pawns[0]+t.pawns[1])
+
+	i := encoding.norm[0]
+	if order2 < 0x0f {
+		i += encoding.norm[i]
+	}
+	n := 64 - i
+	f := uint64(1)
+	for k := 0; i < t.num || k == order || k == order2; k++ {
+		if k == order {
+			encoding.factor[0] = f
+			f *= syzygyPawnFactor[encoding.norm[0]-1][file]
+		} else if k == order2 {
+			encoding.factor[encoding.norm[0]] = f
+			f *= syzygySubfactor(encoding.norm[encoding.norm[0]], 48-encoding.norm[0])
+		} else {
+			encoding.factor[i] = f
+			f *= syzygySubfactor(encoding.norm[i], n)
+			n -= encoding.norm[i]
+			i += encoding.norm[i]
+		}
+	}
+	encoding.size = f
+
+	return encoding
+}
+
+// Groups equal pieces starting at the given index.
+func (t *syzygyTable) normalize(encoding *syzygyEncoding, start int) {
+	for i := start; i < t.num; i += encoding.norm[i] {
+		for j := i; j < t.num && encoding.pieces[j] == encoding.pieces[i]; j++ {
+			encoding.norm[i]++
+		}
+	}
+}
+
+// Reads the Huffman code parameters and the symbol tree at the given
+// offset. Returns the offset of the next structure and the flags.
+func (t *syzygyTable) setupPairs(offset int64, tbSize uint64, size *[3]uint64) (*syzygyPairs, int64, byte, error) {
+	header, err := t.read(offset, 12)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	flags := header[0]
+	if flags&0x80 != 0 {
+		// All positions have the same value.
+		pairs := &syzygyPairs{}
+		if !t.dtz {
+			pairs.minLen = int(header[1])
+		}
+		return pairs, offset + 2, flags, nil
+	}
+
+	pairs := &syzygyPairs{
+		blockSize: uint(header[1]),
+		idxBits:   uint(header[2]),
+	}
+	realNumBlocks := uint64(binary.LittleEndian.Uint32(header[4:8]))
+	numBlocks := realNumBlocks + uint64(header[3])
+	maxLen := int(header[8])
+	pairs.minLen = int(header[9])
+	h := maxLen - pairs.minLen + 1
+
+	data, err := t.read(offset+10, 2*h+2)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	pairs.offset = make([]uint64, h)
+	for i := range pairs.offset {
+		pairs.offset[i] = uint64(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	numSyms := int(binary.LittleEndian.Uint16(data[2*h:]))
+
+	pairs.symPat, err = t.read(offset+12+2*int64(h), 3*numSyms)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	next := offset + 12 + 2*int64(h) + 3*int64(numSyms) + int64(numSyms&1)
+
+	numIndices := (tbSize + (1 << pairs.idxBits) - 1) >> pairs.idxBits
+	size[0] = 6 * numIndices
+	size[1] = 2 * numBlocks
+	size[2] = (1 << pairs.blockSize) * realNumBlocks
+
+	pairs.symLen = make([]int, numSyms)
+	done := make([]bool, numSyms)
+	for i := 0; i < numSyms; i++ {
+		if !done[i] {
+			pairs.calcSymLen(i, done)
+		}
+	}
+
+	pairs.base = make([]uint64, h)
+	for i := h - 2; i >= 0; i-- {
+		pairs.base[i] = (pairs.base[i+1] + pairs.offset[i] - pairs.offset[i+1]) / 2
+	}
+	for i := 0; i < h; i++ {
+		pairs.base[i] <<= uint(64 - (pairs.minLen + i))
+	}
+
+	return pairs, next, flags, nil
+}
+
+// Each symbol is either a literal or a pair of two other symbols.
+func (p *syzygyPairs) calcSymLen(s int, done []bool) {
+	w := p.symPat[3*s:]
+	s2 := int(w[2])<<4 | int(w[1])>>4
+	if s2 == 0x0fff {
+		p.symLen[s] = 0
+	} else {
+		s1 := int(w[1]&0x0f)<<8 | int(w[0])
+		if !done[s1] {
+			p.calcSymLen(s1, done)
+		}
+		if !done[s2] {
+			p.calcSymLen(s2, done)
+		}
+		p.symLen[s] = p.symLen[s1] + p.symLen[s2] + 1
+	}
+	done[s] = true
+}
+
+// Decodes the value with the given index.
+func (t *syzygyTable) decompress(p *syzygyPairs, idx uint64) (int, error) {
+	if p.idxBits == 0 {
+		return p.minLen, nil
+	}
+
+	mainIdx := idx >> p.idxBits
+	litIdx := int64(idx&(1<<p.idxBits-1)) - int64(1)<<(p.idxBits-1)
+
+	index, err := t.read(p.indexTable+6*int64(mainIdx), 6)
+	if err != nil {
+		return 0, err
+	}
+	block := int64(binary.LittleEndian.Uint32(index[0:4]))
+	litIdx += int64(binary.LittleEndian.Uint16(index[4:6]))
+
+	blockLen := func(block int64) (int64, error) {
+		buf, err := t.read(p.sizeTable+2*block, 2)
+		if err != nil {
+			return 0, err
+		}
+		return int64(binary.LittleEndian.Uint16(buf)), nil
+	}
+
+	if litIdx < 0 {
+		for litIdx < 0 {
+			block--
+			length, err := blockLen(block)
+			if err != nil {
+				return 0, err
+			}
+			litIdx += length + 1
+		}
+	} else {
+		for {
+			length, err := blockLen(block)
+			if err != nil {
+				return 0, err
+			}
+			if litIdx <= length {
+				break
+			}
+			litIdx -= length + 1
+			block++
+		}
+	}
+
+	// Reading the code may look a few bytes past the end of the block.
+	data, err := t.read(p.data+block<<p.blockSize, 1<<p.blockSize+8)
+	if err != nil {
+		return 0, err
+	}
+
+	code := binary.BigEndian.Uint64(data)
+	ptr := 8
+	bitCnt := 0
+	sym := 0
+	for {
+		l := 0
+		for code < p.base[l] {
+			l++
+		}
+		sym = int(p.offset[l] + (code-p.base[l])>>uint(64-(l+p.minLen)))
+		if litIdx < int64(p.symLen[sym])+1 {
+			break
+		}
+		litIdx -= int64(p.symLen[sym]) + 1
+		code <<= uint(l + p.minLen)
+		bitCnt += l + p.minLen
+		if bitCnt >= 32 {
+			bitCnt -= 32
+			code |= uint64(binary.BigEndian.Uint32(data[ptr:])) << uint(bitCnt)
+			ptr += 4
+		}
+	}
+
+	for p.symLen[sym] != 0 {
+		w := p.symPat[3*sym:]
+		s1 := int(w[1]&0x0f)<<8 | int(w[0])
+		if litIdx < int64(p.symLen[s1])+1 {
+			sym = s1
+		} else {
+			litIdx -= int64(p.symLen[s1]) + 1
+			sym = int(w[2])<<4 | int(w[1])>>4
+		}
+	}
+
+	return int(p.symPat[3*sym]), nil
+}
+
+// Gets the side and the color and square mirroring needed to look up the
+// position. Returns the mirroring of the piece codes and of the squares.
+func (t *syzygyTable) orientation(b *Bitboard) (side, cmirror, mirror int) {
+	if t.symmetric {
+		if b.turn == Black {
+			return 0, 8, 0x38
+		}
+		return 0, 0, 0
+	}
+
+	if syzygyKey(b, false) != t.key {
+		if b.turn == White {
+			return 1, 8, 0x38
+		}
+		return 0, 8, 0x38
+	}
+
+	if b.turn == White {
+		return 0, 0, 0
+	}
+	return 1, 0, 0
+}
+
+// Collects the squares of the pieces in the order of the piece codes,
+// starting at index `i`.
+func (t *syzygyTable) placePieces(b *Bitboard, pieces []int, pos *[SyzygyMaxPieces]int, i, cmirror, mirror int) error {
+	for i < t.num {
+		code := pieces[i] ^ cmirror
+		mask := b.pieceMask(PieceTypes(code&0x07)) & b.occupiedCo[code>>3]
+		if mask == 0 {
+			return fmt.Errorf("position does not match syzygy table: '%s'.", t.path)
+		}
+		for squares := mask; squares != 0 && i < t.num; squares &= squares - 1 {
+			pos[i] = lsb(squares) ^ mirror
+			i++
+		}
+	}
+	return nil
+}
+
+// Gets the index of the position in the table, as well as the encoding
+// of its side and file.
+func (t *syzygyTable) index(b *Bitboard, side, cmirror, mirror int) (*syzygyEncoding, int, uint64, error) {
+	var pos [SyzygyMaxPieces]int
+
+	if !t.hasPawns {
+		encoding := t.encodings[0][side]
+		if err := t.placePieces(b, encoding.pieces, &pos, 0, cmirror, mirror); err != nil {
+			return nil, 0, 0, err
+		}
+		return encoding, 0, t.encodePiece(encoding, &pos), nil
+	}
+
+	// The file of the leading pawn selects the encoding.
+	code := t.encodings[0][0].pieces[0] ^ cmirror
+	mask := b.pieceMask(PieceTypes(code&0x07)) & b.occupiedCo[code>>3]
+	i := 0
+	for squares := mask; squares != 0 && i < t.num; squares &= squares - 1 {
+		pos[i] = lsb(squares) ^ mirror
+		i++
+	}
+	file := t.pawnFile(&pos)
+
+	encoding := t.encodings[file][side]
+	if encoding == nil || encoding.pairs == nil {
+		return nil, 0, 0, fmt.Errorf("position does not match syzygy table: '%s'.", t.path)
+	}
+	if err := t.placePieces(b, encoding.pieces, &pos, i, cmirror, mirror); err != nil {
+		return nil, 0, 0, err
+	}
+	return encoding, file, t.encodePawn(encoding, &pos), nil
+}
+
+func (t *syzygyTable) encodePiece(encoding *syzygyEncoding, pos *[SyzygyMaxPieces]int) uint64 {
+	n := t.num
+
+	// Move the leading piece into the a1-d1-d4 triangle.
+	if pos[0]&0x04 != 0 {
+		for i := 0; i < n; i++ {
+			pos[i] ^= 0x07
+		}
+	}
+	if pos[0]&0x20 != 0 {
+		for i := 0; i < n; i++ {
+			pos[i] ^= 0x38
+		}
+	}
+
+	leading := 2
+	if t.encType == 0 {
+		leading = 3
+	}
+	i := 0
+	for i < n && syzygyOffDiag(pos[i]) == 0 {
+		i++
+	}
+	if i < leading && syzygyOffDiag(pos[i]) > 0 {
+		for i := 0; i < n; i++ {
+			pos[i] = syzygyFlipDiag(pos[i])
+		}
+	}
+
+	var idx uint64
+	if t.encType == 0 {
+		// Three unique leading pieces.
+		i := 0
+		if pos[1] > pos[0] {
+			i = 1
+		}
+		j := 0
+		if pos[2] > pos[0] {
+			j++
+		}
+		if pos[2] > pos[1] {
+			j++
+		}
+
+		if syzygyOffDiag(pos[0]) != 0 {
+			idx = uint64(syzygyTriangle[pos[0]]*63*62 + (pos[1]-i)*62 + (pos[2] - j))
+		} else if syzygyOffDiag(pos[1]) != 0 {
+			idx = uint64(6*63*62 + syzygyDiag[pos[0]]*28*62 + syzygyLower[pos[1]]*62 + pos[2] - j)
+		} else if syzygyOffDiag(pos[2]) != 0 {
+			idx = uint64(6*63*62 + 4*28*62 + syzygyDiag[pos[0]]*7*28 + (syzygyDiag[pos[1]]-i)*28 + syzygyLower[pos[2]])
+		} else {
+			idx = uint64(6*63*62 + 4*28*62 + 4*7*28 + syzygyDiag[pos[0]]*7*6 + (syzygyDiag[pos[1]]-i)*6 + (syzygyDiag[pos[2]] - j))
+		}
+		i = 3
+		idx *= encoding.factor[0]
+		return t.encodeRemaining(encoding, pos, idx, i)
+	}
+
+	// The two kings lead.
+	idx = syzygyKKIdx[syzygyTriangle[pos[0]]][pos[1]]
+	idx *= encoding.factor[0]
+	return t.encodeRemaining(encoding, pos, idx, 2)
+}
+
+func (t *syzygyTable) pawnFile(pos *[SyzygyMaxPieces]int) int {
+	for i := 1; i < t.pawns[0]; i++ {
+		if syzygyFlap[pos[0]] > syzygyFlap[pos[i]] {
+			pos[0], pos[i] = pos[i], pos[0]
+		}
+	}
+	return syzygyFileToFile[fileIndex(pos[0])]
+}
+
+func (t *syzygyTable) encodePawn(encoding *syzygyEncoding, pos *[SyzygyMaxPieces]int) uint64 {
+	n := t.num
+
+	if pos[0]&0x04 != 0 {
+		for i := 0; i < n; i++ {
+			pos[i] ^= 0x07
+		}
+	}
+
+	// Leading pawns.
+	for i := 1; i < t.pawns[0]; i++ {
+		for j := i + 1; j < t.pawns[0]; j++ {
+			if syzygyPtwist[pos[i]] < syzygyPtwist[pos[j]] {
+				pos[i], pos[j] = pos[j], pos[i]
+			}
+		}
+	}
+
+	k := t.pawns[0] - 1
+	idx := syzygyPawnIdx[k][syzygyFlap[pos[0]]]
+	for i := k; i > 0; i-- {
+		idx += syzygyBinomial[k-i][syzygyPtwist[pos[i]]]
+	}
+	idx *= encoding.factor[0]
+
+	// Pawns of the other color.
+	i := t.pawns[0]
+	end := i + t.pawns[1]
+	if end > i {
+		for j := i; j < end; j++ {
+			for k := j + 1; k < end; k++ {
+				if pos[j] > pos[k] {
+					pos[j], pos[k] = pos[k], pos[j]
+				}
+			}
+		}
+		s := uint64(0)
+		for m := i; m < end; m++ {
+			p := pos[m]
+			j := 0
+			for k := 0; k < i; k++ {
+				if p > pos[k] {
+					j++
+				}
+			}
+			s += syzygyBinomial[m-i][p-j-8]
+		}
+		idx += s * encoding.factor[i]
+		i = end
+	}
+
+	return t.encodeRemaining(encoding, pos, idx, i)
+}
+
+// Adds the groups of equal pieces starting at index `i` to the index.
+func (t *syzygyTable) encodeRemaining(encoding *syzygyEncoding, pos *[SyzygyMaxPieces]int, idx uint64, i int) uint64 {
+	for i < t.num {
+		n := encoding.norm[i]
+		for j := i; j < i+n; j++ {
+			for k := j + 1; k < i+n; k++ {
+				if pos[j] > pos[k] {
+					pos[j], pos[k] = pos[k], pos[j]
+				}
+			}
+		}
+
+		s := uint64(0)
+		for m := i; m < i+n; m++ {
+			p := pos[m]
+			j := 0
+			for l := 0; l < i; l++ {
+				if p > pos[l] {
+					j++
+				}
+			}
+			s += syzygyBinomial[m-i][p-j]
+		}
+		idx += s * encoding.factor[i]
+		i += n
+	}
+
+	return idx
+}
+
+// Probes the WDL value of the position, ignoring captures.
+func (t *syzygyTable) probeWdl(b *Bitboard) (int, error) {
+	if err := t.init(); err != nil {
+		return 0, err
+	}
+
+	side, cmirror, mirror := t.orientation(b)
+	encoding, _, idx, err := t.index(b, side, cmirror, mirror)
+	if err != nil {
+		return 0, err
+	}
+	if encoding.pairs == nil {
+		return 0, fmt.Errorf("position does not match syzygy table: '%s'.", t.path)
+	}
+
+	value, err := t.decompress(encoding.pairs, idx)
+	if err != nil {
+		return 0, err
+	}
+	return value - 2, nil
+}
+
+// Probes the DTZ value of the position, ignoring captures. The second
+// return value is false if the table only stores the other side to move.
+func (t *syzygyTable) probeDtz(b *Bitboard, wdl int) (int, bool, error) {
+	if err := t.init(); err != nil {
+		return 0, false, err
+	}
+
+	side, cmirror, mirror := t.orientation(b)
+	if !t.hasPawns && int(t.flags[0]&0x01) != side && !t.symmetric {
+		return 0, false, nil
+	}
+
+	encoding, file, idx, err := t.index(b, 0, cmirror, mirror)
+	if err != nil {
+		return 0, false, err
+	}
+	if t.hasPawns && int(t.flags[file]&0x01) != side {
+		return 0, false, nil
+	}
+
+	value, err := t.decompress(encoding.pairs, idx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if t.flags[file]&0x02 != 0 {
+		mapped, err := t.readByte(t.mapOffset + t.mapIdx[file][syzygyWdlToMap[wdl+2]] + int64(value))
+		if err != nil {
+			return 0, false, err
+		}
+		value = int(mapped)
+	}
+
+	if t.flags[file]&syzygyPaFlags[wdl+2] == 0 || wdl&1 != 0 {
+		value *= 2
+	}
+
+	return value, true, nil
+}
+
+func (t *syzygyTable) close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	t.initialized = false
+	return err
+}
+
+// Probes Syzygy endgame tablebases.
+//
+// WDL tables (`.rtbw`) tell if a position is won, drawn or lost. DTZ tables
+// (`.rtbz`) give the distance to the next capture or pawn move (zeroing
+// the halfmove clock) with optimal play. Tables are opened lazily on first
+// use and read from disk as needed, so adding large directories is cheap.
+//
+//     tablebase, _ := chess.OpenSyzygy("data/syzygy")
+//     defer tablebase.Close()
+//
+//     board := chess.NewBitboard("8/8/8/4k3/8/8/8/KR6 w - - 0 1")
+//     wdl, err := tablebase.ProbeWDL(board) // 2
+//
+// Probing pushes and pops moves on the given board, which is left
+// unchanged afterwards. A board must not be probed from multiple
+// goroutines at the same time, but the tablebase can be shared.
+type Syzygy struct {
+	mutex     sync.RWMutex
+	wdl       map[string]*syzygyTable
+	dtz       map[string]*syzygyTable
+	maxPieces int
+}
+
+// Opens the Syzygy tables in the given directory.
+func OpenSyzygy(directory string) (*Syzygy, error) {
+	s := &Syzygy{wdl: map[string]*syzygyTable{}, dtz: map[string]*syzygyTable{}}
+	if _, err := s.AddDirectory(directory); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Adds the tables in the given directory. Files with other names are
+// ignored. Returns the number of tables found.
+func (s *Syzygy) AddDirectory(directory string) (int, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if !syzygyTableNameRegex.MatchString(name) || len(name)-1 > SyzygyMaxPieces {
+			continue
+		}
+
+		tables := s.wdl
+		if ext == ".rtbz" {
+			tables = s.dtz
+		} else if ext != ".rtbw" {
+			continue
+		}
+
+		table := newSyzygyTable(filepath.Join(directory, entry.Name()), ext == ".rtbz")
+		if old, ok := tables[table.key]; ok {
+			old.close()
+		}
+		tables[table.key] = table
+		tables[table.mirroredKey] = table
+		if table.num > s.maxPieces {
+			s.maxPieces = table.num
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Gets the largest number of pieces of the available tables.
+func (s *Syzygy) MaxPieces() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.maxPieces
+}
+
+// Closes all open table files.
+func (s *Syzygy) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var result error
+	for _, tables := range []map[string]*syzygyTable{s.wdl, s.dtz} {
+		for _, table := range tables {
+			if err := table.close(); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+// Checks if the position can be in the tables.
+func (s *Syzygy) checkPosition(b *Bitboard) error {
+	if b.variant != Standard {
+		return fmt.Errorf("syzygy tables do not support %s: '%s'.", b.variant.Name(), b.Fen())
+	}
+	if b.castlingRights != CastlingNone {
+		return fmt.Errorf("syzygy tables do not contain positions with castling rights: '%s'.", b.Fen())
+	}
+	if popCount(b.occupied) > s.MaxPieces() {
+		return fmt.Errorf("syzygy tables with %d pieces are not available: '%s'.", popCount(b.occupied), b.Fen())
+	}
+	return nil
+}
+
+func (s *Syzygy) table(b *Bitboard, dtz bool) (*syzygyTable, error) {
+	key := syzygyKey(b, false)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tables, kind := s.wdl, "wdl"
+	if dtz {
+		tables, kind = s.dtz, "dtz"
+	}
+	table, ok := tables[key]
+	if !ok {
+		return nil, fmt.Errorf("did not find syzygy %s table for %s.", kind, key)
+	}
+	return table, nil
+}
+
+// Probes the WDL tables for the win/draw/loss information of the position
+// from the point of view of the side to move:
+//
+//     -2: loss
+//     -1: loss, but draw under the 50-move rule (blessed loss)
+//      0: draw
+//      1: win, but draw under the 50-move rule (cursed win)
+//      2: win
+//
+// Returns an error if the position has castling rights, too many pieces or
+// a needed table is missing.
+func (s *Syzygy) ProbeWDL(board *Bitboard) (int, error) {
+	if err := s.checkPosition(board); err != nil {
+		return 0, err
+	}
+	return s.probeWdl(board)
+}
+
+func (s *Syzygy) probeWdl(b *Bitboard) (int, error) {
+	v, _, err := s.probeAlphaBeta(b, -2, 2)
+	if err != nil || b.epSquare == 0 {
+		return v, err
+	}
+
+	// Now handle en-passant, which the tables do not know about.
+	v1 := -3
+	moves := b.GenerateLegalMoves(true, true, true, true, true, true, true)
+	for _, move := range moves {
+		if !b.IsEnPassant(move) {
+			continue
+		}
+
+		b.Push(move)
+		v0, _, err := s.probeAlphaBeta(b, -2, 2)
+		b.Pop()
+		if err != nil {
+			return 0, err
+		}
+
+		if -v0 > v1 {
+			v1 = -v0
+		}
+	}
+
+	if v1 > -3 {
+		if v1 >= v {
+			v = v1
+		} else if v == 0 && s.onlyEnPassant(b, moves) {
+			// Forced to play the losing en-passant capture.
+			v = v1
+		}
+	}
+
+	return v, nil
+}
+
+// Checks if all the given legal moves are en-passant captures.
+func (s *Syzygy) onlyEnPassant(b *Bitboard, moves []*Move) bool {
+	for _, move := range moves {
+		if !b.IsEnPassant(move) {
+			return false
+		}
+	}
+	return true
+}
+
+// Searches all captures but en-passant, since the tables only contain
+// positions where the best move is not a capture. The second return value
+// is 2 if the value comes from a capture that is at least as good as
+// `beta`, 1 otherwise.
+func (s *Syzygy) probeAlphaBeta(b *Bitboard, alpha, beta int) (int, int, error) {
+	for _, move := range b.GenerateLegalMoves(true, true, true, true, true, true, true) {
+		if b.occupiedCo[b.turn^1]&BBSquares[move.toSquare] == 0 {
+			continue
+		}
+
+		b.Push(move)
+		v, _, err := s.probeAlphaBeta(b, -beta, -alpha)
+		b.Pop()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if -v > alpha {
+			if -v >= beta {
+				return -v, 2, nil
+			}
+			alpha = -v
+		}
+	}
+
+	v, err := s.probeWdlTable(b)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if alpha >= v {
+		if alpha > 0 {
+			return alpha, 2, nil
+		}
+		return alpha, 1, nil
+	}
+	return v, 1, nil
+}
+
+func (s *Syzygy) probeWdlTable(b *Bitboard) (int, error) {
+	// Two bare kings are a draw.
+	if b.kings == b.occupied {
+		return 0, nil
+	}
+
+	table, err := s.table(b, false)
+	if err != nil {
+		return 0, err
+	}
+	return table.probeWdl(b)
+}
+
+// Probes the DTZ tables for the distance to zeroing the halfmove clock
+// with optimal play, from the point of view of the side to move. The value
+// is positive for wins and negative for losses, `0` for draws. Values with
+// an absolute value above 100 are cursed wins or blessed losses, which are
+// drawn under the 50-move rule.
+//
+// Wins are rounded up by one and losses may be off by one, since the
+// tables do not always store the exact value. A DTZ of `n` can mean `n` or
+// `n + 1` plies.
+//
+// Returns an error if the position has castling rights, too many pieces or
+// a needed table is missing.
+func (s *Syzygy) ProbeDTZ(board *Bitboard) (int, error) {
+	if err := s.checkPosition(board); err != nil {
+		return 0, err
+	}
+	return s.probeDtz(board)
+}
+
+func (s *Syzygy) probeDtz(b *Bitboard) (int, error) {
+	v, err := s.probeDtzNoEnPassant(b)
+	if err != nil || b.epSquare == 0 {
+		return v, err
+	}
+
+	v1 := -3
+	moves := b.GenerateLegalMoves(true, true, true, true, true, true, true)
+	for _, move := range moves {
+		if !b.IsEnPassant(move) {
+			continue
+		}
+
+		b.Push(move)
+		v0, _, err := s.probeAlphaBeta(b, -2, 2)
+		b.Pop()
+		if err != nil {
+			return 0, err
+		}
+
+		if -v0 > v1 {
+			v1 = -v0
+		}
+	}
+
+	if v1 > -3 {
+		v1 = syzygyWdlToDtz[v1+2]
+		if v < -100 {
+			if v1 >= 0 {
+				v = v1
+			}
+		} else if v < 0 {
+			if v1 >= 0 || v1 < -100 {
+				v = v1
+			}
+		} else if v > 100 {
+			if v1 > 0 {
+				v = v1
+			}
+		} else if v > 0 {
+			if v1 == 1 {
+				v = v1
+			}
+		} else if v1 >= 0 {
+			v = v1
+		} else if s.onlyEnPassant(b, moves) {
+			v = v1
+		}
+	}
+
+	return v, nil
+}
+
+func (s *Syzygy) probeDtzNoEnPassant(b *Bitboard) (int, error) {
+	wdl, success, err := s.probeAlphaBeta(b, -2, 2)
+	if err != nil || wdl == 0 {
+		return 0, err
+	}
+
+	// A capture is the best move.
+	if success == 2 {
+		if wdl == 2 {
+			return 1, nil
+		}
+		return 101, nil
+	}
+
+	moves := b.GenerateLegalMoves(true, true, true, true, true, true, true)
+
+	if wdl > 0 {
+		// A pawn move that keeps the value zeroes the halfmove clock.
+		for _, move := range moves {
+			if b.pieces[move.fromSquare] != Pawn || b.IsCapture(move) {
+				continue
+			}
+
+			b.Push(move)
+			v, err := s.probeWdl(b)
+			b.Pop()
+			if err != nil {
+				return 0, err
+			}
+
+			if -v == wdl {
+				if wdl == 2 {
+					return 1, nil
+				}
+				return 101, nil
+			}
+		}
+	}
+
+	table, err := s.table(b, true)
+	if err != nil {
+		return 0, err
+	}
+	dtz, ok, err := table.probeDtz(b, wdl)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		dtz++
+		if wdl&1 != 0 {
+			dtz += 100
+		}
+		if wdl >= 0 {
+			return dtz, nil
+		}
+		return -dtz, nil
+	}
+
+	// The table only has the other side to move, so look one move ahead.
+	if wdl > 0 {
+		best := 0xffff
+		for _, move := range moves {
+			if b.pieces[move.fromSquare] == Pawn || b.IsCapture(move) {
+				continue
+			}
+
+			b.Push(move)
+			v, err := s.probeDtz(b)
+			mate := -v == 1 && b.IsCheckmate()
+			b.Pop()
+			if err != nil {
+				return 0, err
+			}
+
+			if mate {
+				best = 1
+			} else if -v > 0 && -v+1 < best {
+				best = -v + 1
+			}
+		}
+		return best, nil
+	}
+
+	best := -1
+	for _, move := range moves {
+		var v int
+
+		b.Push(move)
+		if b.halfMoveClock == 0 {
+			if wdl == -2 {
+				v = -1
+			} else {
+				v, _, err = s.probeAlphaBeta(b, 1, 2)
+				if v == 2 {
+					v = 0
+				} else {
+					v = -101
+				}
+			}
+		} else {
+			v, err = s.probeDtz(b)
+			v = -v - 1
+		}
+		b.Pop()
+		if err != nil {
+			return 0, err
+		}
+
+		if v < best {
+			best = v
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,288 @@
+package chess
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Opens the Syzygy tables from `$SYZYGY_PATH` or `data/syzygy`. The test is
+// skipped unless both the WDL and the DTZ table of each of the given
+// material configurations are there. On CI, where `$CI` is set, missing
+// tables fail the test instead, so that the probing code does not go
+// untested unnoticed.
+func openTestSyzygy(t *testing.T, names ...string) *Syzygy {
+	directory := os.Getenv("SYZYGY_PATH")
+	if directory == "" {
+		directory = filepath.Join("data", "syzygy")
+	}
+
+	for _, name := range names {
+		for _, ext := range []string{".rtbw", ".rtbz"} {
+			if _, err := os.Stat(filepath.Join(directory, name+ext)); err != nil {
+				if os.Getenv("CI") != "" {
+					t.Fatalf("syzygy table %s%s not found in %s, set $SYZYGY_PATH", name, ext, directory)
+				}
+				t.Skipf("syzygy table %s%s not found in %s", name, ext, directory)
+			}
+		}
+	}
+
+	tablebase, err := OpenSyzygy(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tablebase.Close() })
+	return tablebase
+}
+
+// Checks that the WDL and the DTZ value agree: zero for draws, the same
+// sign otherwise and an absolute value above 100 exactly for cursed wins
+// and blessed losses.
+func checkSyzygyDtz(t *testing.T, fen string, wdl, dtz int) {
+	t.Helper()
+
+	switch {
+	case wdl == 0 && dtz != 0,
+		wdl == 2 && (dtz < 1 || dtz > 100),
+		wdl == -2 && (dtz > -1 || dtz < -100),
+		wdl == 1 && dtz <= 100,
+		wdl == -1 && dtz >= -100:
+		t.Errorf("%s: dtz %d does not match wdl %d", fen, dtz, wdl)
+	}
+}
+
+func TestSyzygyAddDirectory(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz", "KRPvKR.rtbw", "KQvK.txt", "README", "kqvk.rtbw", "KQQQQQQvK.rtbw"} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte("not a table"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tablebase, err := OpenSyzygy(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tablebase.Close()
+
+	if maxPieces := tablebase.MaxPieces(); maxPieces != 5 {
+		t.Errorf("expected at most 5 pieces, got %d", maxPieces)
+	}
+	if count, err := tablebase.AddDirectory(directory); err != nil || count != 3 {
+		t.Errorf("expected 3 tables, got %d (%v)", count, err)
+	}
+
+	// Two bare kings do not need a table.
+	if wdl, err := tablebase.ProbeWDL(NewBitboard("8/8/8/4k3/8/8/8/4K3 w - - 0 1")); err != nil || wdl != 0 {
+		t.Errorf("expected a draw with bare kings, got %d (%v)", wdl, err)
+	}
+
+	errors := []struct {
+		board   *Bitboard
+		message string
+	}{
+		{NewBitboard("8/8/8/4k3/8/8/8/4K2Q w - - 0 1"), "invalid magic header"},
+		{NewBitboard("8/8/8/4k3/8/8/8/4K2R w - - 0 1"), "did not find syzygy wdl table for KRvK"},
+		{NewBitboard("4k3/8/8/8/8/8/8/4K2R w K - 0 1"), "castling rights"},
+		{NewBitboard("4k3/8/8/8/8/8/2PPP3/3QK3 w - - 0 1"), "tables with 6 pieces"},
+		{NewVariantBitboard(Atomic, "8/8/8/4k3/8/8/8/4K2Q w - - 0 1"), "do not support"},
+	}
+	for _, test := range errors {
+		if _, err := tablebase.ProbeWDL(test.board); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing '%s', got %v", test.board.Fen(), test.message, err)
+		}
+	}
+}
+
+func TestSyzygyKey(t *testing.T) {
+	board := NewBitboard("8/8/3r4/4k3/8/2P5/1B6/4K2R w - - 0 1")
+	if key := syzygyKey(board, false); key != "KRBPvKR" {
+		t.Errorf("expected KRBPvKR, got %s", key)
+	}
+	if key := syzygyKey(board, true); key != "KRvKRBP" {
+		t.Errorf("expected KRvKRBP, got %s", key)
+	}
+	if name := syzygyMirrorName("KRBPvKR"); name != "KRvKRBP" {
+		t.Errorf("expected KRvKRBP, got %s", name)
+	}
+}
+
+func TestSyzygyProbe(t *testing.T) {
+	tablebase := openTestSyzygy(t, "KQvK", "KRvK", "KPvK", "KBvK", "KNvK")
+
+	tests := []struct {
+		fen string
+		wdl int
+		dtz int
+	}{
+		// Won and lost with the rook, also with the colors swapped.
+		{"8/8/8/4k3/8/8/8/KR6 w - - 0 1", 2, 0},
+		{"8/8/8/4k3/8/8/8/KR6 b - - 0 1", -2, 0},
+		{"kr6/8/8/8/4K3/8/8/8 b - - 0 1", 2, 0},
+		// Stalemate.
+		{"k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", 0, 0},
+		// Black saves the draw by taking the queen.
+		{"7K/8/8/8/8/8/3Q4/4k3 b - - 0 1", 0, 0},
+		// Promotion zeroes the halfmove clock right away.
+		{"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", 2, 1},
+		{"8/4P3/8/8/8/8/k7/4K3 b - - 0 1", -2, 0},
+		// Rook pawn with the defending king in the corner.
+		{"k7/8/8/8/8/8/P7/K7 w - - 0 1", 0, 0},
+	}
+
+	for _, test := range tests {
+		board := NewBitboard(test.fen)
+
+		wdl, err := tablebase.ProbeWDL(board)
+		if err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+			continue
+		}
+		if wdl != test.wdl {
+			t.Errorf("%s: expected wdl %d, got %d", test.fen, test.wdl, wdl)
+		}
+
+		dtz, err := tablebase.ProbeDTZ(board)
+		if err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+			continue
+		}
+		if test.dtz != 0 && dtz != test.dtz {
+			t.Errorf("%s: expected dtz %d, got %d", test.fen, test.dtz, dtz)
+		}
+		checkSyzygyDtz(t, test.fen, wdl, dtz)
+
+		if board.Fen() != test.fen {
+			t.Errorf("%s: board changed to '%s'", test.fen, board.Fen())
+		}
+	}
+}
+
+// Checks the decoded values of all positions with the white king on a few
+// squares against the values of their successors: the side to move gets
+// the best value of its moves.
+func TestSyzygyConsistency(t *testing.T) {
+	tablebase := openTestSyzygy(t, "KQvK", "KRvK", "KPvK", "KBvK", "KNvK")
+
+	kingSquares := []int{A1, B1, C3, D4}
+	if testing.Short() {
+		kingSquares = kingSquares[:1]
+	}
+
+	board := NewBitboard("")
+	for _, pieceType := range []PieceTypes{Queen, Rook, Pawn} {
+		for _, kingSquare := range kingSquares {
+			for pieceSquare := range Squares {
+				for otherKingSquare := range Squares {
+					for _, turn := range []Colors{White, Black} {
+						if pieceSquare == kingSquare || otherKingSquare == kingSquare || otherKingSquare == pieceSquare {
+							continue
+						}
+
+						board.Clear()
+						board.SetPieceAt(kingSquare, NewPiece(King, White))
+						board.SetPieceAt(pieceSquare, NewPiece(pieceType, White))
+						board.SetPieceAt(otherKingSquare, NewPiece(King, Black))
+						board.turn = turn
+						if board.Status() != StatusValid {
+							continue
+						}
+
+						checkSyzygyPosition(t, tablebase, board)
+					}
+				}
+			}
+		}
+	}
+}
+
+func checkSyzygyPosition(t *testing.T, tablebase *Syzygy, board *Bitboard) {
+	t.Helper()
+	fen := board.Fen()
+
+	wdl, err := tablebase.ProbeWDL(board)
+	if err != nil {
+		t.Fatalf("%s: %s", fen, err)
+	}
+	dtz, err := tablebase.ProbeDTZ(board)
+	if err != nil {
+		t.Fatalf("%s: %s", fen, err)
+	}
+	checkSyzygyDtz(t, fen, wdl, dtz)
+
+	best := -2
+	moves := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+	if len(moves) == 0 && !board.IsCheck() {
+		best = 0
+	}
+	for _, move := range moves {
+		board.Push(move)
+		v, err := tablebase.ProbeWDL(board)
+		board.Pop()
+		if err != nil {
+			t.Fatalf("%s %s: %s", fen, move.Uci(), err)
+		}
+		if -v > best {
+			best = -v
+		}
+	}
+
+	if wdl != best {
+		t.Errorf("%s: wdl %d, but the best move leads to %d", fen, wdl, best)
+	}
+}
+
+func TestSyzygyEnPassant(t *testing.T) {
+	tablebase := openTestSyzygy(t, "KPvKP", "KPvK")
+
+	// Taking en passant wins, otherwise black catches the pawn.
+	fen := "8/8/8/k2Pp3/8/8/8/4K3 w - e6 0 2"
+	board := NewBitboard(fen)
+	withoutEp := NewBitboard("8/8/8/k2Pp3/8/8/8/4K3 w - - 0 2")
+
+	if wdl, err := tablebase.ProbeWDL(withoutEp); err != nil || wdl != 0 {
+		t.Errorf("expected a draw without en passant, got %d (%v)", wdl, err)
+	}
+	if wdl, err := tablebase.ProbeWDL(board); err != nil || wdl != 2 {
+		t.Errorf("expected a win with en passant, got %d (%v)", wdl, err)
+	}
+
+	// The tables do not know about the en passant capture.
+	if dtz, err := tablebase.probeDtzNoEnPassant(board); err != nil || dtz != 0 {
+		t.Errorf("expected dtz 0 ignoring en passant, got %d (%v)", dtz, err)
+	}
+	if dtz, err := tablebase.ProbeDTZ(board); err != nil || dtz != 1 {
+		t.Errorf("expected dtz 1 with en passant, got %d (%v)", dtz, err)
+	}
+
+	if board.Fen() != fen {
+		t.Errorf("board changed to '%s'", board.Fen())
+	}
+}
+
+// The example from the python-chess documentation.
+func TestSyzygyKBNvK(t *testing.T) {
+	tablebase := openTestSyzygy(t, "KBNvK", "KBvK", "KNvK")
+
+	board := NewBitboard("8/2K5/4B3/3N4/8/8/4k3/8 b - - 0 1")
+	if wdl, err := tablebase.ProbeWDL(board); err != nil || wdl != -2 {
+		t.Errorf("expected wdl -2, got %d (%v)", wdl, err)
+	}
+	if dtz, err := tablebase.ProbeDTZ(board); err != nil || dtz != -53 {
+		t.Errorf("expected dtz -53, got %d (%v)", dtz, err)
+	}
+}
+
+// The values used when a capture or pawn move decides the game, including
+// cursed wins and blessed losses.
+func TestSyzygyWdlToDtz(t *testing.T) {
+	for wdl := -2; wdl <= 2; wdl++ {
+		dtz := syzygyWdlToDtz[wdl+2]
+		checkSyzygyDtz(t, "", wdl, dtz)
+		if wdl != 0 && dtz != 1 && dtz != -1 && dtz != 101 && dtz != -101 {
+			t.Errorf("unexpected dtz %d for wdl %d", dtz, wdl)
+		}
+	}
+}
@@ -0,0 +1,566 @@
+// Package uci communicates with chess engines speaking the Universal Chess
+// Interface protocol.
+//
+//     engine, _ := uci.Popen("stockfish")
+//     engine.Uci()
+//     engine.IsReady()
+//
+//     board := chess.NewBitboard("")
+//     engine.Position(board)
+//     bestMove, ponder, _ := engine.Go(&uci.Limits{MoveTime: time.Second})
+//
+//     engine.Quit()
+//
+// The package can also serve a search function as an engine, see `Server`.
+package uci
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// The time to wait for an engine to answer `uci` or `isready` before
+// giving up.
+var HandshakeTimeout = 10 * time.Second
+
+// An option declared by the engine with `option name ... type ...`.
+//
+// `Min` and `Max` are only meaningful for `spin` options and `Var` only for
+// `combo` options.
+type Option struct {
+	Name    string
+	Type    string
+	Default string
+	Min     int
+	Max     int
+	Var     []string
+}
+
+// Limits for a search started with `Go()`. Zero values are not sent to the
+// engine. If no limit is set at all the engine is asked to search
+// `infinite`ly and has to be stopped.
+//
+// `PonderHit` is only set by `Server` for searches in ponder mode. It is
+// closed when the GUI sends `ponderhit`, from when on the search continues
+// under the given time control.
+type Limits struct {
+	SearchMoves []*chess.Move
+	Ponder      bool
+	WhiteTime   time.Duration
+	BlackTime   time.Duration
+	WhiteInc    time.Duration
+	BlackInc    time.Duration
+	MovesToGo   int
+	Depth       int
+	Nodes       int
+	Mate        int
+	MoveTime    time.Duration
+	Infinite    bool
+	PonderHit   <-chan struct{}
+}
+
+// An engine process (or anything else speaking UCI).
+type Engine struct {
+	Name    string
+	Author  string
+	Options map[string]*Option
+
+	cmd    *exec.Cmd
+	writer io.Writer
+	lines  chan string
+	err    error
+
+	// The position last sent to the engine, used to validate principal
+	// variations.
+	board *chess.Bitboard
+
+	// Whether `UCI_Chess960` has been switched on and the current value of
+	// `UCI_Variant`.
+	chess960 bool
+	variant  chess.Variant
+
+	mu sync.Mutex
+}
+
+// Starts the given engine executable and connects to its standard input
+// and output. The `uci` handshake is not performed.
+func Popen(command string, args ...string) (*Engine, error) {
+	cmd := exec.Command(command, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	engine := NewEngine(stdout, stdin)
+	engine.cmd = cmd
+	return engine, nil
+}
+
+// Creates an engine communicating over the given reader and writer. This is
+// useful for engines that are not local processes.
+func NewEngine(reader io.Reader, writer io.Writer) *Engine {
+	engine := &Engine{
+		Options: map[string]*Option{},
+		writer:  writer,
+		lines:   make(chan string, 64),
+		variant: chess.Standard,
+	}
+
+	go engine.readLines(reader)
+
+	return engine
+}
+
+func (e *Engine) readLines(reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e.lines <- strings.TrimRight(scanner.Text(), "\r")
+	}
+
+	e.err = scanner.Err()
+	if e.err == nil {
+		e.err = io.EOF
+	}
+	close(e.lines)
+}
+
+// Sends a raw command line to the engine.
+func (e *Engine) Send(command string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := io.WriteString(e.writer, command+"\n")
+	return err
+}
+
+// Reads the next line from the engine. A timeout of zero waits forever.
+func (e *Engine) readLine(timeout time.Duration) (string, error) {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case line, ok := <-e.lines:
+		if !ok {
+			return "", e.err
+		}
+		return line, nil
+	case <-timer:
+		return "", fmt.Errorf("engine did not respond within %s.", timeout)
+	}
+}
+
+// Performs the `uci` handshake and records the engine name, author and
+// declared options.
+func (e *Engine) Uci() error {
+	if err := e.Send("uci"); err != nil {
+		return err
+	}
+
+	for {
+		line, err := e.readLine(HandshakeTimeout)
+		if err != nil {
+			return err
+		}
+
+		command, arg := splitCommand(line)
+		switch command {
+		case "id":
+			key, value := splitCommand(arg)
+			if key == "name" {
+				e.Name = value
+			} else if key == "author" {
+				e.Author = value
+			}
+		case "option":
+			if option := parseOption(arg); option != nil {
+				e.Options[option.Name] = option
+			}
+		case "uciok":
+			return nil
+		}
+	}
+}
+
+// Sends `isready` and waits for `readyok`.
+func (e *Engine) IsReady() error {
+	if err := e.Send("isready"); err != nil {
+		return err
+	}
+
+	for {
+		line, err := e.readLine(HandshakeTimeout)
+		if err != nil {
+			return err
+		}
+
+		if command, _ := splitCommand(line); command == "readyok" {
+			return nil
+		}
+	}
+}
+
+// Sets an option. Button options are triggered by passing an empty value.
+//
+// Returns an error if the engine did not declare the option.
+func (e *Engine) SetOption(name, value string) error {
+	option, ok := e.Options[name]
+	if !ok {
+		return fmt.Errorf("engine does not support option '%s'.", name)
+	}
+
+	if option.Type == "button" || value == "" {
+		return e.Send("setoption name " + option.Name)
+	}
+
+	return e.Send("setoption name " + option.Name + " value " + value)
+}
+
+// Tells the engine that the next position is from a different game.
+func (e *Engine) UciNewGame() error {
+	return e.Send("ucinewgame")
+}
+
+// Sends the position of the given board, including its move stack, so that
+// the engine can detect repetitions.
+//
+// If the engine has the `UCI_Chess960` option it is switched on and off to
+// match the board, so that castling moves are understood as king takes
+// rook in Chess960 mode. Likewise `UCI_Variant` is set to the variant of
+// the board. Engines without the option only play standard chess.
+func (e *Engine) Position(board *chess.Bitboard) error {
+	if _, ok := e.Options["UCI_Chess960"]; ok && board.IsChess960() != e.chess960 {
+		if err := e.SetOption("UCI_Chess960", strconv.FormatBool(board.IsChess960())); err != nil {
+			return err
+		}
+		e.chess960 = board.IsChess960()
+	}
+
+	if board.Variant() != e.variant {
+		if _, ok := e.Options["UCI_Variant"]; !ok {
+			return fmt.Errorf("engine does not support variants: '%s'.", board.Variant().Name())
+		}
+		if err := e.SetOption("UCI_Variant", board.Variant().UciName()); err != nil {
+			return err
+		}
+		e.variant = board.Variant()
+	}
+
+	moves := board.MoveStack()
+
+	// Rewind a copy to the starting position of the game, so that the
+	// board of the caller is left alone.
+	root := board.Copy(true)
+	for range moves {
+		root.Pop()
+	}
+	fen := root.Fen()
+
+	command := "position"
+	if fen == chess.StartingFen {
+		command += " startpos"
+	} else {
+		command += " fen " + fen
+	}
+
+	if len(moves) > 0 {
+		command += " moves"
+		for _, move := range moves {
+			command += " " + moveUci(root, move)
+			root.Push(move)
+		}
+	}
+
+	if err := e.Send(command); err != nil {
+		return err
+	}
+
+	e.board = board.Copy(false)
+	return nil
+}
+
+// Gets the UCI notation of a move that is legal in the given position.
+// Outside of Chess960 mode castling is always sent as the king moving two
+// squares, even if the move was made as king takes rook.
+func moveUci(board *chess.Bitboard, move *chess.Move) string {
+	if !board.IsChess960() {
+		if san := board.San(move); strings.HasPrefix(san, "O-O") {
+			if castling, err := board.ParseSan(strings.TrimRight(san, "+#")); err == nil {
+				return castling.Uci()
+			}
+		}
+	}
+	return move.Uci()
+}
+
+// Starts a search with the given limits and waits for the best move.
+//
+// `ponder` is nil if the engine did not suggest a move to ponder on.
+// `bestMove` is nil if the engine reported that there is no legal move.
+func (e *Engine) Go(limits *Limits) (bestMove, ponder *chess.Move, err error) {
+	search, err := e.Start(limits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return search.Wait()
+}
+
+// A search running in the background, started with `Engine.Start()`.
+//
+// Parsed `info` lines are delivered on the `Info` channel, which is closed
+// once the engine sent its best move. The engine stops sending output
+// until `Info` is drained, so callers either range over it or call
+// `Wait()`.
+//
+//     search, _ := engine.Start(&uci.Limits{Infinite: true})
+//     go func() {
+//         time.Sleep(5 * time.Second)
+//         search.Stop()
+//     }()
+//     for info := range search.Info {
+//         fmt.Println(info.Depth, info.Score.Cp, info.Pv)
+//     }
+//     bestMove, _, _ := search.Wait()
+type Search struct {
+	Info <-chan *Info
+
+	engine   *Engine
+	done     chan struct{}
+	bestMove *chess.Move
+	ponder   *chess.Move
+	err      error
+}
+
+// Starts a search with the given limits without waiting for it to finish.
+func (e *Engine) Start(limits *Limits) (*Search, error) {
+	if err := e.Send(goCommand(limits)); err != nil {
+		return nil, err
+	}
+
+	info := make(chan *Info, 16)
+	search := &Search{
+		Info:   info,
+		engine: e,
+		done:   make(chan struct{}),
+	}
+
+	var board *chess.Bitboard
+	if e.board != nil {
+		board = e.board.Copy(false)
+	}
+
+	go func() {
+		defer close(search.done)
+		defer close(info)
+
+		for {
+			line, err := e.readLine(0)
+			if err != nil {
+				search.err = err
+				return
+			}
+
+			command, arg := splitCommand(line)
+			if command == "info" {
+				info <- ParseInfo(arg, board)
+			} else if command == "bestmove" {
+				search.bestMove, search.ponder = parseBestMove(arg)
+				return
+			}
+		}
+	}()
+
+	return search, nil
+}
+
+// Asks the engine to stop searching as soon as possible. The engine still
+// sends its best move, which can be obtained with `Wait()`.
+func (s *Search) Stop() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		return s.engine.Send("stop")
+	}
+}
+
+// Waits for the search to finish and returns the best move and the move to
+// ponder on. Remaining `info` lines are discarded.
+func (s *Search) Wait() (bestMove, ponder *chess.Move, err error) {
+	for range s.Info {
+	}
+	<-s.done
+
+	return s.bestMove, s.ponder, s.err
+}
+
+// Asks the engine to quit and waits for the process to exit.
+func (e *Engine) Quit() error {
+	if err := e.Send("quit"); err != nil {
+		return err
+	}
+
+	if closer, ok := e.writer.(io.Closer); ok {
+		closer.Close()
+	}
+
+	if e.cmd != nil {
+		return e.cmd.Wait()
+	}
+
+	return nil
+}
+
+// Builds the `go` command for the given limits.
+func goCommand(limits *Limits) string {
+	if limits == nil {
+		limits = &Limits{}
+	}
+
+	command := "go"
+
+	if limits.Ponder {
+		command += " ponder"
+	}
+	if limits.WhiteTime > 0 {
+		command += " wtime " + formatMilliseconds(limits.WhiteTime)
+	}
+	if limits.BlackTime > 0 {
+		command += " btime " + formatMilliseconds(limits.BlackTime)
+	}
+	if limits.WhiteInc > 0 {
+		command += " winc " + formatMilliseconds(limits.WhiteInc)
+	}
+	if limits.BlackInc > 0 {
+		command += " binc " + formatMilliseconds(limits.BlackInc)
+	}
+	if limits.MovesToGo > 0 {
+		command += " movestogo " + strconv.Itoa(limits.MovesToGo)
+	}
+	if limits.Depth > 0 {
+		command += " depth " + strconv.Itoa(limits.Depth)
+	}
+	if limits.Nodes > 0 {
+		command += " nodes " + strconv.Itoa(limits.Nodes)
+	}
+	if limits.Mate > 0 {
+		command += " mate " + strconv.Itoa(limits.Mate)
+	}
+	if limits.MoveTime > 0 {
+		command += " movetime " + formatMilliseconds(limits.MoveTime)
+	}
+
+	if limits.Infinite || command == "go" || command == "go ponder" {
+		command += " infinite"
+	}
+
+	if len(limits.SearchMoves) > 0 {
+		command += " searchmoves"
+		for _, move := range limits.SearchMoves {
+			command += " " + move.Uci()
+		}
+	}
+
+	return command
+}
+
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Millisecond), 10)
+}
+
+// Splits a line into the first token and the rest.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	index := strings.IndexAny(line, " \t")
+	if index == -1 {
+		return line, ""
+	}
+	return line[:index], strings.TrimSpace(line[index+1:])
+}
+
+// Parses the arguments of a `bestmove` command.
+func parseBestMove(arg string) (bestMove, ponder *chess.Move) {
+	tokens := strings.Fields(arg)
+	if len(tokens) > 0 && tokens[0] != "(none)" {
+		bestMove = chess.MoveFromUci(tokens[0])
+	}
+	if len(tokens) > 2 && tokens[1] == "ponder" && tokens[2] != "(none)" {
+		ponder = chess.MoveFromUci(tokens[2])
+	}
+	return bestMove, ponder
+}
+
+// Parses the arguments of an `option` command.
+//
+// Option names and values may contain spaces, so everything up to the next
+// keyword belongs to the current field.
+func parseOption(arg string) *Option {
+	option := &Option{}
+	current := ""
+	values := []string{}
+
+	flush := func() {
+		value := strings.Join(values, " ")
+		switch current {
+		case "name":
+			option.Name = value
+		case "type":
+			option.Type = value
+		case "default":
+			option.Default = value
+		case "min":
+			option.Min, _ = strconv.Atoi(value)
+		case "max":
+			option.Max, _ = strconv.Atoi(value)
+		case "var":
+			option.Var = append(option.Var, value)
+		}
+		values = values[:0]
+	}
+
+	for _, token := range strings.Fields(arg) {
+		switch token {
+		case "name", "type", "default", "min", "max", "var":
+			// Option names may contain keywords, so only the type ends
+			// the name.
+			if current == "name" && token != "type" {
+				values = append(values, token)
+				continue
+			}
+			flush()
+			current = token
+		default:
+			values = append(values, token)
+		}
+	}
+	flush()
+
+	if option.Name == "" {
+		return nil
+	}
+
+	return option
+}
@@ -0,0 +1,309 @@
+package uci
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// The test binary doubles as a fake engine when started with this argument.
+const fakeEngineArg = "-fake-engine"
+
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == fakeEngineArg {
+		fakeEngine()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// A minimal UCI engine. It plays the first legal move, answers with the
+// value of the `Hash` option as its score and echoes the last `position`
+// command as an info string.
+func fakeEngine() {
+	hash := 16
+	board := chess.NewBitboard(chess.StartingFen)
+	position := ""
+
+	bestMove := func() {
+		moves := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+		if len(moves) == 0 {
+			fmt.Println("bestmove (none)")
+			return
+		}
+		pv := moves[0].Uci()
+		line := "bestmove " + pv
+
+		board.Push(moves[0])
+		if replies := board.GenerateLegalMoves(true, true, true, true, true, true, true); len(replies) > 0 {
+			pv += " " + replies[0].Uci()
+			line += " ponder " + replies[0].Uci()
+		}
+		board.Pop()
+
+		fmt.Println("info string " + position)
+		fmt.Printf("info depth 1 seldepth 2 nodes 20 score cp %d pv %s\n", hash, pv)
+		fmt.Println(line)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		command, arg := splitCommand(line)
+		switch command {
+		case "uci":
+			fmt.Println("id name Fake Engine")
+			fmt.Println("id author chess.go")
+			fmt.Println("option name Hash type spin default 16 min 1 max 1024")
+			fmt.Println("option name Clear Hash type button")
+			fmt.Println("option name Style type combo default Normal var Solid var Normal var Risky")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "setoption":
+			tokens := strings.Fields(arg)
+			if len(tokens) == 4 && tokens[1] == "Hash" {
+				hash, _ = strconv.Atoi(tokens[3])
+			}
+		case "position":
+			position = line
+			tokens := strings.Fields(arg)
+			fen := chess.StartingFen
+			if tokens[0] == "fen" {
+				fen = strings.Join(tokens[1:7], " ")
+				tokens = tokens[7:]
+			} else {
+				tokens = tokens[1:]
+			}
+			board = chess.NewBitboard(fen)
+			if len(tokens) > 0 && tokens[0] == "moves" {
+				for _, uci := range tokens[1:] {
+					board.Push(chess.MoveFromUci(uci))
+				}
+			}
+		case "go":
+			if strings.Contains(arg, "infinite") {
+				for scanner.Scan() && strings.TrimSpace(scanner.Text()) != "stop" {
+				}
+			}
+			bestMove()
+		case "quit":
+			return
+		}
+	}
+}
+
+func startFakeEngine(t *testing.T) *Engine {
+	engine, err := Popen(os.Args[0], fakeEngineArg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Uci(); err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestUci(t *testing.T) {
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	if engine.Name != "Fake Engine" || engine.Author != "chess.go" {
+		t.Errorf("got name '%s' and author '%s'", engine.Name, engine.Author)
+	}
+
+	hash := engine.Options["Hash"]
+	if hash == nil || hash.Type != "spin" || hash.Default != "16" || hash.Min != 1 || hash.Max != 1024 {
+		t.Errorf("unexpected Hash option: %+v", hash)
+	}
+	if option := engine.Options["Clear Hash"]; option == nil || option.Type != "button" {
+		t.Errorf("unexpected Clear Hash option: %+v", option)
+	}
+	style := engine.Options["Style"]
+	if style == nil || style.Default != "Normal" || strings.Join(style.Var, ",") != "Solid,Normal,Risky" {
+		t.Errorf("unexpected Style option: %+v", style)
+	}
+
+	if err := engine.IsReady(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	if err := engine.SetOption("Threads", "4"); err == nil {
+		t.Error("expected an error for an undeclared option")
+	}
+	if err := engine.SetOption("Hash", "128"); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetOption("Clear Hash", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Position(chess.NewBitboard(chess.StartingFen)); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := engine.Start(&Limits{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var score *Score
+	for info := range search.Info {
+		if info.Score != nil {
+			score = info.Score
+		}
+	}
+	if score == nil || score.Cp != 128 {
+		t.Errorf("expected the engine to use the new hash size, got score %+v", score)
+	}
+}
+
+func TestGo(t *testing.T) {
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	board := chess.NewBitboard(chess.StartingFen)
+	for _, san := range []string{"e4", "e5", "Nf3"} {
+		if _, err := board.PushSan(san); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fen := board.Fen()
+
+	if err := engine.Position(board); err != nil {
+		t.Fatal(err)
+	}
+	if board.Fen() != fen || len(board.MoveStack()) != 3 {
+		t.Errorf("Position() changed the board: %s", board.Fen())
+	}
+
+	search, err := engine.Start(&Limits{WhiteTime: time.Minute, BlackTime: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infos []*Info
+	for info := range search.Info {
+		infos = append(infos, info)
+	}
+	bestMove, ponder, err := search.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 info lines, got %d", len(infos))
+	}
+	if infos[0].String != "position startpos moves e2e4 e7e5 g1f3" {
+		t.Errorf("unexpected position command: '%s'", infos[0].String)
+	}
+
+	info := infos[1]
+	if info.Depth != 1 || info.SelDepth != 2 || info.Nodes != 20 || info.Score == nil || info.Score.Cp != 16 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if len(info.Pv) != 2 || bestMove == nil || ponder == nil || !info.Pv[0].Equals(bestMove) || !info.Pv[1].Equals(ponder) {
+		t.Fatalf("principal variation %v does not match best move %v and ponder move %v", info.Pv, bestMove, ponder)
+	}
+
+	expected := board.GenerateLegalMoves(true, true, true, true, true, true, true)[0]
+	if !bestMove.Equals(expected) {
+		t.Errorf("expected best move %s, got %s", expected.Uci(), bestMove.Uci())
+	}
+}
+
+func TestGoFen(t *testing.T) {
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	tests := []struct {
+		chess960 bool
+		uci      string
+		expected string
+	}{
+		{false, "e1g1", "e1g1"},
+		// Castling made as king takes rook is still sent the usual way.
+		{false, "e1h1", "e1g1"},
+		{false, "e1c1", "e1c1"},
+		{false, "e1a1", "e1c1"},
+		{true, "e1h1", "e1h1"},
+	}
+
+	for _, test := range tests {
+		board := chess.NewBitboard(fen)
+		board.SetChess960(test.chess960)
+		board.Push(chess.MoveFromUci(test.uci))
+
+		if err := engine.Position(board); err != nil {
+			t.Fatal(err)
+		}
+
+		search, err := engine.Start(&Limits{Depth: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := <-search.Info
+		if info.String != "position fen "+fen+" moves "+test.expected {
+			t.Errorf("%s: unexpected position command: '%s'", test.uci, info.String)
+		}
+		if _, _, err := search.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStop(t *testing.T) {
+	engine := startFakeEngine(t)
+
+	if err := engine.Position(chess.NewBitboard(chess.StartingFen)); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := engine.Start(&Limits{Infinite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := search.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	bestMove, _, err := search.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bestMove == nil {
+		t.Error("expected a best move after stop")
+	}
+
+	if err := engine.Quit(); err != nil {
+		t.Errorf("engine did not exit cleanly: %s", err)
+	}
+}
+
+func TestGoCommand(t *testing.T) {
+	tests := []struct {
+		limits  *Limits
+		command string
+	}{
+		{nil, "go infinite"},
+		{&Limits{Ponder: true}, "go ponder infinite"},
+		{&Limits{Depth: 5, Nodes: 1000}, "go depth 5 nodes 1000"},
+		{&Limits{WhiteTime: time.Minute, BlackInc: 2 * time.Second, MovesToGo: 40}, "go wtime 60000 binc 2000 movestogo 40"},
+		{&Limits{MoveTime: 1500 * time.Millisecond, SearchMoves: []*chess.Move{chess.MoveFromUci("e2e4")}}, "go movetime 1500 searchmoves e2e4"},
+	}
+
+	for _, test := range tests {
+		if command := goCommand(test.limits); command != test.command {
+			t.Errorf("expected '%s', got '%s'", test.command, command)
+		}
+	}
+}
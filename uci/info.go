@@ -0,0 +1,193 @@
+package uci
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// A score reported by the engine, from the point of view of the side to
+// move.
+//
+// Either `Cp` is set (in centipawns) or `IsMate` is true and `Mate` is the
+// number of moves until mate, negative if the side to move is getting
+// mated. The bounds are set if the engine only knows that the score is at
+// least or at most the given value.
+type Score struct {
+	Cp         int
+	Mate       int
+	IsMate     bool
+	LowerBound bool
+	UpperBound bool
+}
+
+// Information the engine sent with an `info` command during a search.
+//
+// Fields the engine did not send are left at their zero value. The
+// principal variation only contains the moves that are legal when played
+// out from the position the engine was given. Moves after the first
+// illegal one are dropped.
+type Info struct {
+	Depth          int
+	SelDepth       int
+	MultiPV        int
+	Time           time.Duration
+	Nodes          int64
+	Nps            int64
+	TbHits         int64
+	HashFull       int
+	CpuLoad        int
+	Score          *Score
+	CurrMove       *chess.Move
+	CurrMoveNumber int
+	Pv             []*chess.Move
+	String         string
+}
+
+// Keywords starting a new field of an `info` command.
+var infoKeywords = map[string]bool{
+	"depth":          true,
+	"seldepth":       true,
+	"time":           true,
+	"nodes":          true,
+	"pv":             true,
+	"multipv":        true,
+	"score":          true,
+	"currmove":       true,
+	"currmovenumber": true,
+	"hashfull":       true,
+	"nps":            true,
+	"tbhits":         true,
+	"sbhits":         true,
+	"cpuload":        true,
+	"string":         true,
+	"refutation":     true,
+	"currline":       true,
+}
+
+// Parses the arguments of an `info` command in the context of the given
+// position. The position is used to validate the principal variation and
+// is left unchanged.
+func ParseInfo(arg string, board *chess.Bitboard) *Info {
+	info := &Info{}
+	tokens := strings.Fields(arg)
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "depth":
+			info.Depth, i = parseIntToken(tokens, i)
+		case "seldepth":
+			info.SelDepth, i = parseIntToken(tokens, i)
+		case "multipv":
+			info.MultiPV, i = parseIntToken(tokens, i)
+		case "hashfull":
+			info.HashFull, i = parseIntToken(tokens, i)
+		case "cpuload":
+			info.CpuLoad, i = parseIntToken(tokens, i)
+		case "currmovenumber":
+			info.CurrMoveNumber, i = parseIntToken(tokens, i)
+		case "time":
+			var ms int
+			ms, i = parseIntToken(tokens, i)
+			info.Time = time.Duration(ms) * time.Millisecond
+		case "nodes":
+			info.Nodes, i = parseInt64Token(tokens, i)
+		case "nps":
+			info.Nps, i = parseInt64Token(tokens, i)
+		case "tbhits":
+			info.TbHits, i = parseInt64Token(tokens, i)
+		case "currmove":
+			if i+1 < len(tokens) {
+				i++
+				info.CurrMove = chess.MoveFromUci(tokens[i])
+			}
+		case "score":
+			info.Score = &Score{}
+			for i+1 < len(tokens) {
+				if tokens[i+1] == "cp" && i+2 < len(tokens) {
+					info.Score.Cp, _ = strconv.Atoi(tokens[i+2])
+					i += 2
+				} else if tokens[i+1] == "mate" && i+2 < len(tokens) {
+					info.Score.Mate, _ = strconv.Atoi(tokens[i+2])
+					info.Score.IsMate = true
+					i += 2
+				} else if tokens[i+1] == "lowerbound" {
+					info.Score.LowerBound = true
+					i++
+				} else if tokens[i+1] == "upperbound" {
+					info.Score.UpperBound = true
+					i++
+				} else {
+					break
+				}
+			}
+		case "pv":
+			end := i + 1
+			for end < len(tokens) && !infoKeywords[tokens[end]] {
+				end++
+			}
+			info.Pv = parsePv(tokens[i+1:end], board)
+			i = end - 1
+		case "string":
+			info.String = strings.Join(tokens[i+1:], " ")
+			i = len(tokens)
+		case "refutation", "currline":
+			// Not supported. Skip the moves.
+			for i+1 < len(tokens) && !infoKeywords[tokens[i+1]] {
+				i++
+			}
+		}
+	}
+
+	return info
+}
+
+func parseIntToken(tokens []string, i int) (int, int) {
+	if i+1 >= len(tokens) {
+		return 0, i
+	}
+	value, _ := strconv.Atoi(tokens[i+1])
+	return value, i + 1
+}
+
+func parseInt64Token(tokens []string, i int) (int64, int) {
+	if i+1 >= len(tokens) {
+		return 0, i
+	}
+	value, _ := strconv.ParseInt(tokens[i+1], 10, 64)
+	return value, i + 1
+}
+
+// Converts UCI moves to a principal variation, stopping at the first move
+// that is not legal.
+func parsePv(tokens []string, board *chess.Bitboard) []*chess.Move {
+	pv := []*chess.Move{}
+
+	if board == nil {
+		for _, token := range tokens {
+			move := chess.MoveFromUci(token)
+			if move == nil {
+				break
+			}
+			pv = append(pv, move)
+		}
+		return pv
+	}
+
+	for _, token := range tokens {
+		move := chess.MoveFromUci(token)
+		if move == nil || !board.IsLegal(move) {
+			break
+		}
+		board.Push(move)
+		pv = append(pv, move)
+	}
+
+	for range pv {
+		board.Pop()
+	}
+
+	return pv
+}
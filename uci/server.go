@@ -0,0 +1,398 @@
+package uci
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// A search function that can be served as a UCI engine by `Server`.
+//
+// `Search` is called with the position set up by the GUI and the limits of
+// the `go` command. It may push and pop moves on the board, but has to
+// restore it before returning. Progress can be reported with `info`.
+// Once `stop` is closed the search should return as soon as possible.
+// Searches in ponder mode get a `PonderHit` channel in their limits.
+//
+// Returning a nil best move reports that there is no legal move.
+type Searcher interface {
+	Search(board *chess.Bitboard, limits *Limits, info func(*Info), stop <-chan struct{}) (bestMove, ponder *chess.Move)
+}
+
+// Searchers that want to be notified of `setoption` commands can implement
+// this interface.
+type OptionSetter interface {
+	SetOption(name, value string)
+}
+
+// Searchers that want to be notified of `ucinewgame` commands can
+// implement this interface.
+type NewGamer interface {
+	NewGame()
+}
+
+// Serves a `Searcher` as a UCI engine, reading commands from a GUI and
+// writing responses.
+//
+//     server := uci.NewServer(mySearcher, "My Engine", "Me")
+//     server.Options = append(server.Options, &uci.Option{
+//         Name: "Hash", Type: "spin", Default: "16", Min: 1, Max: 1024,
+//     })
+//     server.Serve(os.Stdin, os.Stdout)
+//
+// The search runs in the background, so that `stop`, `ponderhit` and
+// `isready` are handled while searching. `ponderhit` closes the
+// `PonderHit` channel of the limits, so that the searcher switches from
+// pondering to its normal time control. A new game, position or search
+// stops the running search first, like `stop` does.
+//
+// If a `UCI_Chess960` check option is added and switched on by the GUI,
+// positions are set up in Chess960 mode. Likewise a `UCI_Variant` combo
+// option selects the variant of the positions.
+type Server struct {
+	Name    string
+	Author  string
+	Options []*Option
+
+	searcher Searcher
+	board    *chess.Bitboard
+	chess960 bool
+	variant  chess.Variant
+
+	writer io.Writer
+	mu     sync.Mutex
+
+	stop      chan struct{}
+	done      chan struct{}
+	ponderHit chan struct{}
+}
+
+func NewServer(searcher Searcher, name, author string) *Server {
+	return &Server{
+		Name:     name,
+		Author:   author,
+		searcher: searcher,
+		board:    chess.NewBitboard(""),
+		variant:  chess.Standard,
+	}
+}
+
+// Handles commands from `reader` until `quit` is received or the input
+// ends. Responses are written to `writer`.
+func (s *Server) Serve(reader io.Reader, writer io.Writer) error {
+	s.writer = writer
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		command, arg := splitCommand(scanner.Text())
+
+		switch command {
+		case "uci":
+			s.send("id name " + s.Name)
+			s.send("id author " + s.Author)
+			for _, option := range s.Options {
+				s.send(formatOption(option))
+			}
+			s.send("uciok")
+		case "isready":
+			s.send("readyok")
+		case "setoption":
+			s.setOption(arg)
+		case "ucinewgame":
+			s.stopSearch()
+			s.board = chess.NewVariantBitboard(s.variant, "")
+			if newGamer, ok := s.searcher.(NewGamer); ok {
+				newGamer.NewGame()
+			}
+		case "position":
+			s.stopSearch()
+			s.setPosition(arg)
+		case "go":
+			s.stopSearch()
+			s.startSearch(parseGo(arg))
+		case "stop":
+			s.stopSearch()
+		case "ponderhit":
+			s.ponderHitSearch()
+		case "quit":
+			s.stopSearch()
+			return nil
+		}
+	}
+
+	s.stopSearch()
+	return scanner.Err()
+}
+
+// Writes a line to the GUI.
+func (s *Server) send(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	io.WriteString(s.writer, line+"\n")
+}
+
+func (s *Server) setOption(arg string) {
+	tokens := strings.Fields(arg)
+	name, value := []string{}, []string{}
+	current := &name
+	for _, token := range tokens {
+		if token == "name" && current == &name && len(name) == 0 {
+			continue
+		} else if token == "value" && current == &name {
+			current = &value
+			continue
+		}
+		*current = append(*current, token)
+	}
+
+	if strings.Join(name, " ") == "UCI_Chess960" {
+		s.chess960 = strings.Join(value, " ") == "true"
+	} else if strings.Join(name, " ") == "UCI_Variant" {
+		if variant := chess.VariantByName(strings.Join(value, " ")); variant != nil {
+			s.variant = variant
+		}
+	}
+
+	if setter, ok := s.searcher.(OptionSetter); ok {
+		setter.SetOption(strings.Join(name, " "), strings.Join(value, " "))
+	}
+}
+
+// Sets up the board from the arguments of a `position` command. Parsing
+// stops at the first illegal move.
+func (s *Server) setPosition(arg string) {
+	tokens := strings.Fields(arg)
+	if len(tokens) == 0 {
+		return
+	}
+
+	var board *chess.Bitboard
+	rest := []string{}
+	if tokens[0] == "startpos" {
+		board = chess.NewVariantBitboard(s.variant, "")
+		rest = tokens[1:]
+	} else if tokens[0] == "fen" {
+		end := 1
+		for end < len(tokens) && tokens[end] != "moves" {
+			end++
+		}
+		board = chess.NewVariantBitboard(s.variant, "")
+		if err := board.SetFen(strings.Join(tokens[1:end], " ")); err != nil {
+			return
+		}
+		rest = tokens[end:]
+	} else {
+		return
+	}
+	board.SetChess960(s.chess960)
+
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, token := range rest[1:] {
+			move := chess.MoveFromUci(token)
+			if move == nil || !board.IsLegal(move) {
+				break
+			}
+			board.Push(move)
+		}
+	}
+
+	s.board = board
+}
+
+func (s *Server) startSearch(limits *Limits) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.ponderHit = nil
+	if limits.Ponder {
+		s.ponderHit = make(chan struct{})
+		limits.PonderHit = s.ponderHit
+	}
+
+	board, stop, done := s.board, s.stop, s.done
+	go func() {
+		defer close(done)
+
+		bestMove, ponder := s.searcher.Search(board, limits, func(info *Info) {
+			s.send("info " + formatInfo(info))
+		}, stop)
+
+		if bestMove == nil {
+			s.send("bestmove (none)")
+		} else if ponder != nil {
+			s.send("bestmove " + bestMove.Uci() + " ponder " + ponder.Uci())
+		} else {
+			s.send("bestmove " + bestMove.Uci())
+		}
+	}()
+}
+
+// Stops a running search and waits for it to report the best move.
+func (s *Server) stopSearch() {
+	if s.stop == nil {
+		return
+	}
+
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+
+	s.waitSearch()
+}
+
+// Tells a search in ponder mode that the opponent played the expected
+// move.
+func (s *Server) ponderHitSearch() {
+	if s.ponderHit != nil {
+		close(s.ponderHit)
+		s.ponderHit = nil
+	}
+}
+
+// Waits for a running search to finish on its own.
+func (s *Server) waitSearch() {
+	if s.done != nil {
+		<-s.done
+	}
+}
+
+// Parses the arguments of a `go` command.
+func parseGo(arg string) *Limits {
+	limits := &Limits{}
+	tokens := strings.Fields(arg)
+
+	milliseconds := func(i int) (time.Duration, int) {
+		value, i := parseIntToken(tokens, i)
+		return time.Duration(value) * time.Millisecond, i
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "searchmoves":
+			for i+1 < len(tokens) {
+				move := chess.MoveFromUci(tokens[i+1])
+				if move == nil || len(tokens[i+1]) < 4 {
+					break
+				}
+				limits.SearchMoves = append(limits.SearchMoves, move)
+				i++
+			}
+		case "ponder":
+			limits.Ponder = true
+		case "wtime":
+			limits.WhiteTime, i = milliseconds(i)
+		case "btime":
+			limits.BlackTime, i = milliseconds(i)
+		case "winc":
+			limits.WhiteInc, i = milliseconds(i)
+		case "binc":
+			limits.BlackInc, i = milliseconds(i)
+		case "movestogo":
+			limits.MovesToGo, i = parseIntToken(tokens, i)
+		case "depth":
+			limits.Depth, i = parseIntToken(tokens, i)
+		case "nodes":
+			limits.Nodes, i = parseIntToken(tokens, i)
+		case "mate":
+			limits.Mate, i = parseIntToken(tokens, i)
+		case "movetime":
+			limits.MoveTime, i = milliseconds(i)
+		case "infinite":
+			limits.Infinite = true
+		}
+	}
+
+	return limits
+}
+
+// Formats the arguments of an `info` command. Fields with zero values are
+// left out.
+func formatInfo(info *Info) string {
+	parts := []string{}
+
+	if info.Depth > 0 {
+		parts = append(parts, "depth", strconv.Itoa(info.Depth))
+	}
+	if info.SelDepth > 0 {
+		parts = append(parts, "seldepth", strconv.Itoa(info.SelDepth))
+	}
+	if info.MultiPV > 0 {
+		parts = append(parts, "multipv", strconv.Itoa(info.MultiPV))
+	}
+	if info.Score != nil {
+		parts = append(parts, "score")
+		if info.Score.IsMate {
+			parts = append(parts, "mate", strconv.Itoa(info.Score.Mate))
+		} else {
+			parts = append(parts, "cp", strconv.Itoa(info.Score.Cp))
+		}
+		if info.Score.LowerBound {
+			parts = append(parts, "lowerbound")
+		} else if info.Score.UpperBound {
+			parts = append(parts, "upperbound")
+		}
+	}
+	if info.Nodes > 0 {
+		parts = append(parts, "nodes", strconv.FormatInt(info.Nodes, 10))
+	}
+	if info.Nps > 0 {
+		parts = append(parts, "nps", strconv.FormatInt(info.Nps, 10))
+	}
+	if info.TbHits > 0 {
+		parts = append(parts, "tbhits", strconv.FormatInt(info.TbHits, 10))
+	}
+	if info.HashFull > 0 {
+		parts = append(parts, "hashfull", strconv.Itoa(info.HashFull))
+	}
+	if info.CpuLoad > 0 {
+		parts = append(parts, "cpuload", strconv.Itoa(info.CpuLoad))
+	}
+	if info.Time > 0 {
+		parts = append(parts, "time", formatMilliseconds(info.Time))
+	}
+	if info.CurrMove != nil {
+		parts = append(parts, "currmove", info.CurrMove.Uci())
+	}
+	if info.CurrMoveNumber > 0 {
+		parts = append(parts, "currmovenumber", strconv.Itoa(info.CurrMoveNumber))
+	}
+	if len(info.Pv) > 0 {
+		parts = append(parts, "pv")
+		for _, move := range info.Pv {
+			parts = append(parts, move.Uci())
+		}
+	}
+
+	// The string extends to the end of the line, so it goes last.
+	if info.String != "" {
+		parts = append(parts, "string", info.String)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Formats the declaration of an option.
+func formatOption(option *Option) string {
+	line := "option name " + option.Name + " type " + option.Type
+	switch option.Type {
+	case "check", "string":
+		line += " default " + option.Default
+	case "spin":
+		line += " default " + option.Default
+		line += " min " + strconv.Itoa(option.Min) + " max " + strconv.Itoa(option.Max)
+	case "combo":
+		line += " default " + option.Default
+		for _, v := range option.Var {
+			line += " var " + v
+		}
+	}
+	return line
+}
@@ -0,0 +1,123 @@
+package uci
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// Waits for `ponderhit` or `stop` and tells which came first by the move
+// it plays: the first legal move after `ponderhit`, the second after
+// `stop`.
+type ponderSearcher struct{}
+
+func (ponderSearcher) Search(board *chess.Bitboard, limits *Limits, info func(*Info), stop <-chan struct{}) (bestMove, ponder *chess.Move) {
+	moves := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+	select {
+	case <-limits.PonderHit:
+		return moves[0], nil
+	case <-stop:
+		return moves[1], nil
+	}
+}
+
+// Connects an engine to a server running the given searcher.
+func serveEngine(t *testing.T, searcher Searcher) *Engine {
+	serverReader, engineWriter := io.Pipe()
+	engineReader, serverWriter := io.Pipe()
+
+	server := NewServer(searcher, "Test Server", "chess.go")
+	go func() {
+		server.Serve(serverReader, serverWriter)
+		serverWriter.Close()
+	}()
+
+	engine := NewEngine(engineReader, engineWriter)
+	if err := engine.Uci(); err != nil {
+		t.Fatal(err)
+	}
+	if engine.Name != "Test Server" {
+		t.Errorf("unexpected name '%s'", engine.Name)
+	}
+	return engine
+}
+
+func TestServerPonderHit(t *testing.T) {
+	engine := serveEngine(t, ponderSearcher{})
+	defer engine.Quit()
+
+	board := chess.NewBitboard(chess.StartingFen)
+	if err := engine.Position(board); err != nil {
+		t.Fatal(err)
+	}
+	moves := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+
+	search, err := engine.Start(&Limits{Ponder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Send("ponderhit"); err != nil {
+		t.Fatal(err)
+	}
+	bestMove, _, err := search.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bestMove.Equals(moves[0]) {
+		t.Errorf("expected the search to continue after ponderhit, got %s", bestMove.Uci())
+	}
+
+	search, err = engine.Start(&Limits{Ponder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := search.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	bestMove, _, err = search.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bestMove.Equals(moves[1]) {
+		t.Errorf("expected the search to be stopped, got %s", bestMove.Uci())
+	}
+}
+
+// An infinite search must not keep the server from reading the next
+// command.
+func TestServerPositionStopsSearch(t *testing.T) {
+	serverReader, guiWriter := io.Pipe()
+	guiReader, serverWriter := io.Pipe()
+
+	server := NewServer(ponderSearcher{}, "Test Server", "chess.go")
+	go func() {
+		server.Serve(serverReader, serverWriter)
+		serverWriter.Close()
+	}()
+	go io.WriteString(guiWriter, "position startpos\ngo infinite\nposition startpos\nisready\nquit\n")
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(guiReader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	moves := chess.NewBitboard(chess.StartingFen).GenerateLegalMoves(true, true, true, true, true, true, true)
+	expected := []string{"bestmove " + moves[1].Uci(), "readyok"}
+	for _, want := range expected {
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Errorf("expected '%s', got '%s'", want, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("server did not send '%s'", want)
+		}
+	}
+}
@@ -0,0 +1,767 @@
+package chess
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A chess variant. The rules of a variant hook into move generation, move
+// making, validation and game end detection of a `Bitboard`.
+//
+// Variants are stateless. State that only some variants need, like the
+// pockets of Crazyhouse, is kept by the board.
+//
+//     board := chess.NewVariantBitboard(chess.Crazyhouse, "")
+//     board.PushSan("e4")
+type Variant interface {
+	// Gets the name used in the PGN `Variant` header, for example
+	// `Crazyhouse`.
+	Name() string
+
+	// Gets the name used for the `UCI_Variant` option, for example
+	// `crazyhouse`.
+	UciName() string
+
+	// Gets the FEN of the starting position.
+	StartingFen() string
+
+	// Checks if captured pieces go into the pocket of the capturing side,
+	// from where they can be dropped back onto the board.
+	HasDrops() bool
+
+	// Adjusts the result of `Bitboard.Status()` to the rules of the variant.
+	status(b *Bitboard, errors Status) Status
+
+	// Checks for a draw due to insufficient mating material.
+	isInsufficientMaterial(b *Bitboard) bool
+
+	// Checks if the given side can not win by any sequence of legal
+	// moves.
+	hasInsufficientMaterial(b *Bitboard, color Colors) bool
+
+	// Checks if the side to move is in check.
+	isCheck(b *Bitboard) bool
+
+	// Checks if the last move was illegal, usually because it left the
+	// king in check.
+	wasIntoCheck(b *Bitboard) bool
+
+	// Applies the special rules of the variant after a move has been made
+	// and the turn has been swapped.
+	afterMove(b *Bitboard, move *Move, capture bool)
+
+	// Checks if a capture must be made whenever one is possible.
+	capturesCompulsory() bool
+
+	// Checks if pawns can promote to kings.
+	kingPromotion() bool
+
+	// Checks if the game ended by the special rules of the variant and if
+	// so, whether the side to move won or lost.
+	isVariantEnd(b *Bitboard) bool
+	isVariantWin(b *Bitboard) bool
+	isVariantLoss(b *Bitboard) bool
+}
+
+var (
+	// Standard chess.
+	Standard Variant = standardVariant{}
+
+	// Crazyhouse: captured pieces change sides and can be dropped back
+	// onto the board instead of making a move.
+	Crazyhouse Variant = crazyhouseVariant{}
+
+	// Atomic: captures cause an explosion that removes the capturing piece
+	// and all pieces but pawns around the target square. Exploding the
+	// opposing king wins.
+	Atomic Variant = atomicVariant{}
+
+	// King of the Hill: bringing the king to one of the four center
+	// squares wins.
+	KingOfTheHill Variant = kingOfTheHillVariant{}
+
+	// Three-check: giving check for the third time wins.
+	ThreeCheck Variant = threeCheckVariant{}
+
+	// Racing Kings: the first king to reach the eighth rank wins. Giving
+	// check is not allowed.
+	RacingKings Variant = racingKingsVariant{}
+
+	// Antichess, also known as Giveaway: captures are compulsory and the
+	// king is an ordinary piece. Losing all pieces or being stalemated
+	// wins.
+	Antichess Variant = antichessVariant{}
+
+	// Horde: white has 36 pawns and no king. Black wins by capturing all of
+	// them, white by checkmating the black king.
+	Horde Variant = hordeVariant{}
+)
+
+// Variants by lower-case name, including common aliases.
+var variantsByName = map[string]Variant{
+	"standard":         Standard,
+	"chess":            Standard,
+	"normal":           Standard,
+	"crazyhouse":       Crazyhouse,
+	"zh":               Crazyhouse,
+	"atomic":           Atomic,
+	"king of the hill": KingOfTheHill,
+	"kingofthehill":    KingOfTheHill,
+	"koth":             KingOfTheHill,
+	"three-check":      ThreeCheck,
+	"three check":      ThreeCheck,
+	"threecheck":       ThreeCheck,
+	"3check":           ThreeCheck,
+	"racing kings":     RacingKings,
+	"racingkings":      RacingKings,
+	"antichess":        Antichess,
+	"giveaway":         Antichess,
+	"horde":            Horde,
+}
+
+// Gets a variant by its PGN or UCI name. Returns nil if the variant is
+// unknown.
+func VariantByName(name string) Variant {
+	return variantsByName[strings.ToLower(strings.TrimSpace(name))]
+}
+
+type standardVariant struct{}
+
+func (standardVariant) Name() string {
+	return "Standard"
+}
+
+func (standardVariant) UciName() string {
+	return "chess"
+}
+
+func (standardVariant) StartingFen() string {
+	return StartingFen
+}
+
+func (standardVariant) HasDrops() bool {
+	return false
+}
+
+func (standardVariant) status(b *Bitboard, errors Status) Status {
+	return errors
+}
+
+func (standardVariant) isInsufficientMaterial(b *Bitboard) bool {
+	// Enough material to mate.
+	if b.pawns > 0 || b.rooks > 0 || b.queens > 0 {
+		return false
+	}
+
+	// A single knight or a single bishop.
+	if popCount(b.occupied) <= 3 {
+		return true
+	}
+
+	// More than a single knight.
+	if b.knights > 0 {
+		return false
+	}
+
+	// All bishops on the same color.
+	if b.bishops&BBDarkSquares == 0 {
+		return true
+	} else if b.bishops&BBLightSquares == 0 {
+		return true
+	}
+
+	return false
+}
+
+// A lone knight can only mate if opposing pieces block the flight
+// squares, which a queen would not do. A bishop needs opposing pawns,
+// knights or bishops of the other color to do so.
+func (standardVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	own := b.occupiedCo[color]
+	if own&(b.pawns|b.rooks|b.queens) > 0 {
+		return false
+	}
+
+	if own&b.knights > 0 {
+		return popCount(own) <= 2 && b.occupiedCo[color^1] & ^b.kings & ^b.queens == 0
+	}
+
+	if own&b.bishops > 0 {
+		sameColor := b.bishops&BBDarkSquares == 0 || b.bishops&BBLightSquares == 0
+		return sameColor && b.pawns == 0 && b.knights == 0
+	}
+
+	return true
+}
+
+func (standardVariant) isCheck(b *Bitboard) bool {
+	return b.checkersMask() != 0
+}
+
+func (standardVariant) wasIntoCheck(b *Bitboard) bool {
+	return b.IsAttackedBy(b.turn, b.kingSquares[b.turn^1])
+}
+
+func (standardVariant) afterMove(b *Bitboard, move *Move, capture bool) {}
+
+func (standardVariant) capturesCompulsory() bool {
+	return false
+}
+
+func (standardVariant) kingPromotion() bool {
+	return false
+}
+
+func (standardVariant) isVariantEnd(b *Bitboard) bool {
+	return false
+}
+
+func (standardVariant) isVariantWin(b *Bitboard) bool {
+	return false
+}
+
+func (standardVariant) isVariantLoss(b *Bitboard) bool {
+	return false
+}
+
+type crazyhouseVariant struct {
+	standardVariant
+}
+
+func (crazyhouseVariant) Name() string {
+	return "Crazyhouse"
+}
+
+func (crazyhouseVariant) UciName() string {
+	return "crazyhouse"
+}
+
+func (crazyhouseVariant) StartingFen() string {
+	return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"
+}
+
+func (crazyhouseVariant) HasDrops() bool {
+	return true
+}
+
+// Pieces in the pockets count towards the limits of pawns and pieces, but
+// either side can have more than its original share.
+func (crazyhouseVariant) status(b *Bitboard, errors Status) Status {
+	pawns := popCount(b.pawns) + b.pockets[White][Pawn] + b.pockets[Black][Pawn]
+	if pawns <= 16 {
+		errors &= ^(StatusTooManyWhitePawns | StatusTooManyBlackPawns)
+	}
+
+	pieces := popCount(b.occupied) + b.pocketCount(White) + b.pocketCount(Black)
+	if pieces <= 32 {
+		errors &= ^(StatusTooManyWhitePieces | StatusTooManyBlackPieces)
+	}
+
+	return errors
+}
+
+// Material never leaves the game, so this is only the case with bare
+// kings and a single minor piece.
+func (crazyhouseVariant) isInsufficientMaterial(b *Bitboard) bool {
+	if popCount(b.occupied)+b.pocketCount(White)+b.pocketCount(Black) > 3 {
+		return false
+	}
+
+	for color := White; color <= Black; color++ {
+		if b.pockets[color][Pawn] > 0 || b.pockets[color][Rook] > 0 || b.pockets[color][Queen] > 0 {
+			return false
+		}
+	}
+
+	return b.pawns == 0 && b.rooks == 0 && b.queens == 0
+}
+
+func (v crazyhouseVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	return v.isInsufficientMaterial(b)
+}
+
+type atomicVariant struct {
+	standardVariant
+}
+
+func (atomicVariant) Name() string {
+	return "Atomic"
+}
+
+func (atomicVariant) UciName() string {
+	return "atomic"
+}
+
+// The king of the side to move may be missing, if it just exploded.
+// Adjacent kings can not give check, so they are not an opposite check.
+func (atomicVariant) status(b *Bitboard, errors Status) Status {
+	if b.kings&b.occupiedCo[b.turn^1] > 0 {
+		if b.turn == White {
+			errors &= ^StatusNoWhiteKing
+		} else {
+			errors &= ^StatusNoBlackKing
+		}
+	}
+
+	return errors
+}
+
+// Both sides lack material to explode the opposing king.
+func (v atomicVariant) isInsufficientMaterial(b *Bitboard) bool {
+	return v.hasInsufficientMaterial(b, White) && v.hasInsufficientMaterial(b, Black)
+}
+
+func (atomicVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	// The opposing king already exploded.
+	if b.kings&b.occupiedCo[color^1] == 0 {
+		return false
+	}
+
+	// A bare king can not capture anything.
+	if b.occupiedCo[color] & ^b.kings == 0 {
+		return true
+	}
+
+	// As long as the opposing king is not alone, one of its own pieces
+	// can explode next to it. Unless there are only bishops of opposite
+	// colors that can never capture each other.
+	if b.occupiedCo[color^1] & ^b.kings > 0 {
+		if b.occupied == b.bishops|b.kings {
+			if b.bishops&b.occupiedCo[White]&BBDarkSquares == 0 {
+				return b.bishops&b.occupiedCo[Black]&BBLightSquares == 0
+			}
+			if b.bishops&b.occupiedCo[White]&BBLightSquares == 0 {
+				return b.bishops&b.occupiedCo[Black]&BBDarkSquares == 0
+			}
+		}
+		return false
+	}
+
+	// A queen, or a pawn that can become one, mates a bare king.
+	if b.queens > 0 || b.pawns > 0 {
+		return false
+	}
+
+	// A single minor piece or rook can not mate a bare king, and neither
+	// can two knights.
+	if popCount(b.knights|b.bishops|b.rooks) == 1 {
+		return true
+	}
+	if b.occupied == b.knights|b.kings {
+		return popCount(b.knights) <= 2
+	}
+
+	return false
+}
+
+// There is no check with a missing king or when the kings are adjacent,
+// because a king can not capture.
+func (v atomicVariant) isCheck(b *Bitboard) bool {
+	if b.kings&b.occupiedCo[White] == 0 || b.kings&b.occupiedCo[Black] == 0 {
+		return false
+	}
+	if BBKingAttacks[b.kingSquares[White]]&BBSquares[b.kingSquares[Black]] > 0 {
+		return false
+	}
+
+	return v.standardVariant.isCheck(b)
+}
+
+// Exploding the own king is illegal, but exploding the opposing king wins,
+// even if the own king is left in check.
+func (v atomicVariant) wasIntoCheck(b *Bitboard) bool {
+	if b.kings&b.occupiedCo[b.turn^1] == 0 {
+		return true
+	}
+	if b.kings&b.occupiedCo[b.turn] == 0 {
+		return false
+	}
+	if BBKingAttacks[b.kingSquares[White]]&BBSquares[b.kingSquares[Black]] > 0 {
+		return false
+	}
+
+	return v.standardVariant.wasIntoCheck(b)
+}
+
+// Removes the capturing piece and all pieces but pawns around the target
+// square. They are remembered, so that `Pop()` can put them back.
+func (atomicVariant) afterMove(b *Bitboard, move *Move, capture bool) {
+	if !capture {
+		return
+	}
+
+	state := &b.stack[len(b.stack)-1].variant
+	explosion := BBSquares[move.toSquare] | BBKingAttacks[move.toSquare]&b.occupied & ^b.pawns
+	for squares := explosion; squares != 0; squares &= squares - 1 {
+		square := lsb(squares)
+		piece := b.PieceAt(square)
+		state.exploded = append(state.exploded, explodedPiece{square, piece})
+		b.RemovePieceAt(square)
+
+		// Exploded kings and rooks lose their castling rights.
+		for side := kingSide; side <= queenSide; side++ {
+			if piece.pieceType == King || square == b.castlingRookSquare(piece.color, side) {
+				b.castlingRights &= ^castlingFlags[piece.color][side]
+			}
+		}
+	}
+}
+
+func (atomicVariant) isVariantEnd(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[White] == 0 || b.kings&b.occupiedCo[Black] == 0
+}
+
+func (atomicVariant) isVariantWin(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[b.turn] > 0 && b.kings&b.occupiedCo[b.turn^1] == 0
+}
+
+func (atomicVariant) isVariantLoss(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[b.turn] == 0
+}
+
+type kingOfTheHillVariant struct {
+	standardVariant
+}
+
+func (kingOfTheHillVariant) Name() string {
+	return "King of the Hill"
+}
+
+func (kingOfTheHillVariant) UciName() string {
+	return "kingofthehill"
+}
+
+// The king can always walk to the center.
+func (kingOfTheHillVariant) isInsufficientMaterial(b *Bitboard) bool {
+	return false
+}
+
+func (kingOfTheHillVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	return false
+}
+
+func (kingOfTheHillVariant) isVariantEnd(b *Bitboard) bool {
+	return b.kings&BBCenter > 0
+}
+
+func (kingOfTheHillVariant) isVariantWin(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[b.turn]&BBCenter > 0
+}
+
+func (kingOfTheHillVariant) isVariantLoss(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[b.turn^1]&BBCenter > 0
+}
+
+type threeCheckVariant struct {
+	standardVariant
+}
+
+func (threeCheckVariant) Name() string {
+	return "Three-check"
+}
+
+func (threeCheckVariant) UciName() string {
+	return "3check"
+}
+
+func (threeCheckVariant) StartingFen() string {
+	return StartingFen + " +0+0"
+}
+
+// Any piece can give check.
+func (threeCheckVariant) isInsufficientMaterial(b *Bitboard) bool {
+	return b.occupied == b.kings
+}
+
+func (threeCheckVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	return b.occupiedCo[color] & ^b.kings == 0
+}
+
+// Counts the checks given.
+func (threeCheckVariant) afterMove(b *Bitboard, move *Move, capture bool) {
+	if b.IsCheck() && b.checks[b.turn^1] < 3 {
+		b.checks[b.turn^1]++
+	}
+}
+
+func (threeCheckVariant) isVariantEnd(b *Bitboard) bool {
+	return b.checks[White] >= 3 || b.checks[Black] >= 3
+}
+
+func (threeCheckVariant) isVariantWin(b *Bitboard) bool {
+	return b.checks[b.turn] >= 3
+}
+
+func (threeCheckVariant) isVariantLoss(b *Bitboard) bool {
+	return b.checks[b.turn^1] >= 3
+}
+
+// Values to hash in the number of checks given by each color in
+// Three-check.
+var checksZobristArray [2][4]uint64
+
+func init() {
+	seed := uint64(0x3c6ef372fe94f82b)
+	for color := range checksZobristArray {
+		for count := range checksZobristArray[color] {
+			checksZobristArray[color][count] = splitMix64(&seed)
+		}
+	}
+}
+
+// Splits the checks from the parts of a Three-check FEN. The checks given
+// can follow the move counters, `+2+1`, or the checks remaining can follow
+// the en-passant square, `1+2`, like in lichess EPDs.
+func splitChecksFen(parts []string) ([]string, [2]int) {
+	var checks [2]int
+	if len(parts) != 7 {
+		return parts, checks
+	}
+
+	if match := FenChecksRegex.FindStringSubmatch(parts[6]); match != nil && match[1] != "" {
+		checks[White], _ = strconv.Atoi(match[2])
+		checks[Black], _ = strconv.Atoi(match[3])
+		return parts[:6], checks
+	}
+
+	if match := FenChecksRegex.FindStringSubmatch(parts[4]); match != nil && match[1] == "" {
+		remainingWhite, _ := strconv.Atoi(match[2])
+		remainingBlack, _ := strconv.Atoi(match[3])
+		checks = [2]int{3 - remainingWhite, 3 - remainingBlack}
+		return append(parts[:4:4], parts[5:]...), checks
+	}
+
+	return parts, checks
+}
+
+type racingKingsVariant struct {
+	standardVariant
+}
+
+func (racingKingsVariant) Name() string {
+	return "Racing Kings"
+}
+
+func (racingKingsVariant) UciName() string {
+	return "racingkings"
+}
+
+func (racingKingsVariant) StartingFen() string {
+	return "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1"
+}
+
+// There are no pawns, no castling and no more pieces than in the starting
+// position. Neither side can be in check.
+func (racingKingsVariant) status(b *Bitboard, errors Status) Status {
+	if b.castlingRights != CastlingNone {
+		errors |= StatusBadCastlingRights
+	}
+
+	if b.IsAttackedBy(White, b.kingSquares[Black]) || b.IsAttackedBy(Black, b.kingSquares[White]) {
+		errors |= StatusRaceCheck
+	}
+
+	for color := White; color <= Black; color++ {
+		pieces := b.occupiedCo[color]
+		if popCount(b.knights&pieces) > 2 || popCount(b.bishops&pieces) > 2 || popCount(b.rooks&pieces) > 2 || popCount(b.queens&pieces) > 1 {
+			errors |= StatusRaceMaterial
+		}
+	}
+	if b.pawns > 0 {
+		errors |= StatusRaceMaterial
+	}
+
+	return errors
+}
+
+// The kings can always race.
+func (racingKingsVariant) isInsufficientMaterial(b *Bitboard) bool {
+	return false
+}
+
+func (racingKingsVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	return false
+}
+
+// Giving check is not allowed either.
+func (v racingKingsVariant) wasIntoCheck(b *Bitboard) bool {
+	return v.standardVariant.wasIntoCheck(b) || v.standardVariant.isCheck(b)
+}
+
+// White moves first, so when the white king reaches the eighth rank, black
+// gets one more move to draw by reaching it as well.
+func (racingKingsVariant) isVariantEnd(b *Bitboard) bool {
+	goal := b.kings & BBRank8
+	if goal == 0 {
+		return false
+	}
+	if b.turn == White || goal&b.occupiedCo[Black] > 0 {
+		return true
+	}
+
+	kingSquare := b.kingSquares[Black]
+	for squares := BBKingAttacks[kingSquare] & BBRank8 & ^b.occupiedCo[Black]; squares != 0; squares &= squares - 1 {
+		if !b.IsIntoCheck(NewMove(kingSquare, lsb(squares), None)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (racingKingsVariant) isVariantWin(b *Bitboard) bool {
+	goal := b.kings & BBRank8
+	return goal&b.occupiedCo[b.turn] > 0 && goal&b.occupiedCo[b.turn^1] == 0
+}
+
+func (racingKingsVariant) isVariantLoss(b *Bitboard) bool {
+	return b.kings&BBRank8&b.occupiedCo[b.turn] == 0
+}
+
+type antichessVariant struct {
+	standardVariant
+}
+
+func (antichessVariant) Name() string {
+	return "Antichess"
+}
+
+func (antichessVariant) UciName() string {
+	return "antichess"
+}
+
+func (antichessVariant) StartingFen() string {
+	return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1"
+}
+
+// Any number of kings is fine, but there is no castling.
+func (antichessVariant) status(b *Bitboard, errors Status) Status {
+	errors &= ^(StatusNoWhiteKing | StatusNoBlackKing | StatusTooManyKings | StatusOppositeCheck)
+	if b.castlingRights != CastlingNone {
+		errors |= StatusBadCastlingRights
+	}
+
+	return errors
+}
+
+// Only bishops are left and those of each side are on squares of a
+// different color, so that they can never capture each other.
+func (antichessVariant) isInsufficientMaterial(b *Bitboard) bool {
+	if b.occupied != b.bishops || b.occupiedCo[White] == 0 || b.occupiedCo[Black] == 0 {
+		return false
+	}
+
+	if b.occupiedCo[White]&BBDarkSquares == 0 {
+		return b.occupiedCo[Black]&BBLightSquares == 0
+	}
+	if b.occupiedCo[White]&BBLightSquares == 0 {
+		return b.occupiedCo[Black]&BBDarkSquares == 0
+	}
+
+	return false
+}
+
+func (v antichessVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	return v.isInsufficientMaterial(b)
+}
+
+func (antichessVariant) isCheck(b *Bitboard) bool {
+	return false
+}
+
+func (antichessVariant) wasIntoCheck(b *Bitboard) bool {
+	return false
+}
+
+func (antichessVariant) capturesCompulsory() bool {
+	return true
+}
+
+func (antichessVariant) kingPromotion() bool {
+	return true
+}
+
+// Without checks every pseudo legal move is legal, so counting them tells
+// if the side to move is stalemated.
+func (antichessVariant) isVariantEnd(b *Bitboard) bool {
+	return b.occupiedCo[White] == 0 || b.occupiedCo[Black] == 0 || b.PseudoLegalMoveCount() == 0
+}
+
+func (antichessVariant) isVariantWin(b *Bitboard) bool {
+	return b.occupiedCo[b.turn] == 0 || b.PseudoLegalMoveCount() == 0
+}
+
+func (antichessVariant) isVariantLoss(b *Bitboard) bool {
+	return b.occupiedCo[b.turn] != 0 && b.occupiedCo[b.turn^1] == 0
+}
+
+type hordeVariant struct {
+	standardVariant
+}
+
+func (hordeVariant) Name() string {
+	return "Horde"
+}
+
+func (hordeVariant) UciName() string {
+	return "horde"
+}
+
+func (hordeVariant) StartingFen() string {
+	return "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPPPPP w kq - 0 1"
+}
+
+// White has no king, but up to 36 pawns, which may also stand on the first
+// rank.
+func (hordeVariant) status(b *Bitboard, errors Status) Status {
+	errors &= ^(StatusNoWhiteKing | StatusTooManyWhitePawns | StatusTooManyWhitePieces | StatusPawnsOnBackrank)
+
+	if b.kings&b.occupiedCo[White] > 0 {
+		errors |= StatusTooManyKings
+	}
+	if popCount(b.pawns&b.occupiedCo[White]) > 36 {
+		errors |= StatusTooManyWhitePawns
+	}
+	if popCount(b.occupiedCo[White]) > 36 {
+		errors |= StatusTooManyWhitePieces
+	}
+	if b.pawns&BBRank8 > 0 || b.pawns&b.occupiedCo[Black]&BBRank1 > 0 {
+		errors |= StatusPawnsOnBackrank
+	}
+
+	// Skipped before, because of the missing white king.
+	if errors&(StatusNoBlackKing|StatusTooManyKings) == 0 && b.turn == White && b.WasIntoCheck() {
+		errors |= StatusOppositeCheck
+	}
+
+	return errors
+}
+
+// Black can always try to capture the horde, so the game goes on.
+func (hordeVariant) isInsufficientMaterial(b *Bitboard) bool {
+	return false
+}
+
+func (hordeVariant) hasInsufficientMaterial(b *Bitboard, color Colors) bool {
+	return false
+}
+
+func (v hordeVariant) isCheck(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[b.turn] > 0 && v.standardVariant.isCheck(b)
+}
+
+func (v hordeVariant) wasIntoCheck(b *Bitboard) bool {
+	return b.kings&b.occupiedCo[b.turn^1] > 0 && v.standardVariant.wasIntoCheck(b)
+}
+
+func (hordeVariant) isVariantEnd(b *Bitboard) bool {
+	return b.occupiedCo[White] == 0
+}
+
+func (hordeVariant) isVariantWin(b *Bitboard) bool {
+	return b.turn == Black
+}
+
+func (hordeVariant) isVariantLoss(b *Bitboard) bool {
+	return b.turn == White
+}
@@ -0,0 +1,287 @@
+package chess
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Gets the legal moves of the board in UCI notation.
+func legalUcis(board *Bitboard) []string {
+	ucis := []string{}
+	for _, move := range board.GenerateLegalMoves(true, true, true, true, true, true, true) {
+		ucis = append(ucis, move.Uci())
+	}
+	return ucis
+}
+
+func TestAntichessCapturesCompulsory(t *testing.T) {
+	board := NewVariantBitboard(Antichess, "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w - - 0 2")
+	if moves := legalUcis(board); len(moves) != 1 || moves[0] != "e4d5" {
+		t.Errorf("expected only the capture e4d5, got %v", moves)
+	}
+
+	// The king is an ordinary piece, which can be captured and promoted
+	// to.
+	board = NewVariantBitboard(Antichess, "8/P7/8/8/8/8/8/1k5K w - - 0 1")
+	if move := MoveFromUci("a7a8k"); !board.IsLegal(move) {
+		t.Error("expected promotion to a king to be legal")
+	}
+	board = NewVariantBitboard(Antichess, "8/8/8/8/8/8/1k6/K7 w - - 0 1")
+	if moves := legalUcis(board); len(moves) != 1 || moves[0] != "a1b2" {
+		t.Errorf("expected only the king capture a1b2, got %v", moves)
+	}
+	if board.IsCheck() {
+		t.Error("there is no check in antichess")
+	}
+}
+
+func TestAntichessEnd(t *testing.T) {
+	tests := []struct {
+		fen  string
+		win  bool
+		loss bool
+	}{
+		// Stalemated, so white wins.
+		{"8/8/8/8/8/p7/P7/8 w - - 0 1", true, false},
+		// White lost all pieces and wins.
+		{"8/8/8/8/8/8/8/k7 w - - 0 1", true, false},
+		// Black has pieces left, but white does not.
+		{"8/8/8/8/8/8/8/k7 b - - 0 1", false, true},
+	}
+
+	for _, test := range tests {
+		board := NewVariantBitboard(Antichess, test.fen)
+		if !board.IsVariantEnd() {
+			t.Errorf("%s: expected the game to be over", test.fen)
+		}
+		if board.IsVariantWin() != test.win || board.IsVariantLoss() != test.loss {
+			t.Errorf("%s: expected win %v and loss %v", test.fen, test.win, test.loss)
+		}
+		if moves := legalUcis(board); len(moves) != 0 {
+			t.Errorf("%s: unexpected moves %v", test.fen, moves)
+		}
+	}
+
+	board := NewVariantBitboard(Antichess, "")
+	if board.IsVariantEnd() || board.Status() != StatusValid {
+		t.Error("expected the starting position to be valid and going on")
+	}
+}
+
+func TestHordeMoves(t *testing.T) {
+	board := NewVariantBitboard(Horde, "")
+	if status := board.Status(); status != StatusValid {
+		t.Errorf("expected the starting position to be valid, got %v", status)
+	}
+
+	// Pawns on the first rank may move two squares.
+	board = NewVariantBitboard(Horde, "rnbqkbnr/pppppppp/8/8/8/8/1P6/P6P w kq - 0 1")
+	for _, uci := range []string{"a1a2", "a1a3", "h1h2", "h1h3", "b2b3", "b2b4"} {
+		if !board.IsLegal(MoveFromUci(uci)) {
+			t.Errorf("expected %s to be legal", uci)
+		}
+	}
+	if _, err := board.PushSan("a3"); err != nil {
+		t.Fatal(err)
+	}
+	if board.PieceTypeAt(A3) != Pawn || board.PieceTypeAt(A1) != None {
+		t.Errorf("expected the pawn to move from a1 to a3: %s", board.Fen())
+	}
+
+	// The pawn in front blocks the double step.
+	board = NewVariantBitboard(Horde, "rnbqkbnr/pppppppp/8/8/8/8/P7/P7 w kq - 0 1")
+	if board.IsLegal(MoveFromUci("a1a3")) {
+		t.Error("expected a1a3 to be blocked by the pawn on a2")
+	}
+}
+
+func TestHordeEnd(t *testing.T) {
+	board := NewVariantBitboard(Horde, "4k3/8/8/8/8/8/3q4/4P3 b - - 0 1")
+	if board.IsVariantEnd() {
+		t.Error("expected the game to go on while white has a pawn")
+	}
+
+	if _, err := board.PushSan("Qxe1"); err != nil {
+		t.Fatal(err)
+	}
+	if !board.IsVariantEnd() || !board.IsVariantLoss() || board.IsVariantWin() {
+		t.Error("expected white to lose without pieces")
+	}
+	if !board.IsGameOver() {
+		t.Error("expected the game to be over")
+	}
+
+	// White wins by checkmate as usual.
+	board = NewVariantBitboard(Horde, "7k/6PP/5PP1/8/8/8/8/8 b - - 0 1")
+	if !board.IsCheckmate() || board.IsVariantEnd() {
+		t.Errorf("expected black to be checkmated: %s", board.Fen())
+	}
+}
+
+func TestAtomicExplosion(t *testing.T) {
+	// The knight, the captured pawn and the pieces next to d5 explode,
+	// the pawn on e4 survives.
+	fen := "4k3/8/2b1r3/3p4/4p3/4N3/8/4K3 w - - 0 1"
+	board := NewVariantBitboard(Atomic, fen)
+	if _, err := board.PushSan("Nxd5"); err != nil {
+		t.Fatal(err)
+	}
+	if board.Fen() != "4k3/8/8/8/4p3/8/8/4K3 b - - 0 1" {
+		t.Errorf("unexpected position after the explosion: '%s'", board.Fen())
+	}
+	board.Pop()
+	if board.Fen() != fen {
+		t.Errorf("expected the exploded pieces back, got '%s'", board.Fen())
+	}
+
+	// Kings can not capture, and a capture next to the own king explodes
+	// it.
+	board = NewVariantBitboard(Atomic, "4k3/8/8/8/1B6/8/3r4/4K3 w - - 0 1")
+	for _, uci := range []string{"e1d2", "b4d2"} {
+		if board.IsLegal(MoveFromUci(uci)) {
+			t.Errorf("expected %s to be illegal", uci)
+		}
+	}
+
+	// Exploding the opposing king wins right away.
+	board = NewVariantBitboard(Atomic, "3qk3/8/8/8/8/8/8/3QK3 w - - 0 1")
+	if _, err := board.PushSan("Qxd8"); err != nil {
+		t.Fatal(err)
+	}
+	if !board.IsVariantEnd() || !board.IsVariantLoss() || board.IsVariantWin() {
+		t.Errorf("expected black to lose with the exploded king: %s", board.Fen())
+	}
+	if moves := legalUcis(board); len(moves) != 0 {
+		t.Errorf("unexpected moves after the king exploded: %v", moves)
+	}
+
+	// Kings next to each other are not in check.
+	board = NewVariantBitboard(Atomic, "8/8/8/8/8/3k4/3K4/3r4 w - - 0 1")
+	if board.IsCheck() {
+		t.Error("unexpected check with adjacent kings")
+	}
+}
+
+func TestKingOfTheHill(t *testing.T) {
+	board := NewVariantBitboard(KingOfTheHill, "4k3/8/8/8/8/3K4/8/8 w - - 0 1")
+	if board.IsVariantEnd() {
+		t.Error("unexpected end before reaching the center")
+	}
+
+	if _, err := board.PushSan("Kd4"); err != nil {
+		t.Fatal(err)
+	}
+	if !board.IsVariantEnd() || !board.IsVariantLoss() {
+		t.Errorf("expected black to lose with the white king on d4: %s", board.Fen())
+	}
+	if moves := legalUcis(board); len(moves) != 0 {
+		t.Errorf("unexpected moves after reaching the center: %v", moves)
+	}
+	board.Pop()
+
+	// Other squares next to the center do not count.
+	if _, err := board.PushSan("Kc4"); err != nil {
+		t.Fatal(err)
+	}
+	if board.IsVariantEnd() {
+		t.Error("unexpected end on c4")
+	}
+}
+
+func TestThreeCheckFen(t *testing.T) {
+	tests := []struct {
+		fen    string
+		checks [2]int
+	}{
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1 +1+0", [2]int{1, 0}},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", [2]int{0, 0}},
+		// Checks remaining after the en-passant square.
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 2+1 0 1", [2]int{1, 2}},
+	}
+
+	for _, test := range tests {
+		board := NewVariantBitboard(ThreeCheck, test.fen)
+		if board.checks != test.checks {
+			t.Errorf("%s: expected checks %v, got %v", test.fen, test.checks, board.checks)
+		}
+		hash := board.ZobristHash(nil)
+
+		// A check counts and is written to the FEN.
+		if _, err := board.PushSan("Ra8+"); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("R3k3/8/8/8/8/8/8/4K3 b - - 1 1 +%d+%d", test.checks[White]+1, test.checks[Black])
+		if board.Fen() != expected {
+			t.Errorf("%s: expected '%s', got '%s'", test.fen, expected, board.Fen())
+		}
+		if reread := NewVariantBitboard(ThreeCheck, board.Fen()); reread.checks != board.checks {
+			t.Errorf("%s: expected checks %v after reading back, got %v", test.fen, board.checks, reread.checks)
+		}
+
+		board.Pop()
+		if board.checks != test.checks || board.ZobristHash(nil) != hash {
+			t.Errorf("%s: checks not restored, got %v", test.fen, board.checks)
+		}
+	}
+
+	// The hash includes the checks.
+	if NewVariantBitboard(ThreeCheck, tests[0].fen).ZobristHash(nil) == NewVariantBitboard(ThreeCheck, tests[1].fen).ZobristHash(nil) {
+		t.Error("expected different hashes with different checks")
+	}
+
+	// The third check wins.
+	board := NewVariantBitboard(ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 0 1 +2+0")
+	board.PushSan("Ra8+")
+	if !board.IsVariantEnd() || !board.IsVariantLoss() {
+		t.Errorf("expected black to lose after the third check: %s", board.Fen())
+	}
+}
+
+func TestRacingKings(t *testing.T) {
+	board := NewVariantBitboard(RacingKings, "")
+	if status := board.Status(); status != StatusValid {
+		t.Errorf("expected the starting position to be valid, got %v", status)
+	}
+
+	// Moves giving check are not allowed.
+	board = NewVariantBitboard(RacingKings, "8/8/8/8/8/8/k7/6RK w - - 0 1")
+	for _, uci := range []string{"g1g2", "g1a1"} {
+		if board.IsLegal(MoveFromUci(uci)) {
+			t.Errorf("expected %s to be illegal, because it gives check", uci)
+		}
+	}
+	if !board.IsLegal(MoveFromUci("g1b1")) {
+		t.Error("expected g1b1 to be legal")
+	}
+	for _, uci := range legalUcis(board) {
+		move := MoveFromUci(uci)
+		board.Push(move)
+		if board.IsCheck() {
+			t.Errorf("%s gives check", uci)
+		}
+		board.Pop()
+	}
+
+	// White reached the goal, but black can still draw.
+	board = NewVariantBitboard(RacingKings, "4K3/6k1/8/8/8/8/8/8 b - - 0 1")
+	if board.IsVariantEnd() {
+		t.Error("expected black to get another move")
+	}
+	if _, err := board.PushSan("Kh8"); err != nil {
+		t.Fatal(err)
+	}
+	if !board.IsVariantEnd() || board.IsVariantWin() || board.IsVariantLoss() {
+		t.Errorf("expected a draw: %s", board.Fen())
+	}
+	board.Pop()
+	if _, err := board.PushSan("Kf6"); err != nil {
+		t.Fatal(err)
+	}
+	if !board.IsVariantEnd() || !board.IsVariantWin() {
+		t.Errorf("expected white to win: %s", board.Fen())
+	}
+
+	if NewVariantBitboard(RacingKings, "8/8/8/8/8/8/k5Q1/7K w - - 0 1").Status()&StatusRaceCheck == 0 {
+		t.Error("expected check to be an invalid position")
+	}
+}
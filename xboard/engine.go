@@ -0,0 +1,669 @@
+// Package xboard communicates with chess engines speaking the Chess Engine
+// Communication Protocol (CECP), also known as the XBoard or WinBoard
+// protocol.
+//
+//     engine, _ := xboard.Popen("crafty")
+//     engine.Xboard()
+//
+//     board := chess.NewBitboard("")
+//     engine.Position(board)
+//     move, _ := engine.Go(&xboard.Limits{SecondsPerMove: 5 * time.Second})
+//
+//     engine.Quit()
+package xboard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// The time to wait for the feature negotiation to finish. Engines that
+// only speak protocol version 1 never send `done=1`, so this is also the
+// time it takes to detect them.
+var HandshakeTimeout = 2 * time.Second
+
+// Features that are understood and therefore accepted during the feature
+// negotiation. All others are rejected.
+var acceptedFeatures = map[string]bool{
+	"ping":      true,
+	"setboard":  true,
+	"playother": true,
+	"san":       true,
+	"usermove":  true,
+	"time":      true,
+	"draw":      true,
+	"sigint":    true,
+	"sigterm":   true,
+	"reuse":     true,
+	"analyze":   true,
+	"myname":    true,
+	"variants":  true,
+	"colors":    true,
+	"name":      true,
+	"nps":       true,
+	"debug":     true,
+	"memory":    true,
+	"smp":       true,
+	"done":      true,
+}
+
+// Default values of the features used by the driver, according to the
+// protocol.
+var defaultFeatures = map[string]string{
+	"ping":     "0",
+	"setboard": "0",
+	"san":      "0",
+	"usermove": "0",
+	"time":     "1",
+	"colors":   "1",
+}
+
+// Limits for a search started with `Go()`. Zero values are not sent to the
+// engine.
+//
+// `MovesPerSession`, `BaseTime` and `Increment` are sent with `level`,
+// `SecondsPerMove` with `st` and `Depth` with `sd`. `Time` and
+// `OpponentTime` are the remaining clock times sent with `time` and `otim`.
+type Limits struct {
+	MovesPerSession int
+	BaseTime        time.Duration
+	Increment       time.Duration
+	SecondsPerMove  time.Duration
+	Depth           int
+	Time            time.Duration
+	OpponentTime    time.Duration
+}
+
+// Thinking output sent by the engine after `post`.
+//
+// Times are measured by the engine in centiseconds. The principal variation
+// only contains moves that could be parsed and are legal when played out
+// from the searched position.
+type Thinking struct {
+	Ply   int
+	Score int
+	Time  time.Duration
+	Nodes int64
+	Pv    []*chess.Move
+}
+
+// An engine process (or anything else speaking CECP).
+type Engine struct {
+	Features map[string]string
+
+	cmd    *exec.Cmd
+	writer io.Writer
+	lines  chan string
+	err    error
+	ping   int
+
+	// The position last sent to the engine, updated with the moves of the
+	// engine. Searches update it in the background, so it is guarded by
+	// `mu`.
+	board *chess.Bitboard
+
+	mu sync.Mutex
+}
+
+// Starts the given engine executable and connects to its standard input
+// and output. The feature negotiation is not performed.
+func Popen(command string, args ...string) (*Engine, error) {
+	cmd := exec.Command(command, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	engine := NewEngine(stdout, stdin)
+	engine.cmd = cmd
+	return engine, nil
+}
+
+// Creates an engine communicating over the given reader and writer.
+func NewEngine(reader io.Reader, writer io.Writer) *Engine {
+	engine := &Engine{
+		Features: map[string]string{},
+		writer:   writer,
+		lines:    make(chan string, 64),
+	}
+
+	for name, value := range defaultFeatures {
+		engine.Features[name] = value
+	}
+
+	go engine.readLines(reader)
+
+	return engine
+}
+
+func (e *Engine) readLines(reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e.lines <- strings.TrimRight(scanner.Text(), "\r")
+	}
+
+	e.err = scanner.Err()
+	if e.err == nil {
+		e.err = io.EOF
+	}
+	close(e.lines)
+}
+
+// Sends a raw command line to the engine.
+func (e *Engine) Send(command string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := io.WriteString(e.writer, command+"\n")
+	return err
+}
+
+// Reads the next line from the engine. A timeout of zero waits forever.
+// Returns an empty line and no error if the timeout expired.
+func (e *Engine) readLine(timeout time.Duration) (string, bool, error) {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case line, ok := <-e.lines:
+		if !ok {
+			return "", false, e.err
+		}
+		return line, true, nil
+	case <-timer:
+		return "", false, nil
+	}
+}
+
+// Gets the engine name as announced with the `myname` feature.
+func (e *Engine) Name() string {
+	return e.Features["myname"]
+}
+
+// Checks if the given boolean feature is enabled.
+func (e *Engine) hasFeature(name string) bool {
+	return e.Features[name] == "1"
+}
+
+// Gets the protocol name of the variant of the board. Chess960 is called
+// `fischerandom` and the other variants go by their UCI names.
+func variantName(board *chess.Bitboard) string {
+	if board.IsChess960() {
+		return "fischerandom"
+	} else if board.Variant() == chess.Standard {
+		return "normal"
+	}
+	return board.Variant().UciName()
+}
+
+// Checks if the given variant is in the `variants` feature.
+func (e *Engine) hasVariant(name string) bool {
+	for _, variant := range strings.Split(e.Features["variants"], ",") {
+		if strings.TrimSpace(variant) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Starts the session with `xboard` and `protover 2` and negotiates the
+// features of the engine.
+func (e *Engine) Xboard() error {
+	if err := e.Send("xboard"); err != nil {
+		return err
+	}
+	if err := e.Send("protover 2"); err != nil {
+		return err
+	}
+
+	// After done=0 the engine takes as long as it needs.
+	timeout := HandshakeTimeout
+	for {
+		line, ok, err := e.readLine(timeout)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		command, arg := splitCommand(line)
+		if command != "feature" {
+			continue
+		}
+
+		for _, feature := range parseFeatures(arg) {
+			name, value := feature[0], feature[1]
+			e.Features[name] = value
+
+			if acceptedFeatures[name] {
+				e.Send("accepted " + name)
+			} else {
+				e.Send("rejected " + name)
+			}
+
+			if name == "done" {
+				if value == "1" {
+					return nil
+				}
+				timeout = 0
+			}
+		}
+	}
+}
+
+// Sends `ping` and waits for the matching `pong`, if the engine supports
+// it.
+func (e *Engine) Ping() error {
+	if !e.hasFeature("ping") {
+		return nil
+	}
+
+	e.ping++
+	if err := e.Send("ping " + strconv.Itoa(e.ping)); err != nil {
+		return err
+	}
+
+	for {
+		line, _, err := e.readLine(0)
+		if err != nil {
+			return err
+		}
+
+		command, arg := splitCommand(line)
+		if command == "pong" && arg == strconv.Itoa(e.ping) {
+			return nil
+		}
+	}
+}
+
+// Sets an engine option declared with `feature option="..."`.
+func (e *Engine) SetOption(name, value string) error {
+	return e.Send("option " + name + "=" + value)
+}
+
+// Gets the notation of a move as expected by the engine. The move must be
+// legal in the given position.
+func (e *Engine) moveNotation(board *chess.Bitboard, move *chess.Move) string {
+	notation := move.Uci()
+	if e.hasFeature("san") {
+		notation = board.San(move)
+	} else if board.IsChess960() && strings.HasPrefix(board.San(move), "O-O") {
+		// The protocol expects castling in Fischer random chess as O-O
+		// or O-O-O.
+		notation = strings.TrimRight(board.San(move), "+#")
+	}
+
+	if e.hasFeature("usermove") {
+		return "usermove " + notation
+	}
+	return notation
+}
+
+// Sets up the position of the given board in force mode, replaying its
+// move stack so that the engine can detect repetitions.
+//
+// Returns an error if the game did not start from the starting position
+// of its variant and the engine does not support `setboard`, or if the
+// engine does not support the variant.
+func (e *Engine) Position(board *chess.Bitboard) error {
+	moves := board.MoveStack()
+
+	// Rewind a copy to the starting position of the game, so that the
+	// board of the caller is left alone.
+	replay := board.Copy(true)
+	for range moves {
+		replay.Pop()
+	}
+	fen := replay.Fen()
+
+	if err := e.Send("new"); err != nil {
+		return err
+	}
+	if variant := variantName(board); variant != "normal" {
+		if !e.hasVariant(variant) {
+			return fmt.Errorf("engine does not support %s: '%s'.", variant, e.Features["variants"])
+		}
+		if err := e.Send("variant " + variant); err != nil {
+			return err
+		}
+	}
+	if err := e.Send("force"); err != nil {
+		return err
+	}
+
+	if fen != board.Variant().StartingFen() {
+		if !e.hasFeature("setboard") {
+			return fmt.Errorf("engine does not support setboard: '%s'.", fen)
+		}
+		if err := e.Send("setboard " + fen); err != nil {
+			return err
+		}
+	}
+
+	for _, move := range moves {
+		if err := e.Send(e.moveNotation(replay, move)); err != nil {
+			return err
+		}
+		replay.Push(move)
+	}
+
+	e.mu.Lock()
+	e.board = board.Copy(false)
+	e.mu.Unlock()
+	return nil
+}
+
+// Starts a search with the given limits and waits for the move of the
+// engine.
+func (e *Engine) Go(limits *Limits) (*chess.Move, error) {
+	search, err := e.Start(limits)
+	if err != nil {
+		return nil, err
+	}
+
+	return search.Wait()
+}
+
+// A search running in the background, started with `Engine.Start()`.
+//
+// Thinking output is delivered on the `Thinking` channel, which is closed
+// once the engine made its move. The engine stops sending output until
+// `Thinking` is drained, so callers either range over it or call `Wait()`.
+type Search struct {
+	Thinking <-chan *Thinking
+
+	engine *Engine
+	done   chan struct{}
+	move   *chess.Move
+	err    error
+}
+
+// Starts a search with the given limits without waiting for it to finish.
+func (e *Engine) Start(limits *Limits) (*Search, error) {
+	if limits == nil {
+		limits = &Limits{}
+	}
+
+	commands := []string{}
+	if limits.MovesPerSession > 0 || limits.BaseTime > 0 || limits.Increment > 0 {
+		commands = append(commands, fmt.Sprintf("level %d %s %s",
+			limits.MovesPerSession, formatBaseTime(limits.BaseTime), formatSeconds(limits.Increment)))
+	}
+	if limits.SecondsPerMove > 0 {
+		commands = append(commands, "st "+formatSeconds(limits.SecondsPerMove))
+	}
+	if limits.Depth > 0 {
+		commands = append(commands, "sd "+strconv.Itoa(limits.Depth))
+	}
+	if limits.Time > 0 && e.hasFeature("time") {
+		commands = append(commands, "time "+strconv.FormatInt(int64(limits.Time/(10*time.Millisecond)), 10))
+	}
+	if limits.OpponentTime > 0 && e.hasFeature("time") {
+		commands = append(commands, "otim "+strconv.FormatInt(int64(limits.OpponentTime/(10*time.Millisecond)), 10))
+	}
+	commands = append(commands, "post", "go")
+
+	for _, command := range commands {
+		if err := e.Send(command); err != nil {
+			return nil, err
+		}
+	}
+
+	e.mu.Lock()
+	board := e.board
+	if board == nil {
+		board = chess.NewBitboard("")
+	}
+	board = board.Copy(false)
+	e.mu.Unlock()
+
+	thinking := make(chan *Thinking, 16)
+	search := &Search{
+		Thinking: thinking,
+		engine:   e,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(search.done)
+		defer close(thinking)
+
+		for {
+			line, _, err := e.readLine(0)
+			if err != nil {
+				search.err = err
+				return
+			}
+
+			command, arg := splitCommand(line)
+			switch {
+			case command == "move":
+				search.move, search.err = parseMove(board, arg)
+				if search.err == nil {
+					board.Push(search.move)
+					e.mu.Lock()
+					e.board = board
+					e.mu.Unlock()
+				}
+				return
+			case command == "resign":
+				search.err = fmt.Errorf("engine resigned.")
+				return
+			case command == "Illegal" || command == "Error":
+				search.err = fmt.Errorf("engine error: '%s'.", line)
+				return
+			case ThinkingRegex.MatchString(line):
+				if t := ParseThinking(line, board); t != nil {
+					thinking <- t
+				}
+			}
+		}
+	}()
+
+	return search, nil
+}
+
+// Asks the engine to move immediately.
+func (s *Search) Stop() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		return s.engine.Send("?")
+	}
+}
+
+// Waits for the search to finish and returns the move of the engine.
+// Remaining thinking output is discarded.
+func (s *Search) Wait() (*chess.Move, error) {
+	for range s.Thinking {
+	}
+	<-s.done
+
+	return s.move, s.err
+}
+
+// Asks the engine to quit and waits for the process to exit.
+func (e *Engine) Quit() error {
+	if err := e.Send("quit"); err != nil {
+		return err
+	}
+
+	if closer, ok := e.writer.(io.Closer); ok {
+		closer.Close()
+	}
+
+	if e.cmd != nil {
+		return e.cmd.Wait()
+	}
+
+	return nil
+}
+
+// Matches thinking output: ply, score, time and nodes.
+var ThinkingRegex = regexp.MustCompile(`^\s*(\d+)[.&]?\s+(-?\d+)\s+(\d+)\s+(\d+)(.*)$`)
+
+// Matches move numbers and other tokens to skip in principal variations.
+var pvSkipRegex = regexp.MustCompile(`^(\d+\.+|\.\.\.|\(.*\))$`)
+
+// Parses a line of thinking output in the context of the given position.
+// The position is left unchanged.
+//
+// Returns nil if the line is not thinking output.
+func ParseThinking(line string, board *chess.Bitboard) *Thinking {
+	match := ThinkingRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	thinking := &Thinking{}
+	thinking.Ply, _ = strconv.Atoi(match[1])
+	thinking.Score, _ = strconv.Atoi(match[2])
+	centiseconds, _ := strconv.ParseInt(match[3], 10, 64)
+	thinking.Time = time.Duration(centiseconds) * 10 * time.Millisecond
+	thinking.Nodes, _ = strconv.ParseInt(match[4], 10, 64)
+
+	// Extended fields (selective depth, speed, tablebase hits) are
+	// separated from the principal variation by a tab.
+	pv := match[5]
+	if index := strings.Index(pv, "\t"); index != -1 {
+		pv = pv[index+1:]
+	}
+
+	thinking.Pv = []*chess.Move{}
+	for _, token := range strings.Fields(pv) {
+		if pvSkipRegex.MatchString(token) {
+			continue
+		}
+
+		move, err := parseMove(board, strings.TrimRight(token, "!?"))
+		if err != nil {
+			break
+		}
+
+		board.Push(move)
+		thinking.Pv = append(thinking.Pv, move)
+	}
+
+	for range thinking.Pv {
+		board.Pop()
+	}
+
+	return thinking
+}
+
+// Matches moves in coordinate notation.
+var coordinateRegex = regexp.MustCompile(`^[a-h][1-8][a-h][1-8][qrbn]?$`)
+
+// Parses a move sent by the engine, either in coordinate notation or in
+// standard algebraic notation.
+func parseMove(board *chess.Bitboard, notation string) (*chess.Move, error) {
+	if coordinateRegex.MatchString(notation) {
+		move := chess.MoveFromUci(notation)
+		if board.IsLegal(move) {
+			return move, nil
+		}
+	}
+
+	if notation == "0-0" {
+		notation = "O-O"
+	} else if notation == "0-0-0" {
+		notation = "O-O-O"
+	}
+
+	move, err := board.ParseSan(notation)
+	if err != nil {
+		return nil, err
+	}
+	if move == nil {
+		return nil, fmt.Errorf("unexpected null move: '%s'.", notation)
+	}
+
+	return move, nil
+}
+
+// Parses the arguments of a `feature` command into name and value pairs.
+// Values may be quoted.
+func parseFeatures(arg string) [][2]string {
+	features := [][2]string{}
+
+	for len(arg) > 0 {
+		arg = strings.TrimSpace(arg)
+		index := strings.Index(arg, "=")
+		if index == -1 {
+			break
+		}
+
+		name := arg[:index]
+		arg = arg[index+1:]
+
+		var value string
+		if strings.HasPrefix(arg, "\"") {
+			end := strings.Index(arg[1:], "\"")
+			if end == -1 {
+				value, arg = arg[1:], ""
+			} else {
+				value, arg = arg[1:end+1], arg[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(arg, " \t")
+			if end == -1 {
+				value, arg = arg, ""
+			} else {
+				value, arg = arg[:end], arg[end:]
+			}
+		}
+
+		features = append(features, [2]string{name, value})
+	}
+
+	return features
+}
+
+// Splits a line into the first token and the rest.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	index := strings.IndexAny(line, " \t")
+	if index == -1 {
+		return line, ""
+	}
+	return line[:index], strings.TrimSpace(line[index+1:])
+}
+
+// Formats the base time of `level` as minutes or minutes:seconds.
+func formatBaseTime(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds%60 == 0 {
+		return strconv.FormatInt(seconds/60, 10)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
@@ -0,0 +1,277 @@
+package xboard
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	chess "github.com/TheOnly92/chess.go"
+)
+
+// The test binary doubles as a fake engine when started with this argument.
+const fakeEngineArg = "-fake-engine"
+
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == fakeEngineArg {
+		fakeEngine()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// A minimal CECP engine. It castles if it can and otherwise plays the
+// first legal move, in coordinate notation or in SAN after
+// `option Notation=san`. Protocol violations, like a move without
+// `usermove` or an accepted feature it did not ask for, are reported with
+// `Error` on the next `go`.
+func fakeEngine() {
+	board := chess.NewBitboard("")
+	san := false
+	problem := ""
+	report := func(message string) {
+		if problem == "" {
+			problem = message
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		command, arg := splitCommand(line)
+		switch command {
+		case "xboard":
+		case "protover":
+			fmt.Println(`feature ping=1 setboard=1 usermove=1 san=0 myname="Fake Engine"`)
+			fmt.Println(`feature variants="normal,atomic" option="Notation -combo coordinate /// san" egt=syzygy done=1`)
+		case "accepted":
+			if arg == "egt" {
+				report("accepted egt")
+			}
+		case "rejected":
+			if arg != "egt" && arg != "option" {
+				report("rejected " + arg)
+			}
+		case "ping":
+			fmt.Println("pong " + arg)
+		case "option":
+			san = arg == "Notation=san"
+		case "new":
+			board = chess.NewBitboard("")
+		case "variant":
+			board = chess.NewVariantBitboard(chess.VariantByName(arg), "")
+		case "setboard":
+			if err := board.SetFen(arg); err != nil {
+				report(err.Error())
+			}
+		case "usermove":
+			move, err := parseMove(board, arg)
+			if err != nil {
+				fmt.Println("Illegal move: " + arg)
+				continue
+			}
+			board.Push(move)
+		case "force", "level", "st", "sd", "time", "otim", "post", "?":
+		case "go":
+			if problem != "" {
+				fmt.Println("Error (" + problem + "): go")
+				continue
+			}
+
+			moves := board.GenerateLegalMoves(true, true, true, true, true, true, true)
+			move := moves[0]
+			for _, candidate := range moves {
+				if strings.HasPrefix(board.San(candidate), "O-O") {
+					move = candidate
+				}
+			}
+
+			notation := move.Uci()
+			if san {
+				notation = board.San(move)
+			}
+			board.Push(move)
+			reply := board.GenerateLegalMoves(true, true, true, true, true, true, true)[0]
+			board.Pop()
+
+			fmt.Printf("1 15 3 20 %s %s\n", notation, reply.Uci())
+			fmt.Println("move " + notation)
+			board.Push(move)
+		case "quit":
+			return
+		default:
+			report("unknown command " + line)
+		}
+	}
+}
+
+func startFakeEngine(t *testing.T) *Engine {
+	engine, err := Popen(os.Args[0], fakeEngineArg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Xboard(); err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestXboard(t *testing.T) {
+	start := time.Now()
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	if time.Since(start) >= HandshakeTimeout {
+		t.Error("expected the negotiation to end with done=1")
+	}
+	if engine.Name() != "Fake Engine" {
+		t.Errorf("unexpected name '%s'", engine.Name())
+	}
+	for name, value := range map[string]string{"ping": "1", "usermove": "1", "san": "0", "time": "1", "variants": "normal,atomic"} {
+		if engine.Features[name] != value {
+			t.Errorf("expected feature %s=%s, got '%s'", name, value, engine.Features[name])
+		}
+	}
+	if !engine.hasVariant("atomic") || engine.hasVariant("horde") {
+		t.Errorf("unexpected variants '%s'", engine.Features["variants"])
+	}
+
+	if err := engine.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGo(t *testing.T) {
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	board := chess.NewBitboard("")
+	for _, san := range []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6"} {
+		if _, err := board.PushSan(san); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fen := board.Fen()
+
+	if err := engine.Position(board); err != nil {
+		t.Fatal(err)
+	}
+	if board.Fen() != fen || len(board.MoveStack()) != 6 {
+		t.Errorf("Position() changed the board: %s", board.Fen())
+	}
+
+	search, err := engine.Start(&Limits{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var thinking []*Thinking
+	for line := range search.Thinking {
+		thinking = append(thinking, line)
+	}
+	move, err := search.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	castling, _ := board.ParseSan("O-O")
+	if move == nil || !move.Equals(castling) {
+		t.Errorf("expected the engine to castle, got %v", move)
+	}
+	if len(thinking) != 1 {
+		t.Fatalf("expected 1 line of thinking, got %d", len(thinking))
+	}
+	if info := thinking[0]; info.Ply != 1 || info.Score != 15 || info.Time != 30*time.Millisecond || info.Nodes != 20 || len(info.Pv) != 2 {
+		t.Errorf("unexpected thinking %+v", info)
+	}
+
+	// The engine answers in SAN now, and the game goes on from its move.
+	if err := engine.SetOption("Notation", "san"); err != nil {
+		t.Fatal(err)
+	}
+	board.Push(move)
+	board.PushSan("d6")
+	if err := engine.Position(board); err != nil {
+		t.Fatal(err)
+	}
+	move, err = engine.Go(&Limits{SecondsPerMove: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := board.GenerateLegalMoves(true, true, true, true, true, true, true)[0]
+	if move == nil || !move.Equals(expected) {
+		t.Errorf("expected %s, got %v", expected.Uci(), move)
+	}
+}
+
+func TestPositionSetboard(t *testing.T) {
+	engine := startFakeEngine(t)
+	defer engine.Quit()
+
+	fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	board := chess.NewBitboard(fen)
+	if _, err := board.PushSan("Bxa6"); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Position(board); err != nil {
+		t.Fatal(err)
+	}
+
+	// Black can castle, which the engine sends as O-O.
+	if err := engine.SetOption("Notation", "san"); err != nil {
+		t.Fatal(err)
+	}
+	move, err := engine.Go(&Limits{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if castling, _ := board.ParseSan("O-O"); move == nil || !move.Equals(castling) {
+		t.Errorf("expected the engine to castle, got %v", move)
+	}
+
+	// Variants need to be announced by the engine.
+	if err := engine.Position(chess.NewVariantBitboard(chess.Atomic, "")); err != nil {
+		t.Error(err)
+	}
+	if err := engine.Position(chess.NewVariantBitboard(chess.Horde, "")); err == nil {
+		t.Error("expected an error for an unsupported variant")
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	board := chess.NewBitboard("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	tests := []struct {
+		notation string
+		uci      string
+	}{
+		{"e1g1", "e1g1"},
+		{"O-O", "e1g1"},
+		{"0-0-0", "e1c1"},
+		{"Rxa8+", "a1a8"},
+		{"a1b1", "a1b1"},
+	}
+
+	for _, test := range tests {
+		move, err := parseMove(board, test.notation)
+		if err != nil {
+			t.Errorf("%s: %s", test.notation, err)
+		} else if move.Uci() != test.uci {
+			t.Errorf("%s: expected %s, got %s", test.notation, test.uci, move.Uci())
+		}
+	}
+
+	for _, notation := range []string{"e1e3", "Qd1", "--", "foo"} {
+		if _, err := parseMove(board, notation); err == nil {
+			t.Errorf("%s: expected an error", notation)
+		}
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	features := parseFeatures(`ping=1 myname="Some Engine 1.0" variants="normal,atomic" done=0`)
+	expected := [][2]string{{"ping", "1"}, {"myname", "Some Engine 1.0"}, {"variants", "normal,atomic"}, {"done", "0"}}
+	if fmt.Sprint(features) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, features)
+	}
+}